@@ -0,0 +1,445 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// sessionCookieName is the cookie that carries browser sessions.
+	sessionCookieName = "calidad_session"
+	// defaultSessionTTL is how long a browser stays signed in when
+	// App.SessionTTL is unset.
+	defaultSessionTTL = 7 * 24 * time.Hour
+	// csrfHeader must accompany state-changing requests authenticated by
+	// the session cookie. Browsers only let other origins send it after a
+	// CORS preflight, which keeps cross-site forms from using the session.
+	csrfHeader = "X-Requested-With"
+)
+
+// The scopes of tokens. API tokens authenticate any request as a bearer
+// token. Calendar tokens only read the calendar feeds, which calendar apps
+// fetch with the token in the URL, so that a leaked feed URL gives away no
+// more than the feed.
+const (
+	TokenScopeAPI      = "api"
+	TokenScopeCalendar = "calendar"
+)
+
+// passwordIterations is the PBKDF2 work factor of new password hashes.
+// Stored hashes record their own, so raising it does not lock anyone out.
+var passwordIterations = 600_000
+
+// hashPassword returns a salted PBKDF2-SHA256 hash of password in the form
+// pbkdf2-sha256$iterations$salt$key.
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	rand.Read(salt)
+	key, err := pbkdf2.Key(sha256.New, password, salt, passwordIterations, 32)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", passwordIterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// checkPassword reports whether password matches a hash made by
+// hashPassword.
+func checkPassword(hash, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return false
+	}
+	salt, err1 := base64.RawStdEncoding.DecodeString(parts[2])
+	want, err2 := base64.RawStdEncoding.DecodeString(parts[3])
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	got, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(want))
+	return err == nil && subtle.ConstantTimeCompare(got, want) == 1
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// checkMissingPassword spends as long as checkPassword, so that failed
+// logins take the same time whether or not the username exists.
+func checkMissingPassword(password string) {
+	dummyHashOnce.Do(func() { dummyHash, _ = hashPassword("calidad") })
+	checkPassword(dummyHash, password)
+}
+
+// newSecret returns a random credential with a recognizable prefix.
+func newSecret(prefix string) string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return prefix + base64.RawURLEncoding.EncodeToString(b)
+}
+
+// hashSecret is how API tokens and session cookies are stored. They are
+// random and long, so a fast hash is enough.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// createUser hashes password and stores a new user with the given role.
+func createUser(store UserStore, username, password, role string) (User, error) {
+	if strings.TrimSpace(username) == "" || password == "" {
+		return User{}, errors.New("username and password are required")
+	}
+	if !isUserRole(role) {
+		return User{}, fmt.Errorf("role %q: must be one of %s", role, strings.Join(userRoles, ", "))
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return User{}, err
+	}
+	return store.CreateUser(User{Username: username, PasswordHash: hash, Role: role, CreatedAt: time.Now()})
+}
+
+// createToken issues a new token with the given scope for a user and
+// returns it together with the token itself, which is not stored.
+func createToken(store UserStore, userID int, name, scope string) (APIToken, string, error) {
+	secret := newSecret("cal_")
+	token, err := store.CreateToken(APIToken{UserID: userID, Name: name, Hash: hashSecret(secret), Scope: scope, CreatedAt: time.Now()})
+	return token, secret, err
+}
+
+type userKey struct{}
+
+// currentUser returns the user requireUser authenticated.
+func currentUser(ctx context.Context) User {
+	user, _ := ctx.Value(userKey{}).(User)
+	return user
+}
+
+func (app *App) sessionTTL() time.Duration {
+	if app.SessionTTL > 0 {
+		return app.SessionTTL
+	}
+	return defaultSessionTTL
+}
+
+// errUnauthenticated explains why a request could not be authenticated.
+type errUnauthenticated string
+
+func (e errUnauthenticated) Error() string { return string(e) }
+
+// authenticate finds the user behind a request, from a bearer token or,
+// failing that, a session cookie.
+func (app *App) authenticate(r *http.Request) (User, error) {
+	now := time.Now()
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, token, _ := strings.Cut(header, " ")
+		if !strings.EqualFold(scheme, "Bearer") || token == "" {
+			return User{}, errUnauthenticated("Authorization must use the Bearer scheme")
+		}
+		user, err := app.Store.UserForToken(hashSecret(token), TokenScopeAPI, now)
+		if errors.Is(err, ErrUserNotFound) {
+			return User{}, errUnauthenticated("the API token is invalid or revoked")
+		}
+		return user, err
+	}
+
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return User{}, errUnauthenticated("sign in or send an API token")
+	}
+	user, err := app.Store.UserForSession(hashSecret(cookie.Value), now)
+	if errors.Is(err, ErrUserNotFound) {
+		return User{}, errUnauthenticated("the session has expired, sign in again")
+	} else if err != nil {
+		return User{}, err
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+	default:
+		if r.Header.Get(csrfHeader) == "" {
+			return User{}, errUnauthenticated("requests authenticated by the session cookie must send " + csrfHeader)
+		}
+	}
+	return user, nil
+}
+
+// authenticateFeed is authenticate for the calendar feeds: a calendar token
+// in the token query parameter stands in for the headers calendar apps
+// cannot send.
+func (app *App) authenticateFeed(r *http.Request) (User, error) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		return app.authenticate(r)
+	}
+	user, err := app.Store.UserForToken(hashSecret(token), TokenScopeCalendar, time.Now())
+	if errors.Is(err, ErrUserNotFound) {
+		return User{}, errUnauthenticated("the calendar token is invalid or revoked")
+	}
+	return user, err
+}
+
+// requireUser only lets authenticated requests through to next, with the
+// user in the request context.
+func (app *App) requireUser(next http.HandlerFunc) http.HandlerFunc {
+	return app.withUser(app.authenticate, next)
+}
+
+// requireAdmin is requireUser for what only admins may do.
+func (app *App) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return app.requireUser(func(w http.ResponseWriter, r *http.Request) {
+		if user := currentUser(r.Context()); user.Role != RoleAdmin {
+			writeError(w, r, http.StatusForbidden, "forbidden", fmt.Sprintf("a %s cannot do this; only admins can", user.Role))
+			return
+		}
+		next(w, r)
+	})
+}
+
+// requireFeedUser is requireUser for the calendar feeds, which also take
+// calendar tokens.
+func (app *App) requireFeedUser(next http.HandlerFunc) http.HandlerFunc {
+	return app.withUser(app.authenticateFeed, next)
+}
+
+func (app *App) withUser(authenticate func(*http.Request) (User, error), next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := authenticate(r)
+		var unauthenticated errUnauthenticated
+		if errors.As(err, &unauthenticated) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="calidad"`)
+			writeError(w, r, http.StatusUnauthorized, "unauthenticated", unauthenticated.Error())
+			return
+		} else if err != nil {
+			writeServerError(w, r, "Failed to authenticate request", err)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), userKey{}, user)))
+	}
+}
+
+// login handles POST /auth/login: it checks a username and password and
+// starts a session held in a cookie.
+func (app *App) login(w http.ResponseWriter, r *http.Request) {
+	var credentials struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&credentials); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "request body must be a JSON object")
+		return
+	}
+
+	user, err := app.Store.GetUserByName(credentials.Username)
+	if errors.Is(err, ErrUserNotFound) {
+		checkMissingPassword(credentials.Password)
+	} else if err != nil {
+		writeServerError(w, r, "Failed to sign in", err)
+		return
+	}
+	if err != nil || !checkPassword(user.PasswordHash, credentials.Password) {
+		writeError(w, r, http.StatusUnauthorized, "invalid_credentials", "wrong username or password")
+		return
+	}
+
+	secret := newSecret("")
+	session := Session{Hash: hashSecret(secret), UserID: user.ID, ExpiresAt: time.Now().Add(app.sessionTTL())}
+	if err := app.Store.CreateSession(session); err != nil {
+		writeServerError(w, r, "Failed to sign in", err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    secret,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		Secure:   app.SecureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// logout handles POST /auth/logout, ending the session of the cookie.
+func (app *App) logout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		if err := app.Store.DeleteSession(hashSecret(cookie.Value)); err != nil {
+			writeServerError(w, r, "Failed to sign out", err)
+			return
+		}
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   app.SecureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getMe handles GET /auth/me.
+func (app *App) getMe(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(currentUser(r.Context()))
+}
+
+// listTokens handles GET /auth/tokens, listing the caller's API tokens.
+func (app *App) listTokens(w http.ResponseWriter, r *http.Request) {
+	tokens, err := app.Store.ListTokens(currentUser(r.Context()).ID)
+	if err != nil {
+		writeServerError(w, r, "Failed to fetch API tokens", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// createAPIToken handles POST /auth/tokens. The response is the only time
+// the token is shown. The scope defaults to an API token; a calendar token
+// subscribes to the feeds as /tasks.ics?token=TOKEN.
+func (app *App) createAPIToken(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name  string `json:"name"`
+		Scope string `json:"scope"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "request body must be a JSON object")
+		return
+	}
+	var errs []FieldError
+	if strings.TrimSpace(body.Name) == "" {
+		errs = append(errs, FieldError{Field: "name", Message: "name is required"})
+	}
+	switch body.Scope {
+	case "":
+		body.Scope = TokenScopeAPI
+	case TokenScopeAPI, TokenScopeCalendar:
+	default:
+		errs = append(errs, FieldError{Field: "scope", Message: "scope must be api or calendar"})
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	token, secret, err := createToken(app.Store, currentUser(r.Context()).ID, body.Name, body.Scope)
+	if err != nil {
+		writeServerError(w, r, "Failed to create API token", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", fmt.Sprintf("/auth/tokens/%d", token.ID))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		APIToken
+		Token string `json:"token"`
+	}{token, secret})
+}
+
+// deleteAPIToken handles DELETE /auth/tokens/{id}.
+func (app *App) deleteAPIToken(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_token_id", "token ID must be a number")
+		return
+	}
+	err = app.Store.DeleteToken(currentUser(r.Context()).ID, id)
+	if errors.Is(err, ErrTokenNotFound) {
+		writeError(w, r, http.StatusNotFound, "token_not_found", "API token not found")
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Failed to revoke API token", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// runUserCommand implements "calidad user add NAME [ROLE]", which creates
+// an editor unless told otherwise, and "calidad user role NAME ROLE". The
+// password of a new user is read from CALIDAD_USER_PASSWORD, or else from
+// the first line of in.
+func runUserCommand(store UserStore, args []string, getenv func(string) string, in io.Reader, out io.Writer) error {
+	const usage = "usage: user add NAME [ROLE] | user role NAME ROLE"
+	if len(args) == 3 && args[0] == "role" {
+		if !isUserRole(args[2]) {
+			return fmt.Errorf("role %q: must be one of %s", args[2], strings.Join(userRoles, ", "))
+		}
+		user, err := store.GetUserByName(args[1])
+		if err != nil {
+			return fmt.Errorf("user %s: %w", args[1], err)
+		}
+		if err := store.SetUserRole(user.ID, args[2]); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "user %s is now %s\n", user.Username, args[2])
+		return nil
+	}
+	if len(args) < 2 || len(args) > 3 || args[0] != "add" {
+		return errors.New(usage)
+	}
+	role := RoleEditor
+	if len(args) == 3 {
+		role = args[2]
+	}
+
+	password := getenv("CALIDAD_USER_PASSWORD")
+	if password == "" {
+		fmt.Fprintf(out, "Password for %s: ", args[1])
+		line, err := bufio.NewReader(in).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("reading password: %w", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+	user, err := createUser(store, args[1], password, role)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "created %s %s with ID %d\n", user.Role, user.Username, user.ID)
+	return nil
+}
+
+// runTokenCommand implements "calidad token create USER [NAME]" and prints
+// the new token.
+func runTokenCommand(store UserStore, args []string, out io.Writer) error {
+	if len(args) < 2 || len(args) > 3 || args[0] != "create" {
+		return fmt.Errorf("usage: token create USER [NAME]")
+	}
+	user, err := store.GetUserByName(args[1])
+	if err != nil {
+		return fmt.Errorf("user %s: %w", args[1], err)
+	}
+	name := "cli"
+	if len(args) == 3 {
+		name = args[2]
+	}
+	_, secret, err := createToken(store, user.ID, name, TokenScopeAPI)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, secret)
+	return nil
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPasswordHashing(t *testing.T) {
+	hash, err := hashPassword("correct horse")
+	if err != nil {
+		t.Fatalf("hashPassword returned error: %v", err)
+	}
+	if !strings.HasPrefix(hash, "pbkdf2-sha256$") {
+		t.Errorf("hashPassword returned %q, want a pbkdf2-sha256 hash", hash)
+	}
+	if !checkPassword(hash, "correct horse") {
+		t.Error("checkPassword rejected the right password")
+	}
+	for _, wrong := range []string{"", "correct horse ", "Correct horse"} {
+		if checkPassword(hash, wrong) {
+			t.Errorf("checkPassword accepted %q", wrong)
+		}
+	}
+	if other, _ := hashPassword("correct horse"); other == hash {
+		t.Error("Two hashes of the same password are equal, the salt is not random")
+	}
+	if checkPassword("plain", "plain") {
+		t.Error("checkPassword accepted a malformed hash")
+	}
+}
+
+func TestRequireUser(t *testing.T) {
+	store := newTestStore(t)
+	handler := NewRouter(&App{Store: store})
+
+	tests := []struct {
+		name          string
+		authorization string
+	}{
+		{"no credentials", ""},
+		{"unknown token", "Bearer nope"},
+		{"other scheme", "Basic dGVzdGVyOnRlc3Rlci1wYXNzd29yZA=="},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/tasks", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			assertProblem(t, rr, http.StatusUnauthorized, "unauthenticated")
+			if rr.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 response has no WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+func TestTasksAreScopedToTheirOwner(t *testing.T) {
+	store := newTestStore(t)
+	handler := NewRouter(&App{Store: store})
+
+	other, err := createUser(store, "other", "other-password", RoleEditor)
+	if err != nil {
+		t.Fatalf("createUser returned error: %v", err)
+	}
+	mine := createTaskInStore(t, store, Task{Title: "Mine", DueDate: "2024-12-01", Priority: 1})
+	theirs := createTaskInStore(t, store, Task{Title: "Theirs", DueDate: "2024-12-01", Priority: 1, OwnerID: other.ID})
+
+	rr := executeRequest(httptest.NewRequest(http.MethodGet, "/tasks", nil), handler)
+	var tasks []Task
+	json.Unmarshal(rr.Body.Bytes(), &tasks)
+	if len(tasks) != 1 || tasks[0].ID != mine {
+		t.Errorf("GET /tasks returned %s, want only task %d", rr.Body.String(), mine)
+	}
+
+	path := fmt.Sprintf("/tasks/%d", theirs)
+	requests := []*http.Request{
+		httptest.NewRequest(http.MethodGet, path, nil),
+		httptest.NewRequest(http.MethodPut, path, strings.NewReader(`{"title": "Mine now", "due_date": "2024-12-01", "priority": 1}`)),
+		httptest.NewRequest(http.MethodPatch, path, strings.NewReader(`{"title": "Mine now"}`)),
+		httptest.NewRequest(http.MethodDelete, path, nil),
+		httptest.NewRequest(http.MethodPost, path+"/reopen", nil),
+	}
+	for _, req := range requests {
+		assertProblem(t, executeRequest(req, handler), http.StatusNotFound, "task_not_found")
+	}
+	if task, err := store.Get(theirs); err != nil || task.Title != "Theirs" {
+		t.Errorf("Another user's task was changed: %+v, %v", task, err)
+	}
+
+	// Tasks cannot be created for or handed over to someone else.
+	body := fmt.Sprintf(`{"title": "Gift", "due_date": "2024-12-01", "priority": 1, "owner_id": %d}`, other.ID)
+	assertProblem(t, executeRequest(httptest.NewRequest(http.MethodPost, "/tasks", strings.NewReader(body)), handler),
+		http.StatusUnprocessableEntity, "validation_failed")
+	patch := fmt.Sprintf(`{"owner_id": %d}`, other.ID)
+	assertProblem(t, executeRequest(httptest.NewRequest(http.MethodPatch, fmt.Sprintf("/tasks/%d", mine), strings.NewReader(patch)), handler),
+		http.StatusUnprocessableEntity, "validation_failed")
+}
+
+func TestLoginSession(t *testing.T) {
+	store := newTestStore(t)
+	handler := NewRouter(&App{Store: store})
+
+	login := func(password string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"username": %q, "password": %q}`, testUsername, password)
+		req := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	assertProblem(t, login("wrong"), http.StatusUnauthorized, "invalid_credentials")
+
+	rr := login(testPassword)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Login returned %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != sessionCookieName || !cookies[0].HttpOnly || cookies[0].SameSite != http.SameSiteLaxMode {
+		t.Fatalf("Login set cookies %+v, want one HttpOnly SameSite=Lax session cookie", cookies)
+	}
+	session := cookies[0]
+
+	withSession := func(method, path, body string) *http.Request {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.AddCookie(session)
+		return req
+	}
+
+	rr = executeRequest(withSession(http.MethodGet, "/auth/me", ""), handler)
+	var me User
+	json.Unmarshal(rr.Body.Bytes(), &me)
+	if rr.Code != http.StatusOK || me.Username != testUsername {
+		t.Errorf("GET /auth/me returned %v %s, want the test user", rr.Code, rr.Body.String())
+	}
+	if strings.Contains(rr.Body.String(), "pbkdf2") {
+		t.Error("GET /auth/me leaked the password hash")
+	}
+
+	// Changes made with the cookie need the CSRF header.
+	task := `{"title": "From the browser", "due_date": "2024-12-01", "priority": 1}`
+	assertProblem(t, executeRequest(withSession(http.MethodPost, "/tasks", task), handler), http.StatusUnauthorized, "unauthenticated")
+	req := withSession(http.MethodPost, "/tasks", task)
+	req.Header.Set(csrfHeader, "fetch")
+	if rr := executeRequest(req, handler); rr.Code != http.StatusCreated {
+		t.Errorf("POST /tasks with the session returned %v want %v: %s", rr.Code, http.StatusCreated, rr.Body.String())
+	}
+
+	if rr := executeRequest(withSession(http.MethodPost, "/auth/logout", ""), handler); rr.Code != http.StatusNoContent {
+		t.Errorf("Logout returned %v want %v", rr.Code, http.StatusNoContent)
+	}
+	assertProblem(t, executeRequest(withSession(http.MethodGet, "/auth/me", ""), handler), http.StatusUnauthorized, "unauthenticated")
+}
+
+func TestAPITokens(t *testing.T) {
+	store := newTestStore(t)
+	handler := NewRouter(&App{Store: store})
+
+	rr := executeRequest(httptest.NewRequest(http.MethodPost, "/auth/tokens", strings.NewReader(`{"name": "laptop"}`)), handler)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("POST /auth/tokens returned %v want %v: %s", rr.Code, http.StatusCreated, rr.Body.String())
+	}
+	var created struct {
+		ID    int    `json:"id"`
+		Name  string `json:"name"`
+		Token string `json:"token"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &created)
+	if created.Name != "laptop" || !strings.HasPrefix(created.Token, "cal_") {
+		t.Fatalf("Created token %s, want a cal_ token named laptop", rr.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/tokens", nil)
+	req.Header.Set("Authorization", "Bearer "+created.Token)
+	rr = executeRequest(req, handler)
+	if rr.Code != http.StatusOK || strings.Contains(rr.Body.String(), created.Token) || !strings.Contains(rr.Body.String(), "laptop") {
+		t.Errorf("GET /auth/tokens with the new token returned %v %s", rr.Code, rr.Body.String())
+	}
+
+	assertProblem(t, executeRequest(httptest.NewRequest(http.MethodPost, "/auth/tokens", strings.NewReader(`{}`)), handler),
+		http.StatusUnprocessableEntity, "validation_failed")
+
+	path := fmt.Sprintf("/auth/tokens/%d", created.ID)
+	if rr := executeRequest(httptest.NewRequest(http.MethodDelete, path, nil), handler); rr.Code != http.StatusNoContent {
+		t.Errorf("DELETE %s returned %v want %v", path, rr.Code, http.StatusNoContent)
+	}
+	assertProblem(t, executeRequest(httptest.NewRequest(http.MethodDelete, path, nil), handler), http.StatusNotFound, "token_not_found")
+
+	req = httptest.NewRequest(http.MethodGet, "/auth/me", nil)
+	req.Header.Set("Authorization", "Bearer "+created.Token)
+	assertProblem(t, executeRequest(req, handler), http.StatusUnauthorized, "unauthenticated")
+}
+
+func TestUserAndTokenCommands(t *testing.T) {
+	store := newTestStore(t)
+	var out bytes.Buffer
+
+	noEnv := func(string) string { return "" }
+	if err := runUserCommand(store, []string{"add", "carol"}, noEnv, strings.NewReader("s3cret\n"), &out); err != nil {
+		t.Fatalf("user add returned error: %v", err)
+	}
+	user, err := store.GetUserByName("carol")
+	if err != nil || !checkPassword(user.PasswordHash, "s3cret") {
+		t.Fatalf("user add stored %+v, %v; want carol with password s3cret", user, err)
+	}
+	if err := runUserCommand(store, []string{"add", "carol"}, noEnv, strings.NewReader("again\n"), &out); err == nil {
+		t.Error("Adding an existing user succeeded")
+	}
+	if err := runUserCommand(store, []string{"role", "carol", "admin"}, noEnv, nil, &out); err != nil {
+		t.Fatalf("user role returned error: %v", err)
+	}
+	if user, _ = store.GetUser(user.ID); user.Role != RoleAdmin {
+		t.Errorf("user role left carol a %s, want an admin", user.Role)
+	}
+	if err := runUserCommand(store, []string{"role", "carol", "owner"}, noEnv, nil, &out); err == nil {
+		t.Error("Setting an unknown role succeeded")
+	}
+
+	out.Reset()
+	if err := runTokenCommand(store, []string{"create", "carol", "script"}, &out); err != nil {
+		t.Fatalf("token create returned error: %v", err)
+	}
+	token := strings.TrimSpace(out.String())
+	if got, err := store.UserForToken(hashSecret(token), TokenScopeAPI, user.CreatedAt); err != nil || got.ID != user.ID {
+		t.Errorf("Printed token %q authenticates %+v, %v; want carol", token, got, err)
+	}
+	if err := runTokenCommand(store, []string{"create", "nobody"}, &out); err == nil {
+		t.Error("Creating a token for a missing user succeeded")
+	}
+}
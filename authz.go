@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+// The roles a user can have.
+const (
+	// RoleViewer can read their tasks and projects but not change them.
+	RoleViewer = "viewer"
+	// RoleEditor can create tasks and projects and change or delete their
+	// own.
+	RoleEditor = "editor"
+	// RoleAdmin can read, change and delete every task and project.
+	RoleAdmin = "admin"
+)
+
+var userRoles = []string{RoleViewer, RoleEditor, RoleAdmin}
+
+func isUserRole(role string) bool {
+	return slices.Contains(userRoles, role)
+}
+
+// Action is something a user does to a task or project.
+type Action string
+
+// The actions an Authorizer decides on.
+const (
+	ActionRead   Action = "read"
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	ActionDelete Action = "delete"
+)
+
+// ErrForbidden is matched by the errors an Authorizer denies actions with.
+var ErrForbidden = errors.New("forbidden")
+
+// forbiddenError denies an action, explaining why.
+type forbiddenError string
+
+func (e forbiddenError) Error() string        { return string(e) }
+func (e forbiddenError) Is(target error) bool { return target == ErrForbidden }
+
+// Authorizer is the access policy of the API, consulted by the task and
+// project handlers before they act.
+type Authorizer interface {
+	// Authorize returns nil if user may perform action on task, or an
+	// error matching ErrForbidden if not. For ActionCreate, task is the
+	// task about to be created. Tasks a user may not read are reported as
+	// not found rather than forbidden.
+	Authorize(user User, action Action, task Task) error
+	// AuthorizeProject is Authorize for projects. Filing a task under a
+	// project takes ActionRead on it.
+	AuthorizeProject(user User, action Action, project Project) error
+	// Scope narrows a task listing to the tasks user may read.
+	Scope(user User, q *TaskQuery)
+}
+
+// RoleAuthorizer is the default Authorizer. Viewers and editors only see
+// their own tasks and projects; viewers cannot change them. Admins can do
+// anything to any of them.
+type RoleAuthorizer struct{}
+
+func (RoleAuthorizer) Authorize(user User, action Action, task Task) error {
+	return authorizeOwned(user, action, task.OwnerID, "tasks")
+}
+
+func (RoleAuthorizer) AuthorizeProject(user User, action Action, project Project) error {
+	return authorizeOwned(user, action, project.OwnerID, "projects")
+}
+
+// authorizeOwned applies the role rules to something owned by ownerID.
+func authorizeOwned(user User, action Action, ownerID int, what string) error {
+	if user.Role == RoleAdmin {
+		return nil
+	}
+	if ownerID != user.ID {
+		return forbiddenError(fmt.Sprintf("only admins can %s %s of other users", action, what))
+	}
+	if action != ActionRead && user.Role != RoleEditor {
+		return forbiddenError(fmt.Sprintf("a %s cannot %s %s", user.Role, action, what))
+	}
+	return nil
+}
+
+func (RoleAuthorizer) Scope(user User, q *TaskQuery) {
+	if user.Role != RoleAdmin {
+		q.OwnerID = user.ID
+	}
+}
+
+func (app *App) authorizer() Authorizer {
+	if app.Authorizer == nil {
+		return RoleAuthorizer{}
+	}
+	return app.Authorizer
+}
+
+// authorize asks the authorizer whether the calling user may perform
+// action on task, answering with a 403 problem if not.
+func (app *App) authorize(w http.ResponseWriter, r *http.Request, action Action, task Task) bool {
+	return writeAuthorizeError(w, r, app.authorizer().Authorize(currentUser(r.Context()), action, task))
+}
+
+// authorizeProject is authorize for projects.
+func (app *App) authorizeProject(w http.ResponseWriter, r *http.Request, action Action, project Project) bool {
+	return writeAuthorizeError(w, r, app.authorizer().AuthorizeProject(currentUser(r.Context()), action, project))
+}
+
+// writeAuthorizeError answers with the problem for an authorization error
+// and reports whether there was none.
+func writeAuthorizeError(w http.ResponseWriter, r *http.Request, err error) bool {
+	if errors.Is(err, ErrForbidden) {
+		writeError(w, r, http.StatusForbidden, "forbidden", err.Error())
+		return false
+	} else if err != nil {
+		writeServerError(w, r, "Failed to authorize request", err)
+		return false
+	}
+	return true
+}
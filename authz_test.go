@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// addTestUser creates a user with the given role and returns an API token
+// for them.
+func addTestUser(t *testing.T, store Store, username, role string) (User, string) {
+	t.Helper()
+	user, err := createUser(store, username, username+"-password", role)
+	if err != nil {
+		t.Fatalf("createUser returned error: %v", err)
+	}
+	_, token, err := createToken(store, user.ID, "tests", TokenScopeAPI)
+	if err != nil {
+		t.Fatalf("createToken returned error: %v", err)
+	}
+	return user, token
+}
+
+func TestRoleAuthorization(t *testing.T) {
+	store := newTestStore(t)
+	handler := NewRouter(&App{Store: store})
+
+	owner := testUser(t, store)
+	viewerUser, viewer := addTestUser(t, store, "vera", RoleViewer)
+	_, editor := addTestUser(t, store, "ed", RoleEditor)
+	_, admin := addTestUser(t, store, "ada", RoleAdmin)
+
+	viewersTask := createTaskInStore(t, store, Task{Title: "Read me", DueDate: "2024-12-01", Priority: 1, OwnerID: viewerUser.ID})
+	taskPath := func(id int) string { return fmt.Sprintf("/tasks/%d", id) }
+
+	tests := []struct {
+		name   string
+		token  string
+		method string
+		path   func(ownersTask int) string
+		body   string
+		status int
+		code   string
+	}{
+		{"viewer reads own task", viewer, http.MethodGet, func(int) string { return taskPath(viewersTask) }, "", http.StatusOK, ""},
+		{"viewer cannot create", viewer, http.MethodPost, func(int) string { return "/tasks" }, `{"title": "New", "due_date": "2024-12-01", "priority": 1}`, http.StatusForbidden, "forbidden"},
+		{"viewer cannot update own", viewer, http.MethodPatch, func(int) string { return taskPath(viewersTask) }, `{"title": "Changed"}`, http.StatusForbidden, "forbidden"},
+		{"viewer cannot replace own", viewer, http.MethodPut, func(int) string { return taskPath(viewersTask) }, `{"title": "Changed", "due_date": "2024-12-01", "priority": 1}`, http.StatusForbidden, "forbidden"},
+		{"viewer cannot delete own", viewer, http.MethodDelete, func(int) string { return taskPath(viewersTask) }, "", http.StatusForbidden, "forbidden"},
+		{"viewer cannot see others'", viewer, http.MethodGet, taskPath, "", http.StatusNotFound, "task_not_found"},
+
+		{"editor creates", editor, http.MethodPost, func(int) string { return "/tasks" }, `{"title": "New", "due_date": "2024-12-01", "priority": 1}`, http.StatusCreated, ""},
+		{"editor cannot see others'", editor, http.MethodGet, taskPath, "", http.StatusNotFound, "task_not_found"},
+		{"editor cannot update others'", editor, http.MethodPatch, taskPath, `{"title": "Changed"}`, http.StatusNotFound, "task_not_found"},
+		{"editor cannot delete others'", editor, http.MethodDelete, taskPath, "", http.StatusNotFound, "task_not_found"},
+		{"owner updates own", testToken, http.MethodPatch, taskPath, `{"title": "Changed"}`, http.StatusOK, ""},
+		{"owner deletes own", testToken, http.MethodDelete, taskPath, "", http.StatusOK, ""},
+
+		{"admin reads others'", admin, http.MethodGet, taskPath, "", http.StatusOK, ""},
+		{"admin updates others'", admin, http.MethodPatch, taskPath, `{"title": "Changed"}`, http.StatusOK, ""},
+		{"admin deletes others'", admin, http.MethodDelete, taskPath, "", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ownersTask := createTaskInStore(t, store, Task{Title: "Owned", DueDate: "2024-12-01", Priority: 2, OwnerID: owner.ID})
+			req := httptest.NewRequest(tt.method, tt.path(ownersTask), strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rr := executeRequest(req, handler)
+			if tt.code != "" {
+				assertProblem(t, rr, tt.status, tt.code)
+			} else if rr.Code != tt.status {
+				t.Errorf("Handler returned wrong status code: got %v want %v, body %s", rr.Code, tt.status, rr.Body.String())
+			}
+		})
+	}
+
+	// Admins list every task, everyone else only their own.
+	for token, wantAll := range map[string]bool{viewer: false, testToken: false, admin: true} {
+		req := httptest.NewRequest(http.MethodGet, "/tasks?limit=1000", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		var tasks []Task
+		json.Unmarshal(executeRequest(req, handler).Body.Bytes(), &tasks)
+		me, _ := store.UserForToken(hashSecret(token), TokenScopeAPI, time.Now())
+		mixed := false
+		for _, task := range tasks {
+			mixed = mixed || task.OwnerID != me.ID
+		}
+		if mixed != wantAll {
+			t.Errorf("%s listed tasks of other users: %v, want %v", me.Username, mixed, wantAll)
+		}
+	}
+}
+
+// denyDeletes is an Authorizer that lets everyone do anything but delete.
+type denyDeletes struct{}
+
+func (denyDeletes) Authorize(user User, action Action, task Task) error {
+	if action == ActionDelete {
+		return forbiddenError("nobody deletes tasks here")
+	}
+	return nil
+}
+
+func (denyDeletes) AuthorizeProject(user User, action Action, project Project) error {
+	if action == ActionDelete {
+		return forbiddenError("nobody deletes projects here")
+	}
+	return nil
+}
+
+func (denyDeletes) Scope(user User, q *TaskQuery) {}
+
+func TestCustomAuthorizer(t *testing.T) {
+	store := newTestStore(t)
+	handler := NewRouter(&App{Store: store, Authorizer: denyDeletes{}})
+
+	other, _ := addTestUser(t, store, "other", RoleViewer)
+	id := createTaskInStore(t, store, Task{Title: "Shared", DueDate: "2024-12-01", Priority: 1, OwnerID: other.ID})
+
+	if rr := executeRequest(httptest.NewRequest(http.MethodGet, fmt.Sprintf("/tasks/%d", id), nil), handler); rr.Code != http.StatusOK {
+		t.Errorf("GET with a permissive authorizer returned %v want %v", rr.Code, http.StatusOK)
+	}
+	rr := executeRequest(httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/tasks/%d", id), nil), handler)
+	assertProblem(t, rr, http.StatusForbidden, "forbidden")
+	if !strings.Contains(rr.Body.String(), "nobody deletes tasks here") {
+		t.Errorf("403 problem does not explain the denial: %s", rr.Body.String())
+	}
+}
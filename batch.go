@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// maxBatchOperations caps the operations of one POST /tasks:batch.
+const maxBatchOperations = 100
+
+// The modes of a batch. An atomic batch applies every operation or, when
+// one fails, none; a per_item batch applies those that succeed.
+const (
+	batchAtomic  = "atomic"
+	batchPerItem = "per_item"
+)
+
+// batchOperation is one write of a batch. Task is the request body the
+// single-task endpoint takes: a task to create, a replacement for update
+// or a merge patch for patch. Delete takes none.
+type batchOperation struct {
+	Op   string          `json:"op"`
+	ID   int             `json:"id,omitempty"`
+	Task json.RawMessage `json:"task,omitempty"`
+}
+
+// batchResult is the response the single-task endpoint gave to an
+// operation: the task it wrote, or the problem that stopped it.
+type batchResult struct {
+	Op     string          `json:"op"`
+	ID     int             `json:"id,omitempty"`
+	Status int             `json:"status"`
+	Task   json.RawMessage `json:"task,omitempty"`
+	Error  json.RawMessage `json:"error,omitempty"`
+}
+
+// errBatchFailed rolls back an atomic batch whose operation failed.
+var errBatchFailed = errors.New("batch operation failed")
+
+// batchTasks handles POST /tasks:batch, which applies create, update, patch
+// and delete operations with the rules of POST, PUT, PATCH and DELETE on
+// single tasks. It responds with the result of each operation, in order.
+// When an operation of an atomic batch, the default, fails, nothing is
+// written and the response is a batch_failed problem holding the failure.
+func (app *App) batchTasks(w http.ResponseWriter, r *http.Request) {
+	var batch struct {
+		Mode       string           `json:"mode"`
+		Operations []batchOperation `json:"operations"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "request body must be a JSON object")
+		return
+	}
+	if batch.Mode == "" {
+		batch.Mode = batchAtomic
+	}
+	if errs := validateBatch(batch.Mode, batch.Operations); len(errs) > 0 {
+		p := newProblem(http.StatusUnprocessableEntity, "validation_failed", "Invalid batch")
+		p.Errors = errs
+		writeProblem(w, r, p)
+		return
+	}
+
+	if batch.Mode == batchPerItem {
+		results := make([]batchResult, len(batch.Operations))
+		for i, op := range batch.Operations {
+			results[i] = app.runBatchOperation(r, op)
+		}
+		writeBatchResults(w, results)
+		return
+	}
+
+	var results []batchResult
+	failed := -1
+	err := app.Store.Atomically(func(tx Store) error {
+		txApp := *app
+		txApp.Store = tx
+		results = make([]batchResult, len(batch.Operations))
+		for i, op := range batch.Operations {
+			results[i] = txApp.runBatchOperation(r, op)
+			if results[i].Status >= 300 {
+				failed = i
+				return errBatchFailed
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errBatchFailed) {
+		p := newProblem(http.StatusUnprocessableEntity, "batch_failed", fmt.Sprintf("operation %d failed, so no operation was applied", failed))
+		p.Extensions = map[string]interface{}{"index": failed, "result": results[failed]}
+		writeProblem(w, r, p)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Failed to apply batch", err)
+		return
+	}
+	writeBatchResults(w, results)
+}
+
+// validateBatch checks the shape of a batch; the operations themselves are
+// validated as they run.
+func validateBatch(mode string, ops []batchOperation) []FieldError {
+	var errs []FieldError
+	if mode != batchAtomic && mode != batchPerItem {
+		errs = append(errs, FieldError{Field: "mode", Message: "mode must be atomic or per_item"})
+	}
+	if len(ops) == 0 || len(ops) > maxBatchOperations {
+		errs = append(errs, FieldError{Field: "operations", Message: fmt.Sprintf("a batch takes 1 to %d operations", maxBatchOperations)})
+	}
+	for i, op := range ops {
+		field := fmt.Sprintf("operations[%d]", i)
+		switch op.Op {
+		case "create":
+			if op.ID != 0 {
+				errs = append(errs, FieldError{Field: field + ".id", Message: "id is assigned by the server and must be omitted"})
+			}
+		case "update", "patch", "delete":
+			if op.ID < 1 {
+				errs = append(errs, FieldError{Field: field + ".id", Message: "id of the task is required"})
+			}
+		default:
+			errs = append(errs, FieldError{Field: field + ".op", Message: "op must be create, update, patch or delete"})
+			continue
+		}
+		if op.Op != "delete" && len(op.Task) == 0 {
+			errs = append(errs, FieldError{Field: field + ".task", Message: "task is required"})
+		}
+	}
+	return errs
+}
+
+// runBatchOperation runs op through the handler of the single-task
+// endpoint it stands for, as the user of r.
+func (app *App) runBatchOperation(r *http.Request, op batchOperation) batchResult {
+	method, path, handler := http.MethodPost, "/tasks", app.createTask
+	switch op.Op {
+	case "update":
+		method, handler = http.MethodPut, app.updateTask
+	case "patch":
+		method, handler = http.MethodPatch, app.patchTask
+	case "delete":
+		method, handler = http.MethodDelete, app.deleteTask
+	}
+	if op.ID != 0 {
+		path = fmt.Sprintf("/tasks/%d", op.ID)
+	}
+	req, _ := http.NewRequestWithContext(r.Context(), method, path, bytes.NewReader(op.Task))
+	req.Header.Set("Content-Type", "application/json")
+	req.SetPathValue("id", strconv.Itoa(op.ID))
+
+	rec := &batchRecorder{header: make(http.Header)}
+	handler(rec, req)
+
+	result := batchResult{Op: op.Op, ID: op.ID, Status: rec.status}
+	body := json.RawMessage(bytes.TrimSpace(rec.body.Bytes()))
+	switch {
+	case rec.status >= 300:
+		result.Error = body
+	case op.Op != "delete":
+		result.Task = body
+		var task Task
+		if json.Unmarshal(body, &task) == nil {
+			result.ID = task.ID
+		}
+	}
+	return result
+}
+
+func writeBatchResults(w http.ResponseWriter, results []batchResult) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// batchRecorder keeps the response a handler writes for one operation.
+type batchRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *batchRecorder) Header() http.Header { return rec.header }
+
+func (rec *batchRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+}
+
+func (rec *batchRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.body.Write(b)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBatchTasks(t *testing.T) {
+	store := newTestStore(t)
+	handler := NewRouter(&App{Store: store})
+
+	review := createTaskInStore(t, store, Task{Title: "Review", DueDate: "2024-12-01", Priority: 1})
+	old := createTaskInStore(t, store, Task{Title: "Old", DueDate: "2024-12-01", Priority: 3})
+	titles := func() string {
+		t.Helper()
+		rr := executeRequest(httptest.NewRequest(http.MethodGet, "/tasks?sort_by=title", nil), handler)
+		var tasks []Task
+		json.Unmarshal(rr.Body.Bytes(), &tasks)
+		var out []string
+		for _, task := range tasks {
+			out = append(out, fmt.Sprintf("%s:%s", task.Title, task.Status))
+		}
+		return strings.Join(out, ",")
+	}
+	batch := func(body string) *httptest.ResponseRecorder {
+		return executeRequest(httptest.NewRequest(http.MethodPost, "/tasks:batch", strings.NewReader(body)), handler)
+	}
+
+	rr := batch(fmt.Sprintf(`{"operations": [
+		{"op": "create", "task": {"title": "Ship", "due_date": "2024-12-02", "priority": 1}},
+		{"op": "patch", "id": %d, "task": {"status": "Completed"}},
+		{"op": "delete", "id": %d}]}`, review, old))
+	var results []batchResult
+	json.Unmarshal(rr.Body.Bytes(), &results)
+	if rr.Code != http.StatusOK || len(results) != 3 {
+		t.Fatalf("POST /tasks:batch returned %v: %s", rr.Code, rr.Body.String())
+	}
+	if results[0].Status != http.StatusCreated || results[0].ID == 0 || results[1].Status != http.StatusOK || results[2].Status != http.StatusOK {
+		t.Errorf("Batch results = %s, want created, patched and deleted", rr.Body.String())
+	}
+	if got := titles(); got != "Review:Completed,Ship:Pending" {
+		t.Errorf("Tasks after the batch = %s, want Review:Completed,Ship:Pending", got)
+	}
+
+	// An atomic batch that fails halfway writes nothing.
+	rr = batch(fmt.Sprintf(`{"operations": [
+		{"op": "create", "task": {"title": "Extra", "due_date": "2024-12-02", "priority": 1}},
+		{"op": "update", "id": %d, "task": {"title": "", "due_date": "2024-12-01", "priority": 1}}]}`, review))
+	assertProblem(t, rr, http.StatusUnprocessableEntity, "batch_failed")
+	var problem struct {
+		Index  int         `json:"index"`
+		Result batchResult `json:"result"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &problem)
+	if problem.Index != 1 || problem.Result.Status != http.StatusUnprocessableEntity || !strings.Contains(string(problem.Result.Error), "validation_failed") {
+		t.Errorf("batch_failed problem = %s, want operation 1 failing validation", rr.Body.String())
+	}
+	if got := titles(); got != "Review:Completed,Ship:Pending" {
+		t.Errorf("Tasks after a failed atomic batch = %s, want them unchanged", got)
+	}
+
+	// A per-item batch keeps what succeeds.
+	rr = batch(`{"mode": "per_item", "operations": [
+		{"op": "create", "task": {"title": "Extra", "due_date": "2024-12-02", "priority": 1}},
+		{"op": "delete", "id": 999}]}`)
+	results = nil
+	json.Unmarshal(rr.Body.Bytes(), &results)
+	if rr.Code != http.StatusOK || len(results) != 2 || results[0].Status != http.StatusCreated || results[1].Status != http.StatusNotFound {
+		t.Errorf("Per-item batch returned %v %s, want a create and a 404", rr.Code, rr.Body.String())
+	}
+	if got := titles(); got != "Extra:Pending,Review:Completed,Ship:Pending" {
+		t.Errorf("Tasks after a per-item batch = %s, want Extra added", got)
+	}
+
+	for _, body := range []string{
+		`{"operations": []}`,
+		`{"mode": "some", "operations": [{"op": "delete", "id": 1}]}`,
+		`{"operations": [{"op": "archive", "id": 1}]}`,
+		`{"operations": [{"op": "update", "task": {}}]}`,
+	} {
+		assertProblem(t, batch(body), http.StatusUnprocessableEntity, "validation_failed")
+	}
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // time zone names work without a system database
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the resolved server settings.
+type Config struct {
+	Store           string
+	DSN             string
+	ListenAddr      string
+	CORSOrigins     []string
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration
+	// IdempotencyRetention is how long Idempotency-Key responses are kept.
+	IdempotencyRetention time.Duration
+	// TaskIDs is how new tasks are named: sequence, uuid or ulid.
+	TaskIDs string
+	// Location is the time zone of due dates given without an offset.
+	Location *time.Location
+	// Transitions are the status changes updates may make.
+	Transitions StatusTransitions
+	// SessionTTL is how long a login lasts.
+	SessionTTL time.Duration
+	// TrashRetention is how long deleted tasks can be restored.
+	TrashRetention time.Duration
+	// ReminderThresholds are how long before due times reminders are sent,
+	// ascending; none turns reminders off. ReminderInterval is how often
+	// the scheduler looks for them.
+	ReminderThresholds []time.Duration
+	ReminderInterval   time.Duration
+	// ReminderNotifiers are where reminders go: log, webhook or smtp.
+	ReminderNotifiers  []string
+	ReminderWebhookURL string
+	SMTPAddr           string
+	SMTPUsername       string
+	SMTPPassword       string
+	SMTPFrom           string
+	SMTPTo             []string
+	// WebhookInterval is how often queued webhook deliveries are sent, and
+	// WebhookRetention how long finished ones stay in the delivery log.
+	WebhookInterval  time.Duration
+	WebhookRetention time.Duration
+	// WebhookAllowPrivate lets webhooks target loopback, private and
+	// link-local addresses.
+	WebhookAllowPrivate bool
+	// SecureCookies marks session cookies Secure.
+	SecureCookies bool
+	// LogLevel is the least level of the log lines printed. Errors that
+	// stop the server are printed whatever it is.
+	LogLevel    slog.Level
+	AutoMigrate bool
+
+	// Args holds the command given after the flags, such as "migrate up".
+	Args []string
+
+	// PrintConfig asks main to print the resolved settings and exit.
+	PrintConfig bool
+
+	values  map[string]string
+	sources map[string]string
+}
+
+// setting describes one configuration key. Every key can be set from the
+// config file (by name), the environment (CALIDAD_<NAME>) and the command
+// line (-<name> with underscores replaced by dashes).
+type setting struct {
+	name   string
+	def    string
+	usage  string
+	secret bool
+}
+
+var settings = []setting{
+	{name: "store", def: "postgres", usage: "task storage backend: postgres, sqlite or memory"},
+	{name: "dsn", usage: "Postgres connection string or SQLite database file, required by those stores", secret: true},
+	{name: "listen_addr", def: ":8080", usage: "address the HTTP server listens on"},
+	{name: "cors_origins", def: "*", usage: "comma-separated list of allowed CORS origins, or *"},
+	{name: "read_timeout", def: "15s", usage: "maximum duration for reading a request"},
+	{name: "write_timeout", def: "15s", usage: "maximum duration for writing a response"},
+	{name: "idle_timeout", def: "60s", usage: "maximum keep-alive idle time"},
+	{name: "shutdown_timeout", def: "10s", usage: "grace period for in-flight requests on shutdown"},
+	{name: "idempotency_retention", def: "24h", usage: "how long responses to Idempotency-Key requests are replayed"},
+	{name: "task_ids", def: "sequence", usage: "how new tasks are named to clients: sequence, or uuid or ulid alongside the sequence"},
+	{name: "timezone", def: "UTC", usage: "time zone of due dates without an offset, such as Europe/Madrid"},
+	{name: "status_transitions", def: defaultTransitions, usage: "status changes updates may make, as a list of From->To edges"},
+	{name: "session_ttl", def: "168h", usage: "how long a login session lasts"},
+	{name: "trash_retention", def: "720h", usage: "how long deleted tasks stay in the trash before they are purged"},
+	{name: "reminder_thresholds", def: "24h,1h", usage: "comma-separated list of how long before due times reminders are sent; empty turns reminders off"},
+	{name: "reminder_interval", def: "1m", usage: "how often the reminder scheduler looks for tasks about to be due"},
+	{name: "reminder_notifiers", def: "log", usage: "comma-separated list of where reminders go: log, webhook and smtp"},
+	{name: "reminder_webhook_url", usage: "URL the webhook notifier posts reminders to", secret: true},
+	{name: "smtp_addr", usage: "host:port of the mail server the smtp notifier sends through"},
+	{name: "smtp_username", usage: "user name for the mail server, if it requires authentication"},
+	{name: "smtp_password", usage: "password for the mail server", secret: true},
+	{name: "smtp_from", usage: "sender address of reminder emails"},
+	{name: "smtp_to", usage: "comma-separated list of addresses reminder emails go to"},
+	{name: "webhook_interval", def: "5s", usage: "how often queued webhook deliveries are sent"},
+	{name: "webhook_retention", def: "720h", usage: "how long delivered and failed webhook deliveries are kept"},
+	{name: "webhook_allow_private", def: "false", usage: "let webhooks target loopback, private and link-local addresses, for webhooks on a trusted network"},
+	{name: "secure_cookies", def: "false", usage: "send session cookies only over HTTPS"},
+	{name: "log_level", def: "info", usage: "log level: debug, info, warn or error"},
+	{name: "auto_migrate", def: "true", usage: "apply pending schema migrations when the server starts"},
+}
+
+func (s setting) envName() string  { return "CALIDAD_" + strings.ToUpper(s.name) }
+func (s setting) flagName() string { return strings.ReplaceAll(s.name, "_", "-") }
+
+// loadConfig resolves the configuration from, in increasing order of
+// precedence, built-in defaults, an optional YAML or TOML file, CALIDAD_*
+// environment variables and command-line flags, then validates the result.
+// lookupEnv reads the environment as os.LookupEnv does: a variable that is
+// set but empty still overrides the file and defaults, so that it can clear
+// a list such as reminder_thresholds.
+func loadConfig(args []string, lookupEnv func(string) (string, bool)) (Config, error) {
+	fs := flag.NewFlagSet("calidad", flag.ContinueOnError)
+	defaultConfigFile, _ := lookupEnv("CALIDAD_CONFIG")
+	configFile := fs.String("config", defaultConfigFile, "path to a YAML or TOML config file (env CALIDAD_CONFIG)")
+	printConfig := fs.Bool("print-config", false, "print the resolved configuration with secrets redacted and exit")
+	flagValues := make(map[string]*string, len(settings))
+	for _, s := range settings {
+		flagValues[s.name] = fs.String(s.flagName(), "", fmt.Sprintf("%s (env %s)", s.usage, s.envName()))
+	}
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	values := make(map[string]string, len(settings))
+	sources := make(map[string]string, len(settings))
+	for _, s := range settings {
+		values[s.name] = s.def
+		sources[s.name] = "default"
+	}
+
+	if *configFile != "" {
+		fileValues, err := readConfigFile(*configFile)
+		if err != nil {
+			return Config{}, err
+		}
+		for name, v := range fileValues {
+			values[name] = v
+			sources[name] = "file"
+		}
+	}
+
+	for _, s := range settings {
+		if v, ok := lookupEnv(s.envName()); ok {
+			values[s.name] = v
+			sources[s.name] = "env"
+		}
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if f.Name == s.flagName() {
+				values[s.name] = *flagValues[s.name]
+				sources[s.name] = "flag"
+			}
+		}
+	})
+
+	cfg, err := parseConfig(values)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.PrintConfig = *printConfig
+	cfg.Args = fs.Args()
+	cfg.values = values
+	cfg.sources = sources
+	return cfg, nil
+}
+
+// readConfigFile loads a flat YAML or TOML document, chosen by extension.
+// List values are joined with commas so they read the same as the
+// environment and flag forms.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+
+	raw := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("config file %s: unsupported format, use .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string, len(raw))
+	for name, v := range raw {
+		if !isSetting(name) {
+			return nil, fmt.Errorf("config file %s: unknown setting %q", path, name)
+		}
+		switch v := v.(type) {
+		case []interface{}:
+			parts := make([]string, len(v))
+			for i, item := range v {
+				parts[i] = fmt.Sprint(item)
+			}
+			values[name] = strings.Join(parts, ",")
+		default:
+			values[name] = fmt.Sprint(v)
+		}
+	}
+	return values, nil
+}
+
+func isSetting(name string) bool {
+	for _, s := range settings {
+		if s.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseConfig converts the resolved string values into a Config, collecting
+// every validation failure so startup reports them all at once.
+func parseConfig(values map[string]string) (Config, error) {
+	var cfg Config
+	var errs []error
+
+	cfg.Store = values["store"]
+	cfg.DSN = values["dsn"]
+	switch cfg.Store {
+	case "postgres", "sqlite":
+		if cfg.DSN == "" {
+			errs = append(errs, fmt.Errorf("dsn is required by the %s store", cfg.Store))
+		}
+	case "memory":
+	default:
+		errs = append(errs, fmt.Errorf("store %q: must be postgres, sqlite or memory", cfg.Store))
+	}
+
+	cfg.TaskIDs = values["task_ids"]
+	switch cfg.TaskIDs {
+	case TaskIDsSequence, TaskIDsUUID, TaskIDsULID:
+	default:
+		errs = append(errs, fmt.Errorf("task_ids %q: must be sequence, uuid or ulid", cfg.TaskIDs))
+	}
+
+	cfg.ListenAddr = values["listen_addr"]
+	if _, _, err := net.SplitHostPort(cfg.ListenAddr); err != nil {
+		errs = append(errs, fmt.Errorf("listen_addr %q: %v", cfg.ListenAddr, err))
+	}
+
+	for _, origin := range strings.Split(values["cors_origins"], ",") {
+		origin = strings.TrimSpace(origin)
+		if origin == "" {
+			continue
+		}
+		if origin != "*" {
+			u, err := url.Parse(origin)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" {
+				errs = append(errs, fmt.Errorf("cors_origins: %q is not an origin like https://example.com", origin))
+				continue
+			}
+		}
+		cfg.CORSOrigins = append(cfg.CORSOrigins, origin)
+	}
+
+	durations := []struct {
+		name string
+		dst  *time.Duration
+	}{
+		{"read_timeout", &cfg.ReadTimeout},
+		{"write_timeout", &cfg.WriteTimeout},
+		{"idle_timeout", &cfg.IdleTimeout},
+		{"shutdown_timeout", &cfg.ShutdownTimeout},
+		{"idempotency_retention", &cfg.IdempotencyRetention},
+		{"session_ttl", &cfg.SessionTTL},
+		{"trash_retention", &cfg.TrashRetention},
+		{"reminder_interval", &cfg.ReminderInterval},
+		{"webhook_interval", &cfg.WebhookInterval},
+		{"webhook_retention", &cfg.WebhookRetention},
+	}
+	for _, d := range durations {
+		v, err := time.ParseDuration(values[d.name])
+		if err != nil || v <= 0 {
+			errs = append(errs, fmt.Errorf("%s %q: must be a positive duration such as 30s", d.name, values[d.name]))
+			continue
+		}
+		*d.dst = v
+	}
+
+	for _, v := range splitList(values["reminder_thresholds"]) {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			errs = append(errs, fmt.Errorf("reminder_thresholds: %q is not a positive duration such as 24h", v))
+			continue
+		}
+		cfg.ReminderThresholds = append(cfg.ReminderThresholds, d)
+	}
+	slices.Sort(cfg.ReminderThresholds)
+	cfg.ReminderThresholds = slices.Compact(cfg.ReminderThresholds)
+	errs = append(errs, parseNotifierConfig(&cfg, values)...)
+
+	loc, err := time.LoadLocation(values["timezone"])
+	if err != nil || values["timezone"] == "" {
+		errs = append(errs, fmt.Errorf("timezone %q: must be an IANA time zone name such as Europe/Madrid", values["timezone"]))
+	}
+	cfg.Location = loc
+
+	transitions, err := parseTransitions(values["status_transitions"])
+	if err != nil {
+		errs = append(errs, fmt.Errorf("status_transitions: %w", err))
+	}
+	cfg.Transitions = transitions
+
+	if err := cfg.LogLevel.UnmarshalText([]byte(values["log_level"])); err != nil {
+		errs = append(errs, fmt.Errorf("log_level %q: must be debug, info, warn or error", values["log_level"]))
+	}
+
+	autoMigrate, err := strconv.ParseBool(values["auto_migrate"])
+	if err != nil {
+		errs = append(errs, fmt.Errorf("auto_migrate %q: must be true or false", values["auto_migrate"]))
+	}
+	cfg.AutoMigrate = autoMigrate
+
+	secureCookies, err := strconv.ParseBool(values["secure_cookies"])
+	if err != nil {
+		errs = append(errs, fmt.Errorf("secure_cookies %q: must be true or false", values["secure_cookies"]))
+	}
+	cfg.SecureCookies = secureCookies
+
+	allowPrivate, err := strconv.ParseBool(values["webhook_allow_private"])
+	if err != nil {
+		errs = append(errs, fmt.Errorf("webhook_allow_private %q: must be true or false", values["webhook_allow_private"]))
+	}
+	cfg.WebhookAllowPrivate = allowPrivate
+
+	return cfg, errors.Join(errs...)
+}
+
+// parseNotifierConfig reads the settings of the reminder notifiers. Each
+// notifier in reminder_notifiers must have its settings.
+func parseNotifierConfig(cfg *Config, values map[string]string) []error {
+	var errs []error
+	cfg.ReminderWebhookURL = values["reminder_webhook_url"]
+	cfg.SMTPAddr = values["smtp_addr"]
+	cfg.SMTPUsername = values["smtp_username"]
+	cfg.SMTPPassword = values["smtp_password"]
+	cfg.SMTPFrom = values["smtp_from"]
+	cfg.SMTPTo = splitList(values["smtp_to"])
+
+	for _, notifier := range splitList(values["reminder_notifiers"]) {
+		switch notifier {
+		case "log":
+		case "webhook":
+			u, err := url.Parse(cfg.ReminderWebhookURL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				errs = append(errs, errors.New("reminder_webhook_url: the webhook notifier needs an http or https URL"))
+			}
+		case "smtp":
+			if _, _, err := net.SplitHostPort(cfg.SMTPAddr); err != nil {
+				errs = append(errs, fmt.Errorf("smtp_addr %q: the smtp notifier needs a host:port", cfg.SMTPAddr))
+			}
+			if cfg.SMTPFrom == "" || len(cfg.SMTPTo) == 0 {
+				errs = append(errs, errors.New("smtp_from and smtp_to are required by the smtp notifier"))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("reminder_notifiers: %q must be log, webhook or smtp", notifier))
+			continue
+		}
+		cfg.ReminderNotifiers = append(cfg.ReminderNotifiers, notifier)
+	}
+	return errs
+}
+
+// splitList splits a comma-separated setting, dropping empty items.
+func splitList(v string) []string {
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+var dsnPasswordPattern = regexp.MustCompile(`(password\s*=\s*)('[^']*'|\S+)`)
+
+// redactDSN hides the password in both URL and key=value connection strings.
+func redactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" && u.User != nil {
+		return u.Redacted()
+	}
+	return dsnPasswordPattern.ReplaceAllString(dsn, "${1}xxxxx")
+}
+
+// Print writes the resolved settings, with secrets redacted, along with
+// where each value came from.
+func (cfg Config) Print(w io.Writer) {
+	names := make([]string, 0, len(settings))
+	secret := make(map[string]bool)
+	for _, s := range settings {
+		names = append(names, s.name)
+		secret[s.name] = s.secret
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		v := cfg.values[name]
+		if secret[name] && v != "" {
+			if name == "dsn" {
+				v = redactDSN(v)
+			} else {
+				v = "xxxxx"
+			}
+		}
+		fmt.Fprintf(w, "%s = %q # %s\n", name, v, cfg.sources[name])
+	}
+}
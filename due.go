@@ -0,0 +1,140 @@
+package main
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"time"
+)
+
+// A due date is either a calendar date, due at the end of that day, or a
+// point in time. Tasks carry it in canonical form: "2006-01-02" for dates
+// and an RFC 3339 timestamp in UTC, to the second, for points in time.
+const (
+	dueDateLayout = "2006-01-02"
+	dueTimeLayout = "2006-01-02T15:04:05Z"
+)
+
+// localDueLayouts are ISO 8601 date-times without an offset. They are read
+// in the App's time zone.
+var localDueLayouts = []string{"2006-01-02T15:04:05", "2006-01-02T15:04"}
+
+// parseDueDate reads a due date in any accepted form: a calendar date, an
+// RFC 3339 timestamp, or a date-time without offset in loc. Dates are
+// returned as midnight UTC, which is also where they sort among timestamps.
+func parseDueDate(s string, loc *time.Location) (t time.Time, allDay bool, err error) {
+	if t, err := time.Parse(dueDateLayout, s); err == nil {
+		return t, true, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC().Truncate(time.Second), false, nil
+	}
+	for _, layout := range localDueLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t.UTC(), false, nil
+		}
+	}
+	return time.Time{}, false, fmt.Errorf("invalid due date %q", s)
+}
+
+// formatDueDate returns the canonical form of a due date.
+func formatDueDate(t time.Time, allDay bool) string {
+	if allDay {
+		return t.Format(dueDateLayout)
+	}
+	return t.UTC().Format(dueTimeLayout)
+}
+
+// normalizeDueDate rewrites a due date given in any accepted form into
+// canonical form. Values it cannot parse are returned unchanged, for
+// validateTask to reject.
+func normalizeDueDate(s string, loc *time.Location) string {
+	t, allDay, err := parseDueDate(s, loc)
+	if err != nil {
+		return s
+	}
+	return formatDueDate(t, allDay)
+}
+
+// dueKey returns the instant a canonical due date sorts at.
+func dueKey(task Task) (time.Time, bool) {
+	t, allDay, _ := parseDueDate(task.DueDate, time.UTC)
+	return t, allDay
+}
+
+// DueBound is a cut-off on due dates. Dates are compared with Day, the
+// calendar date of the cut-off as midnight UTC, and timestamps with At.
+type DueBound struct {
+	Day time.Time
+	At  time.Time
+}
+
+// dueBoundAt returns the cut-off at the instant t, as seen in loc.
+func dueBoundAt(t time.Time, loc *time.Location) DueBound {
+	y, m, d := t.In(loc).Date()
+	return DueBound{Day: time.Date(y, m, d, 0, 0, 0, 0, time.UTC), At: t.UTC().Truncate(time.Second)}
+}
+
+// dueBoundOn returns the cut-off at the start of the calendar date day,
+// which is midnight UTC, in loc.
+func dueBoundOn(day time.Time, loc *time.Location) DueBound {
+	y, m, d := day.Date()
+	return DueBound{Day: day, At: time.Date(y, m, d, 0, 0, 0, 0, loc).UTC()}
+}
+
+// parseDueBound reads a cut-off given as a date or a timestamp.
+func parseDueBound(s string, loc *time.Location) (DueBound, error) {
+	t, allDay, err := parseDueDate(s, loc)
+	if err != nil {
+		return DueBound{}, err
+	}
+	if allDay {
+		return dueBoundOn(t, loc), nil
+	}
+	return dueBoundAt(t, loc), nil
+}
+
+// earlierBound returns the tighter of two upper cut-offs.
+func earlierBound(a, b *DueBound) *DueBound {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	out := *a
+	if b.Day.Before(out.Day) {
+		out.Day = b.Day
+	}
+	if b.At.Before(out.At) {
+		out.At = b.At
+	}
+	return &out
+}
+
+// dueValue is how due dates are written to and read from SQL: a UTC
+// timestamp in dueTimeLayout. Postgres casts it to TIMESTAMPTZ; SQLite keeps
+// the text, whose order is then the order in time.
+type dueValue time.Time
+
+func (v dueValue) Value() (driver.Value, error) {
+	return time.Time(v).UTC().Format(dueTimeLayout), nil
+}
+
+func (v *dueValue) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case time.Time:
+		*v = dueValue(src.UTC())
+		return nil
+	case string:
+		return v.parse(src)
+	case []byte:
+		return v.parse(string(src))
+	}
+	return fmt.Errorf("cannot scan %T into a due date", src)
+}
+
+func (v *dueValue) parse(s string) error {
+	t, err := time.Parse(time.RFC3339, s)
+	*v = dueValue(t.UTC())
+	return err
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalizeDueDate(t *testing.T) {
+	madrid, err := time.LoadLocation("Europe/Madrid")
+	if err != nil {
+		t.Fatalf("LoadLocation returned error: %v", err)
+	}
+
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"2024-12-01", "2024-12-01"},
+		{"2024-12-01T15:00:00Z", "2024-12-01T15:00:00Z"},
+		{"2024-12-01T15:00:00+02:00", "2024-12-01T13:00:00Z"},
+		{"2024-12-01T15:00:00.750Z", "2024-12-01T15:00:00Z"},
+		// Without an offset the configured zone applies, DST included.
+		{"2024-12-01T15:00", "2024-12-01T14:00:00Z"},
+		{"2024-07-01T15:00:00", "2024-07-01T13:00:00Z"},
+		// Unparseable values are left for validateTask to reject.
+		{"tomorrow", "tomorrow"},
+		{"2024-13-45", "2024-13-45"},
+		{"2024-02-30", "2024-02-30"},
+	}
+	for _, tt := range tests {
+		if got := normalizeDueDate(tt.in, madrid); got != tt.want {
+			t.Errorf("normalizeDueDate(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseDueBound(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatalf("LoadLocation returned error: %v", err)
+	}
+
+	// A date starts at midnight in the configured zone.
+	bound, err := parseDueBound("2024-12-01", tokyo)
+	if err != nil {
+		t.Fatalf("parseDueBound returned error: %v", err)
+	}
+	if bound.Day.Format(dueTimeLayout) != "2024-12-01T00:00:00Z" || bound.At.Format(dueTimeLayout) != "2024-11-30T15:00:00Z" {
+		t.Errorf("parseDueBound(date) = %+v", bound)
+	}
+
+	// A timestamp falls on its calendar date in the configured zone.
+	bound, err = parseDueBound("2024-12-01T20:00:00Z", tokyo)
+	if err != nil {
+		t.Fatalf("parseDueBound returned error: %v", err)
+	}
+	if bound.Day.Format(dueTimeLayout) != "2024-12-02T00:00:00Z" || bound.At.Format(dueTimeLayout) != "2024-12-01T20:00:00Z" {
+		t.Errorf("parseDueBound(timestamp) = %+v", bound)
+	}
+}
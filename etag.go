@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// taskETag returns the entity tag of a task. It changes with every change
+// to the task, so it is its version.
+func taskETag(task Task) string {
+	return fmt.Sprintf(`"%d"`, task.Version)
+}
+
+// setETag sends the entity tag of the task a response is about.
+func setETag(w http.ResponseWriter, task Task) {
+	w.Header().Set("ETag", taskETag(task))
+}
+
+// etagListMatches reports whether an If-Match or If-None-Match header lists
+// etag or is "*". The weak comparison of If-None-Match ignores W/ prefixes;
+// the strong one of If-Match never matches a weak tag.
+func etagListMatches(header, etag string, weak bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch answers with a 412 problem and returns false when the
+// request has an If-Match header that does not name the current version of
+// task. The response carries the current ETag.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, task Task) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" || etagListMatches(header, taskETag(task), false) {
+		return true
+	}
+	setETag(w, task)
+	writeVersionConflict(w, r)
+	return false
+}
+
+// ifMatchVersion returns the version of task that the If-Match header of a
+// request checkIfMatch let through holds a change to, or 0 when the request
+// has no If-Match or it is "*".
+func ifMatchVersion(r *http.Request, task Task) int {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return 0
+	}
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimSpace(tag) == "*" {
+			return 0
+		}
+	}
+	return task.Version
+}
+
+// notModified answers with 304 Not Modified and returns true when the
+// request has an If-None-Match header naming the current version of task.
+func notModified(w http.ResponseWriter, r *http.Request, task Task) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" || !etagListMatches(header, taskETag(task), true) {
+		return false
+	}
+	setETag(w, task)
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+func writeVersionConflict(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusPreconditionFailed, "precondition_failed", "the task has changed since that version; fetch it again and retry")
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTaskETags(t *testing.T) {
+	store := newTestStore(t)
+	handler := NewRouter(&App{Store: store})
+
+	id := createTaskInStore(t, store, Task{Title: "Deploy", DueDate: "2024-12-01", Priority: 1})
+	path := fmt.Sprintf("/tasks/%d", id)
+	request := func(method, body string, header ...string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		return executeRequest(req, handler)
+	}
+
+	rr := request(http.MethodGet, "")
+	etag := rr.Header().Get("ETag")
+	if rr.Code != http.StatusOK || etag != `"1"` {
+		t.Fatalf("GET %s returned %v with ETag %q, want 200 with \"1\"", path, rr.Code, etag)
+	}
+	if rr := request(http.MethodGet, "", "If-None-Match", `"0", W/`+etag); rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+		t.Errorf("GET with a matching If-None-Match returned %v %q, want an empty 304", rr.Code, rr.Body.String())
+	}
+	if rr := request(http.MethodGet, "", "If-None-Match", `"0"`); rr.Code != http.StatusOK {
+		t.Errorf("GET with a stale If-None-Match returned %v, want 200", rr.Code)
+	}
+
+	rr = request(http.MethodPatch, `{"priority": 2}`, "If-Match", etag)
+	if rr.Code != http.StatusOK || rr.Header().Get("ETag") != `"2"` {
+		t.Fatalf("PATCH with a matching If-Match returned %v with ETag %q: %s", rr.Code, rr.Header().Get("ETag"), rr.Body.String())
+	}
+
+	// The first ETag is stale now.
+	rr = request(http.MethodPut, `{"title": "Clobber", "due_date": "2024-12-01", "priority": 3}`, "If-Match", etag)
+	assertProblem(t, rr, http.StatusPreconditionFailed, "precondition_failed")
+	if got := rr.Header().Get("ETag"); got != `"2"` {
+		t.Errorf("412 response has ETag %q, want the current \"2\"", got)
+	}
+	assertProblem(t, request(http.MethodPatch, `{"priority": 3, "version": 1}`), http.StatusPreconditionFailed, "precondition_failed")
+	assertProblem(t, request(http.MethodDelete, "", "If-Match", etag), http.StatusPreconditionFailed, "precondition_failed")
+
+	var task Task
+	json.Unmarshal(request(http.MethodGet, "").Body.Bytes(), &task)
+	if task.Title != "Deploy" || task.Priority != 2 {
+		t.Errorf("Task after rejected writes = %+v, want Deploy at priority 2", task)
+	}
+	if rr := request(http.MethodDelete, "", "If-Match", "*"); rr.Code != http.StatusOK {
+		t.Errorf("DELETE with If-Match * returned %v: %s", rr.Code, rr.Body.String())
+	}
+}
+
+// racingStore updates a task just before deleting it, as a concurrent
+// request would between the If-Match check of a DELETE and the delete.
+type racingStore struct{ Store }
+
+func (s racingStore) Delete(id, version, actorID int) error {
+	if task, err := s.Get(id); err == nil {
+		task.Title = "Raced"
+		s.Update(task, 0)
+	}
+	return s.Store.Delete(id, version, actorID)
+}
+
+func TestDeleteChecksIfMatchInTheStore(t *testing.T) {
+	store := newTestStore(t)
+	handler := NewRouter(&App{Store: racingStore{store}})
+	id := createTaskInStore(t, store, Task{Title: "Deploy", DueDate: "2024-12-01", Priority: 1})
+
+	req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/tasks/%d", id), nil)
+	req.Header.Set("If-Match", `"1"`)
+	assertProblem(t, executeRequest(req, handler), http.StatusPreconditionFailed, "precondition_failed")
+	if task, err := store.Get(id); err != nil || task.DeletedAt != nil || task.Title != "Raced" {
+		t.Errorf("Task after a raced DELETE = %+v, %v; want the update kept and the task not deleted", task, err)
+	}
+}
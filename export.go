@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportPageSize is how many tasks an export reads from the store at a
+// time, so that exports of any size stream in constant memory.
+const exportPageSize = 500
+
+// The formats of task exports and imports.
+const (
+	formatCSV    = "csv"
+	formatJSON   = "json"
+	formatNDJSON = "ndjson"
+)
+
+var formatContentTypes = map[string]string{
+	formatCSV:    "text/csv",
+	formatJSON:   "application/json",
+	formatNDJSON: "application/x-ndjson",
+}
+
+// csvColumns are the columns of CSV exports, in order. Imports take them in
+// any order and ignore the ones a new task cannot have.
+var csvColumns = []string{"id", "title", "description", "due_date", "priority", "status", "owner_id", "project_id", "position", "parent_id", "tags", "recurrence"}
+
+// exportTasks handles GET /tasks/export?format=csv|json|ndjson, streaming
+// every task the calling user can read, by ID unless sort_by says
+// otherwise. It takes the filters of GET /tasks but not limit and cursor.
+// JSON is the default format. JSON and NDJSON exports keep the UIDs of
+// tasks, which imports only use to find the tasks upserted rows replace.
+func (app *App) exportTasks(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = formatJSON
+	}
+	if _, ok := formatContentTypes[format]; !ok {
+		writeError(w, r, http.StatusBadRequest, "invalid_query", "format must be csv, json or ndjson")
+		return
+	}
+	query, ok := app.exportQuery(w, r)
+	if !ok {
+		return
+	}
+	app.streamTasks(w, r, query, newTaskWriter(w, format), formatContentTypes[format], "tasks."+format)
+}
+
+// exportQuery reads the filters of GET /tasks, without limit and cursor,
+// for a stream of every matching task the calling user can read. Tasks are
+// streamed by ID unless sort_by says otherwise.
+func (app *App) exportQuery(w http.ResponseWriter, r *http.Request) (TaskQuery, bool) {
+	values := r.URL.Query()
+	values.Del("limit")
+	values.Del("cursor")
+	query, err := parseTaskQuery(values, app.location(), time.Now())
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_query", err.Error())
+		return TaskQuery{}, false
+	}
+	if len(query.Sort) == 0 {
+		query.Sort = []SortKey{{Field: "id"}}
+	}
+	app.authorizer().Scope(currentUser(r.Context()), &query)
+	return query, true
+}
+
+// streamTasks writes every task query selects to out, a page at a time, as
+// a download named filename. It reads the first page before answering, so
+// that a failing store is still reported with a problem.
+func (app *App) streamTasks(w http.ResponseWriter, r *http.Request, query TaskQuery, out taskWriter, contentType, filename string) {
+	query.Limit = exportPageSize
+	tasks, err := app.Store.List(query)
+	if err != nil {
+		writeServerError(w, r, "Failed to export tasks", err)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	for {
+		for _, task := range tasks {
+			if err = out.Write(task); err != nil {
+				break
+			}
+		}
+		if err != nil || len(tasks) < query.Limit {
+			break
+		}
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		query.After = &tasks[len(tasks)-1]
+		if tasks, err = app.Store.List(query); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = out.Close()
+	}
+	if err != nil {
+		// The status is sent; all that is left is to cut the export short.
+		slog.ErrorContext(r.Context(), "failed to export tasks", "request_id", requestID(r.Context()), "error", err)
+	}
+}
+
+// taskWriter encodes a stream of tasks. Close ends the stream; it does not
+// close the underlying writer.
+type taskWriter interface {
+	Write(task Task) error
+	Close() error
+}
+
+func newTaskWriter(w io.Writer, format string) taskWriter {
+	switch format {
+	case formatCSV:
+		return &csvTaskWriter{w: csv.NewWriter(w)}
+	case formatNDJSON:
+		return &ndjsonTaskWriter{enc: json.NewEncoder(w)}
+	}
+	return &jsonTaskWriter{w: w}
+}
+
+// csvTaskWriter writes a header row and then one row per task. Tags are
+// joined with commas.
+type csvTaskWriter struct {
+	w         *csv.Writer
+	wroteHead bool
+}
+
+func (c *csvTaskWriter) Write(task Task) error {
+	if !c.wroteHead {
+		c.wroteHead = true
+		if err := c.w.Write(csvColumns); err != nil {
+			return err
+		}
+	}
+	optional := func(n int) string {
+		if n == 0 {
+			return ""
+		}
+		return strconv.Itoa(n)
+	}
+	return c.w.Write([]string{
+		strconv.Itoa(task.ID), task.Title, task.Description, task.DueDate, strconv.Itoa(task.Priority), task.Status,
+		optional(task.OwnerID), optional(task.ProjectID), optional(task.Position), optional(task.ParentID),
+		strings.Join(task.Tags, ","), task.Recurrence,
+	})
+}
+
+func (c *csvTaskWriter) Close() error {
+	if !c.wroteHead {
+		c.wroteHead = true
+		c.w.Write(csvColumns)
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// jsonTaskWriter writes a JSON array of tasks.
+type jsonTaskWriter struct {
+	w     io.Writer
+	count int
+}
+
+func (j *jsonTaskWriter) Write(task Task) error {
+	sep := ","
+	if j.count == 0 {
+		sep = "["
+	}
+	j.count++
+	data, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(j.w, sep); err != nil {
+		return err
+	}
+	_, err = j.w.Write(data)
+	return err
+}
+
+func (j *jsonTaskWriter) Close() error {
+	end := "]\n"
+	if j.count == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(j.w, end)
+	return err
+}
+
+// ndjsonTaskWriter writes one JSON task per line.
+type ndjsonTaskWriter struct {
+	enc *json.Encoder
+}
+
+func (n *ndjsonTaskWriter) Write(task Task) error { return n.enc.Encode(task) }
+
+func (n *ndjsonTaskWriter) Close() error { return nil }
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExportTasks(t *testing.T) {
+	store := newTestStore(t)
+	handler := NewRouter(&App{Store: store})
+
+	for i, title := range []string{"Write, then \"ship\"", "Review", "Deploy"} {
+		createTaskInStore(t, store, Task{Title: title, DueDate: "2024-12-01", Priority: i + 1, Tags: []string{"ops", "q4"}})
+	}
+	other, _ := addTestUser(t, store, "other", RoleEditor)
+	createTaskInStore(t, store, Task{Title: "Theirs", DueDate: "2024-12-01", Priority: 1, OwnerID: other.ID})
+
+	export := func(query string) *httptest.ResponseRecorder {
+		t.Helper()
+		rr := executeRequest(httptest.NewRequest(http.MethodGet, "/tasks/export"+query, nil), handler)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("GET /tasks/export%s returned %v: %s", query, rr.Code, rr.Body.String())
+		}
+		return rr
+	}
+
+	rr := export("")
+	var tasks []Task
+	if err := json.Unmarshal(rr.Body.Bytes(), &tasks); err != nil || len(tasks) != 3 || tasks[0].Title != "Write, then \"ship\"" {
+		t.Errorf("JSON export = %s (%v), want the three tasks of the caller by ID", rr.Body.String(), err)
+	}
+	if got := rr.Header().Get("Content-Disposition"); got != `attachment; filename="tasks.json"` {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+
+	rr = export("?format=csv&priority=1,2")
+	records, err := csv.NewReader(rr.Body).ReadAll()
+	if err != nil || len(records) != 3 || strings.Join(records[0], ",") != strings.Join(csvColumns, ",") {
+		t.Fatalf("CSV export = %q (%v), want a header and two rows", records, err)
+	}
+	if records[1][1] != "Write, then \"ship\"" || records[1][10] != "ops,q4" || rr.Header().Get("Content-Type") != "text/csv" {
+		t.Errorf("CSV row = %q, want the title and tags intact", records[1])
+	}
+
+	rr = export("?format=ndjson&sort_by=-priority")
+	scanner := bufio.NewScanner(rr.Body)
+	var titles []string
+	for scanner.Scan() {
+		var task Task
+		json.Unmarshal(scanner.Bytes(), &task)
+		titles = append(titles, task.Title)
+	}
+	if strings.Join(titles, "|") != "Deploy|Review|Write, then \"ship\"" {
+		t.Errorf("NDJSON export titles = %q", titles)
+	}
+
+	if rr := export("?q=nothing"); strings.TrimSpace(rr.Body.String()) != "[]" {
+		t.Errorf("Empty JSON export = %q, want []", rr.Body.String())
+	}
+	assertProblem(t, executeRequest(httptest.NewRequest(http.MethodGet, "/tasks/export?format=xml", nil), handler),
+		http.StatusBadRequest, "invalid_query")
+}
+
+func TestExportTasksStreamsEveryPage(t *testing.T) {
+	store := newTestStore(t)
+	handler := NewRouter(&App{Store: store})
+	for i := 0; i < exportPageSize+2; i++ {
+		createTaskInStore(t, store, Task{Title: "Task", DueDate: "2024-12-01", Priority: 1})
+	}
+
+	rr := executeRequest(httptest.NewRequest(http.MethodGet, "/tasks/export?format=ndjson&limit=1", nil), handler)
+	if lines := strings.Count(rr.Body.String(), "\n"); lines != exportPageSize+2 {
+		t.Errorf("NDJSON export has %d tasks, want %d", lines, exportPageSize+2)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"slices"
+)
+
+// getTaskHistory handles GET /tasks/{id}/history, listing every change
+// made to the task, oldest first. Tasks in the trash keep their history.
+func (app *App) getTaskHistory(w http.ResponseWriter, r *http.Request) {
+	id, ok := app.pathID(w, r)
+	if !ok {
+		return
+	}
+	if _, ok := app.loadAnyTask(w, r, id); !ok {
+		return
+	}
+	entries, err := app.Store.TaskHistory(id)
+	if err != nil {
+		writeServerError(w, r, "Failed to fetch task history", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// diffTasks lists the fields that differ between two versions of a task,
+// by their JSON names, leaving out the ID and version number. A nil version
+// has no fields.
+func diffTasks(before, after *Task) []FieldChange {
+	old, updated := taskFields(before), taskFields(after)
+	names := make([]string, 0, len(old)+len(updated))
+	for name := range old {
+		names = append(names, name)
+	}
+	for name := range updated {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	changes := []FieldChange{}
+	for _, name := range slices.Compact(names) {
+		if name != "id" && name != "version" && !bytes.Equal(old[name], updated[name]) {
+			changes = append(changes, FieldChange{Field: name, Old: old[name], New: updated[name]})
+		}
+	}
+	return changes
+}
+
+// taskFields returns the members of the JSON form of task.
+func taskFields(task *Task) map[string]json.RawMessage {
+	fields := make(map[string]json.RawMessage)
+	if task != nil {
+		data, _ := json.Marshal(task)
+		json.Unmarshal(data, &fields)
+	}
+	return fields
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTaskHistory(t *testing.T) {
+	store := newTestStore(t)
+	handler := NewRouter(&App{Store: store})
+	tester := testUser(t, store)
+
+	body := `{"title": "Deploy", "due_date": "2024-12-01", "priority": 1}`
+	rr := executeRequest(httptest.NewRequest(http.MethodPost, "/tasks", strings.NewReader(body)), handler)
+	var task Task
+	json.Unmarshal(rr.Body.Bytes(), &task)
+	path := fmt.Sprintf("/tasks/%d", task.ID)
+
+	rr = executeRequest(httptest.NewRequest(http.MethodPatch, path, strings.NewReader(`{"status": "In Progress"}`)), handler)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("PATCH %s returned %v: %s", path, rr.Code, rr.Body.String())
+	}
+
+	rr = executeRequest(httptest.NewRequest(http.MethodGet, path+"/history", nil), handler)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("GET %s/history returned %v: %s", path, rr.Code, rr.Body.String())
+	}
+	var entries []HistoryEntry
+	json.Unmarshal(rr.Body.Bytes(), &entries)
+	if len(entries) != 2 || entries[0].Action != HistoryCreate || entries[1].Action != HistoryUpdate {
+		t.Fatalf("GET %s/history = %s, want a create and an update", path, rr.Body.String())
+	}
+	update := entries[1]
+	if update.ActorID != tester.ID || len(update.Changes) != 1 || update.Changes[0].Field != "status" ||
+		string(update.Changes[0].Old) != `"Pending"` || string(update.Changes[0].New) != `"In Progress"` {
+		t.Errorf("Update entry = %+v, want the status change by user %d", update, tester.ID)
+	}
+
+	_, other := addTestUser(t, store, "other", RoleEditor)
+	req := httptest.NewRequest(http.MethodGet, path+"/history", nil)
+	req.Header.Set("Authorization", "Bearer "+other)
+	assertProblem(t, executeRequest(req, handler), http.StatusNotFound, "task_not_found")
+}
+
+func TestDeleteProjectRecordsHistory(t *testing.T) {
+	store := newTestStore(t)
+	handler := NewRouter(&App{Store: store})
+	tester := testUser(t, store)
+
+	project := createProjectInStore(t, store, Project{Name: "Doomed"})
+	parent := createTaskInStore(t, store, Task{Title: "Parent", DueDate: "2024-12-01", Priority: 1, ProjectID: project})
+	child := createTaskInStore(t, store, Task{Title: "Child", DueDate: "2024-12-01", Priority: 1, ProjectID: project, ParentID: parent})
+	trashed := createTaskInStore(t, store, Task{Title: "Trashed", DueDate: "2024-12-01", Priority: 1, ProjectID: project})
+	if err := store.Delete(trashed, 0, 0); err != nil {
+		t.Fatalf("Delete returned error: %v", err)
+	}
+
+	rr := executeRequest(httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/projects/%d?cascade=true", project), nil), handler)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Cascading delete returned %v: %s", rr.Code, rr.Body.String())
+	}
+
+	// Each task moved to the trash gets one delete entry, and those already
+	// there an update for leaving the project.
+	for id, want := range map[int]string{parent: HistoryDelete, child: HistoryDelete, trashed: HistoryUpdate} {
+		entries, err := store.TaskHistory(id)
+		if err != nil {
+			t.Fatalf("TaskHistory returned error: %v", err)
+		}
+		last := entries[len(entries)-1]
+		fields := make(map[string]bool)
+		for _, change := range last.Changes {
+			fields[change.Field] = true
+		}
+		if last.Action != want || last.ActorID != tester.ID || !fields["project_id"] || fields["deleted_at"] != (want == HistoryDelete) {
+			t.Errorf("Last history entry of task %d = %+v, want a %s by user %d", id, last, want, tester.ID)
+		}
+		if want == HistoryDelete && len(entries) != 2 {
+			t.Errorf("Task %d has %d history entries, want create and delete", id, len(entries))
+		}
+	}
+}
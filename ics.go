@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// The components calendar feeds render tasks as. Calendar apps show
+// events; to-dos go to task lists, where apps support them.
+const (
+	icsEvent = "vevent"
+	icsTodo  = "vtodo"
+)
+
+// icsPriorities maps task priorities to the iCalendar PRIORITY property,
+// where 1 is the highest, 5 medium and 9 the lowest.
+var icsPriorities = map[int]int{1: 1, 2: 5, 3: 9}
+
+// icsTodoStatuses maps task statuses to the STATUS of a VTODO. Events have
+// no status for work in progress, so they are all CONFIRMED.
+var icsTodoStatuses = map[string]string{
+	StatusPending:    "NEEDS-ACTION",
+	StatusInProgress: "IN-PROCESS",
+	StatusCompleted:  "COMPLETED",
+}
+
+// getTasksCalendar handles GET /tasks.ics, an iCalendar feed of the tasks
+// the calling user can read, due on their due dates. It takes the filters
+// of GET /tasks and component=vevent|vtodo, events by default. Calendar
+// apps subscribe with a calendar token in the token parameter.
+func (app *App) getTasksCalendar(w http.ResponseWriter, r *http.Request) {
+	query, ok := app.exportQuery(w, r)
+	if !ok {
+		return
+	}
+	app.writeCalendar(w, r, query, "Tasks")
+}
+
+// getProjectCalendar handles GET /projects/{id}/tasks.ics, the feed of the
+// tasks of one project.
+func (app *App) getProjectCalendar(w http.ResponseWriter, r *http.Request) {
+	project, ok := app.loadProject(w, r)
+	if !ok {
+		return
+	}
+	query, ok := app.exportQuery(w, r)
+	if !ok {
+		return
+	}
+	query.ProjectID = project.ID
+	app.writeCalendar(w, r, query, project.Name)
+}
+
+func (app *App) writeCalendar(w http.ResponseWriter, r *http.Request, query TaskQuery, name string) {
+	component := r.URL.Query().Get("component")
+	switch component {
+	case "":
+		component = icsEvent
+	case icsEvent, icsTodo:
+	default:
+		writeError(w, r, http.StatusBadRequest, "invalid_query", "component must be vevent or vtodo")
+		return
+	}
+	out := &icsTaskWriter{w: w, name: name, component: component, stamp: time.Now()}
+	app.streamTasks(w, r, query, out, "text/calendar; charset=utf-8", "tasks.ics")
+}
+
+// icsTaskWriter writes an iCalendar stream with one event or to-do per
+// task. UIDs are made from task IDs and SEQUENCE from versions, so that
+// calendar apps update the entries they have when a task changes.
+type icsTaskWriter struct {
+	w         io.Writer
+	name      string
+	component string
+	stamp     time.Time
+	buf       strings.Builder
+	wroteHead bool
+}
+
+func (c *icsTaskWriter) Write(task Task) error {
+	c.head()
+	component := strings.ToUpper(c.component)
+	c.line("BEGIN", component)
+	c.line("UID", fmt.Sprintf("task-%d@calidad", task.ID))
+	c.line("DTSTAMP", c.stamp.UTC().Format("20060102T150405Z"))
+	if task.Version > 1 {
+		c.line("SEQUENCE", fmt.Sprint(task.Version-1))
+	}
+	c.line("SUMMARY", icsText(task.Title))
+	if task.Description != "" {
+		c.line("DESCRIPTION", icsText(task.Description))
+	}
+	if len(task.Tags) > 0 {
+		tags := make([]string, len(task.Tags))
+		for i, tag := range task.Tags {
+			tags[i] = icsText(tag)
+		}
+		c.line("CATEGORIES", strings.Join(tags, ","))
+	}
+	if priority, ok := icsPriorities[task.Priority]; ok {
+		c.line("PRIORITY", fmt.Sprint(priority))
+	}
+
+	due, allDay := dueKey(task)
+	if c.component == icsTodo {
+		c.dateLine("DUE", due, allDay)
+		if status, ok := icsTodoStatuses[task.Status]; ok {
+			c.line("STATUS", status)
+		}
+	} else {
+		c.dateLine("DTSTART", due, allDay)
+		if allDay {
+			c.dateLine("DTEND", due.AddDate(0, 0, 1), true)
+		}
+		c.line("STATUS", "CONFIRMED")
+		c.line("TRANSP", "TRANSPARENT")
+	}
+	c.line("END", component)
+	return c.flush()
+}
+
+func (c *icsTaskWriter) Close() error {
+	c.head()
+	c.line("END", "VCALENDAR")
+	return c.flush()
+}
+
+func (c *icsTaskWriter) head() {
+	if c.wroteHead {
+		return
+	}
+	c.wroteHead = true
+	c.line("BEGIN", "VCALENDAR")
+	c.line("VERSION", "2.0")
+	c.line("PRODID", "-//calidad//tasks//EN")
+	c.line("CALSCALE", "GREGORIAN")
+	c.line("METHOD", "PUBLISH")
+	c.line("X-WR-CALNAME", icsText(c.name))
+	c.line("REFRESH-INTERVAL;VALUE=DURATION", "PT1H")
+	c.line("X-PUBLISHED-TTL", "PT1H")
+}
+
+// dateLine writes a date property: a DATE for all-day due dates and a UTC
+// DATE-TIME otherwise.
+func (c *icsTaskWriter) dateLine(name string, t time.Time, allDay bool) {
+	if allDay {
+		c.line(name+";VALUE=DATE", t.Format("20060102"))
+		return
+	}
+	c.line(name, t.UTC().Format("20060102T150405Z"))
+}
+
+// line writes a content line, folded so that no line is longer than 75
+// octets without splitting a character.
+func (c *icsTaskWriter) line(name, value string) {
+	line := name + ":" + value
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		c.buf.WriteString(line[:cut])
+		c.buf.WriteString("\r\n ")
+		line = line[cut:]
+		// Continuation lines start with the space.
+		limit = 74
+	}
+	c.buf.WriteString(line)
+	c.buf.WriteString("\r\n")
+}
+
+func (c *icsTaskWriter) flush() error {
+	_, err := io.WriteString(c.w, c.buf.String())
+	c.buf.Reset()
+	return err
+}
+
+// icsText escapes a TEXT value.
+var icsText = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", "").Replace
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// unfoldICS joins the folded lines of an iCalendar stream.
+func unfoldICS(s string) string {
+	return strings.ReplaceAll(s, "\r\n ", "")
+}
+
+func TestTasksCalendar(t *testing.T) {
+	store := newTestStore(t)
+	handler := NewRouter(&App{Store: store})
+
+	project := createProjectInStore(t, store, Project{Name: "Ops"})
+	release := createTaskInStore(t, store, Task{Title: "Release; v2, final", Description: "Tag it\nand ship", DueDate: "2024-12-01",
+		Priority: 1, Tags: []string{"q4"}, ProjectID: project})
+	createTaskInStore(t, store, Task{Title: "Standup", DueDate: "2024-12-02T09:30:00Z", Priority: 3, Status: StatusInProgress})
+	createTaskInStore(t, store, Task{Title: strings.Repeat("Long title ", 12), DueDate: "2024-12-03", Priority: 2, Status: StatusCompleted})
+
+	rr := executeRequest(httptest.NewRequest(http.MethodPost, "/auth/tokens", strings.NewReader(`{"name": "phone", "scope": "calendar"}`)), handler)
+	var token struct {
+		Scope string `json:"scope"`
+		Token string `json:"token"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &token)
+	if rr.Code != http.StatusCreated || token.Scope != TokenScopeCalendar {
+		t.Fatalf("POST /auth/tokens for a calendar returned %v: %s", rr.Code, rr.Body.String())
+	}
+	subscribe := func(path string) *httptest.ResponseRecorder {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr
+	}
+
+	rr = subscribe("/tasks.ics?token=" + token.Token)
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "text/calendar; charset=utf-8" {
+		t.Fatalf("GET /tasks.ics with a calendar token returned %v: %s", rr.Code, rr.Body.String())
+	}
+	body := rr.Body.String()
+	for _, line := range strings.Split(strings.TrimSuffix(body, "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("Line %q is longer than 75 octets", line)
+		}
+	}
+	feed := unfoldICS(body)
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\nVERSION:2.0\r\n",
+		"X-WR-CALNAME:Tasks\r\n",
+		fmt.Sprintf("UID:task-%d@calidad\r\n", release),
+		"SUMMARY:Release\\; v2\\, final\r\nDESCRIPTION:Tag it\\nand ship\r\nCATEGORIES:q4\r\nPRIORITY:1\r\n",
+		"DTSTART;VALUE=DATE:20241201\r\nDTEND;VALUE=DATE:20241202\r\n",
+		"PRIORITY:9\r\nDTSTART:20241202T093000Z\r\n",
+		"SUMMARY:" + strings.Repeat("Long title ", 12),
+		"END:VEVENT\r\nEND:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(feed, want) {
+			t.Errorf("Feed does not contain %q:\n%s", want, feed)
+		}
+	}
+	if n := strings.Count(feed, "BEGIN:VEVENT"); n != 3 {
+		t.Errorf("Feed has %d events, want 3", n)
+	}
+
+	feed = unfoldICS(subscribe("/tasks.ics?component=vtodo&status=Pending,Completed&token=" + token.Token).Body.String())
+	for _, want := range []string{"DUE;VALUE=DATE:20241201\r\nSTATUS:NEEDS-ACTION\r\n", "PRIORITY:5\r\nDUE;VALUE=DATE:20241203\r\nSTATUS:COMPLETED\r\n"} {
+		if !strings.Contains(feed, want) {
+			t.Errorf("To-do feed does not contain %q:\n%s", want, feed)
+		}
+	}
+	if strings.Contains(feed, "Standup") || strings.Contains(feed, "VEVENT") {
+		t.Errorf("To-do feed ignored its filters:\n%s", feed)
+	}
+
+	// The calendar token changes nothing else, and nothing but it goes in
+	// the URL.
+	req := httptest.NewRequest(http.MethodGet, "/tasks", nil)
+	req.Header.Set("Authorization", "Bearer "+token.Token)
+	assertProblem(t, executeRequest(req, handler), http.StatusUnauthorized, "unauthenticated")
+	assertProblem(t, subscribe("/tasks.ics?token="+testToken), http.StatusUnauthorized, "unauthenticated")
+	assertProblem(t, subscribe("/tasks.ics"), http.StatusUnauthorized, "unauthenticated")
+
+	rr = executeRequest(httptest.NewRequest(http.MethodGet, fmt.Sprintf("/projects/%d/tasks.ics", project), nil), handler)
+	feed = unfoldICS(rr.Body.String())
+	if rr.Code != http.StatusOK || strings.Count(feed, "BEGIN:VEVENT") != 1 || !strings.Contains(feed, "X-WR-CALNAME:Ops\r\n") {
+		t.Errorf("Project feed returned %v:\n%s", rr.Code, feed)
+	}
+	assertProblem(t, subscribe("/projects/999/tasks.ics?token="+token.Token), http.StatusNotFound, "project_not_found")
+	assertProblem(t, subscribe("/tasks.ics?component=vjournal&token="+token.Token), http.StatusBadRequest, "invalid_query")
+	assertProblem(t, executeRequest(httptest.NewRequest(http.MethodPost, "/auth/tokens", strings.NewReader(`{"name": "x", "scope": "admin"}`)), handler),
+		http.StatusUnprocessableEntity, "validation_failed")
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// defaultIdempotencyRetention is how long a response is replayed for retries
+// that carry the same Idempotency-Key when App.IdempotencyRetention is unset.
+const defaultIdempotencyRetention = 24 * time.Hour
+
+const maxIdempotencyKeyLength = 255
+
+func (app *App) idempotencyRetention() time.Duration {
+	if app.IdempotencyRetention > 0 {
+		return app.IdempotencyRetention
+	}
+	return defaultIdempotencyRetention
+}
+
+// captureWriter passes a response through while keeping a copy of its
+// status, body and headers.
+type captureWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (c *captureWriter) WriteHeader(status int) {
+	if c.status == 0 {
+		c.status = status
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *captureWriter) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	c.body.Write(b)
+	return c.ResponseWriter.Write(b)
+}
+
+// withIdempotencyKey makes next safe to retry. A request carrying an
+// Idempotency-Key header runs at most once per key within the retention
+// window: retries with the same body get the original successful response
+// replayed, retries with a different body are rejected. Failed requests
+// release the key so they can be retried.
+func (app *App) withIdempotencyKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			writeError(w, r, http.StatusBadRequest, "invalid_idempotency_key", "Idempotency-Key must be at most 255 characters")
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid_body", "request body could not be read")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		// Keys are chosen by clients, so each user gets their own space.
+		key = fmt.Sprintf("%d:%s", currentUser(r.Context()).ID, key)
+
+		hash := sha256.New()
+		io.WriteString(hash, r.Method+" "+r.URL.Path+"\n")
+		hash.Write(body)
+		rec := IdempotencyRecord{Key: key, RequestHash: hex.EncodeToString(hash.Sum(nil)), CreatedAt: time.Now()}
+
+		existing, err := app.Store.GetIdempotencyKey(key)
+		if err == nil && existing.CreatedAt.Before(rec.CreatedAt.Add(-app.idempotencyRetention())) {
+			// Expired: forget it and treat the request as new.
+			err = app.Store.ReleaseIdempotencyKey(key)
+			if err == nil {
+				err = ErrIdempotencyKeyNotFound
+			}
+		}
+		switch {
+		case err == nil:
+			replayIdempotentResponse(w, r, rec, existing)
+			return
+		case !errors.Is(err, ErrIdempotencyKeyNotFound):
+			writeServerError(w, r, "Failed to read idempotency key", err)
+			return
+		}
+
+		if err := app.Store.ReserveIdempotencyKey(rec); errors.Is(err, ErrIdempotencyKeyExists) {
+			writeError(w, r, http.StatusConflict, "idempotency_key_in_use", "a request with this Idempotency-Key is still being processed")
+			return
+		} else if err != nil {
+			writeServerError(w, r, "Failed to reserve idempotency key", err)
+			return
+		}
+
+		capture := &captureWriter{ResponseWriter: w}
+		next(capture, r)
+
+		if capture.status >= 200 && capture.status < 300 {
+			rec.StatusCode = capture.status
+			rec.Location = capture.Header().Get("Location")
+			rec.ETag = capture.Header().Get("ETag")
+			rec.Body = capture.body.Bytes()
+			err = app.Store.CompleteIdempotencyKey(rec)
+		} else {
+			err = app.Store.ReleaseIdempotencyKey(key)
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to record idempotency key", "request_id", requestID(r.Context()), "error", err)
+		}
+	}
+}
+
+func replayIdempotentResponse(w http.ResponseWriter, r *http.Request, req, stored IdempotencyRecord) {
+	if stored.RequestHash != req.RequestHash {
+		writeError(w, r, http.StatusUnprocessableEntity, "idempotency_key_reused", "Idempotency-Key was already used with a different request")
+		return
+	}
+	if stored.StatusCode == 0 {
+		writeError(w, r, http.StatusConflict, "idempotency_key_in_use", "a request with this Idempotency-Key is still being processed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if stored.Location != "" {
+		w.Header().Set("Location", stored.Location)
+	}
+	if stored.ETag != "" {
+		w.Header().Set("ETag", stored.ETag)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(stored.StatusCode)
+	w.Write(stored.Body)
+}
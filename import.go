@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxImportRows caps the tasks of one import and maxImportBytes its size.
+const (
+	maxImportRows  = 10000
+	maxImportBytes = 10 << 20
+)
+
+// importRow is a task read from an import, or the reasons it could not be
+// read.
+type importRow struct {
+	task Task
+	errs []FieldError
+}
+
+// importResult reports what became of one row of an import. Rows count
+// from 1, not counting the header of a CSV file.
+type importResult struct {
+	Row    int             `json:"row"`
+	Op     string          `json:"op"`
+	ID     int             `json:"id,omitempty"`
+	Status int             `json:"status"`
+	Error  json.RawMessage `json:"error,omitempty"`
+}
+
+// errDryRun rolls back an import that was only a trial.
+var errDryRun = errors.New("dry run")
+
+// importTasks handles POST /tasks/import, which adds the tasks of a CSV,
+// JSON or NDJSON file in the shape GET /tasks/export writes. The format is
+// the format parameter or else follows the Content-Type. Every row goes
+// through the rules of POST /tasks, so IDs, UIDs and owners in the file are
+// replaced; parent_id values naming another row are pointed at the task
+// imported from it. With upsert=true, rows whose UID, or ID when they have
+// none, is a task the calling user can see replace that task as PUT
+// /tasks/{id} does instead. Rows
+// that fail are reported and skipped. With dry_run=true nothing is kept,
+// and the IDs reported are only those the tasks would have had.
+func (app *App) importTasks(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	format := values.Get("format")
+	if format == "" {
+		format = formatJSON
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		for f, contentType := range formatContentTypes {
+			if mediaType == contentType {
+				format = f
+			}
+		}
+	}
+	if _, ok := formatContentTypes[format]; !ok {
+		writeError(w, r, http.StatusBadRequest, "invalid_query", "format must be csv, json or ndjson")
+		return
+	}
+	var dryRun, upsert bool
+	for name, dst := range map[string]*bool{"dry_run": &dryRun, "upsert": &upsert} {
+		if v := values.Get(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, "invalid_query", name+" must be true or false")
+				return
+			}
+			*dst = b
+		}
+	}
+
+	rows, err := readImportRows(http.MaxBytesReader(w, r.Body, maxImportBytes), format)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) || err == nil && len(rows) > maxImportRows {
+		writeError(w, r, http.StatusRequestEntityTooLarge, "import_too_large",
+			fmt.Sprintf("an import takes at most %d tasks and %d bytes", maxImportRows, maxImportBytes))
+		return
+	} else if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", fmt.Sprintf("the %s file could not be read: %v", format, err))
+		return
+	}
+
+	var results []importResult
+	err = app.Store.Atomically(func(tx Store) error {
+		txApp := *app
+		txApp.Store = tx
+		results = txApp.importRows(r, rows, upsert)
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		writeServerError(w, r, "Failed to import tasks", err)
+		return
+	}
+
+	summary := struct {
+		DryRun  bool           `json:"dry_run"`
+		Created int            `json:"created"`
+		Updated int            `json:"updated"`
+		Failed  int            `json:"failed"`
+		Results []importResult `json:"results"`
+	}{DryRun: dryRun, Results: results}
+	for _, result := range results {
+		switch {
+		case result.Status >= 300:
+			summary.Failed++
+		case result.Op == "update":
+			summary.Updated++
+		default:
+			summary.Created++
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
+
+// importRows creates or, with upsert, updates the task of each row.
+func (app *App) importRows(r *http.Request, rows []importRow, upsert bool) []importResult {
+	// imported maps the IDs in the file to those of the imported tasks.
+	imported := make(map[int]int)
+	results := make([]importResult, len(rows))
+	for i, row := range rows {
+		if len(row.errs) > 0 {
+			p := newProblem(http.StatusUnprocessableEntity, "validation_failed", "Invalid task data")
+			p.Errors = row.errs
+			problem, _ := json.Marshal(p)
+			results[i] = importResult{Row: i + 1, Op: "create", Status: p.Status, Error: problem}
+			continue
+		}
+
+		task := row.task
+		fileID, fileUID := task.ID, task.UID
+		task.ID, task.UID, task.OwnerID, task.Version, task.DeletedAt = 0, "", 0, 0, nil
+		if id, ok := imported[task.ParentID]; ok {
+			task.ParentID = id
+		}
+		op := batchOperation{Op: "create"}
+		if id, ok := app.replaceable(r, fileID, fileUID); upsert && ok {
+			op = batchOperation{Op: "update", ID: id}
+		}
+		op.Task, _ = json.Marshal(task)
+
+		result := app.runBatchOperation(r, op)
+		results[i] = importResult{Row: i + 1, Op: result.Op, ID: result.ID, Status: result.Status, Error: result.Error}
+		if result.Status < 300 && fileID != 0 {
+			imported[fileID] = result.ID
+		}
+	}
+	return results
+}
+
+// replaceable returns the task an upserted row replaces: the one with the
+// UID of the row, or else with its ID, if it is outside the trash and the
+// calling user can see it.
+func (app *App) replaceable(r *http.Request, id int, uid string) (int, bool) {
+	if id == 0 && uid == "" {
+		return 0, false
+	}
+	task, err := app.Store.Get(id)
+	if uid != "" {
+		task, err = app.Store.GetByUID(uid)
+	}
+	ok := err == nil && task.DeletedAt == nil &&
+		app.authorizer().Authorize(currentUser(r.Context()), ActionRead, task) == nil
+	return task.ID, ok
+}
+
+// readImportRows reads the tasks of an import. An error means the file as
+// a whole is unreadable; rows that are not tasks are returned with the
+// reasons.
+func readImportRows(body io.Reader, format string) ([]importRow, error) {
+	switch format {
+	case formatCSV:
+		return readCSVRows(body)
+	case formatNDJSON:
+		return readNDJSONRows(body)
+	}
+	return readJSONRows(body)
+}
+
+// jsonRow decodes one JSON task of an import.
+func jsonRow(data []byte) importRow {
+	var task Task
+	if err := json.Unmarshal(data, &task); err != nil {
+		return importRow{errs: []FieldError{{Field: "task", Message: "row must be a JSON task object"}}}
+	}
+	return importRow{task: task}
+}
+
+func readJSONRows(body io.Reader) ([]importRow, error) {
+	dec := json.NewDecoder(body)
+	if tok, err := dec.Token(); err != nil {
+		return nil, err
+	} else if tok != json.Delim('[') {
+		return nil, errors.New("expected an array of tasks")
+	}
+	var rows []importRow
+	for dec.More() {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, err
+		}
+		rows = append(rows, jsonRow(raw))
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func readNDJSONRows(body io.Reader) ([]importRow, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(nil, maxImportBytes)
+	var rows []importRow
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		rows = append(rows, jsonRow([]byte(line)))
+	}
+	return rows, scanner.Err()
+}
+
+// readCSVRows reads a CSV file whose first row names the columns, among
+// csvColumns. Missing columns are empty; unknown ones are ignored.
+func readCSVRows(body io.Reader) ([]importRow, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("missing header row")
+	} else if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(strings.ToLower(name))] = i
+	}
+
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		} else if err != nil {
+			return nil, err
+		}
+		rows = append(rows, csvRow(columns, record))
+	}
+}
+
+func csvRow(columns map[string]int, record []string) importRow {
+	value := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+	var row importRow
+	number := func(name string, dst *int) {
+		v := strings.TrimSpace(value(name))
+		if v == "" {
+			return
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			row.errs = append(row.errs, FieldError{Field: name, Message: name + " must be a number"})
+		}
+		*dst = n
+	}
+	number("id", &row.task.ID)
+	number("priority", &row.task.Priority)
+	number("project_id", &row.task.ProjectID)
+	number("position", &row.task.Position)
+	number("parent_id", &row.task.ParentID)
+	row.task.Title = value("title")
+	row.task.Description = value("description")
+	row.task.DueDate = strings.TrimSpace(value("due_date"))
+	row.task.Status = strings.TrimSpace(value("status"))
+	row.task.Tags = listValues(map[string][]string{"tags": {value("tags")}}, "tags")
+	row.task.Recurrence = strings.TrimSpace(value("recurrence"))
+	return row
+}
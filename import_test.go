@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// importSummary is the response of POST /tasks/import.
+type importSummary struct {
+	DryRun  bool           `json:"dry_run"`
+	Created int            `json:"created"`
+	Updated int            `json:"updated"`
+	Failed  int            `json:"failed"`
+	Results []importResult `json:"results"`
+}
+
+func importFile(t *testing.T, handler http.Handler, query, contentType, body string) importSummary {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/tasks/import"+query, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	rr := executeRequest(req, handler)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("POST /tasks/import%s returned %v: %s", query, rr.Code, rr.Body.String())
+	}
+	var summary importSummary
+	json.Unmarshal(rr.Body.Bytes(), &summary)
+	return summary
+}
+
+func TestImportTasksFromCSV(t *testing.T) {
+	store := newTestStore(t)
+	handler := NewRouter(&App{Store: store})
+
+	csvFile := `title,due_date,priority,status,id,parent_id,tags
+Release,2024-12-01,1,Pending,10,,"ops,q4"
+Notes,2024-12-02,1,,11,10,
+,2024-12-03,2,Pending,12,,
+Bad,2024-12-03,high,Pending,13,,
+`
+	summary := importFile(t, handler, "?dry_run=true", "text/csv", csvFile)
+	if !summary.DryRun || summary.Created != 2 || summary.Failed != 2 {
+		t.Errorf("Dry run = %+v, want 2 created and 2 failed", summary)
+	}
+	if tasks, _ := store.List(TaskQuery{}); len(tasks) != 0 {
+		t.Fatalf("Dry run stored %d tasks", len(tasks))
+	}
+
+	summary = importFile(t, handler, "", "text/csv", csvFile)
+	if summary.Created != 2 || summary.Failed != 2 || len(summary.Results) != 4 {
+		t.Fatalf("Import = %+v, want 2 created and 2 failed", summary)
+	}
+	for _, row := range []int{2, 3} {
+		result := summary.Results[row]
+		if result.Row != row+1 || result.Status != http.StatusUnprocessableEntity || !strings.Contains(string(result.Error), "validation_failed") {
+			t.Errorf("Row %d result = %+v, want a validation problem", row+1, result)
+		}
+	}
+	release, err := store.Get(summary.Results[0].ID)
+	if err != nil || release.Title != "Release" || strings.Join(release.Tags, ",") != "ops,q4" {
+		t.Errorf("Imported Release = %+v, %v", release, err)
+	}
+	notes, err := store.Get(summary.Results[1].ID)
+	if err != nil || notes.ParentID != release.ID || notes.Status != StatusPending {
+		t.Errorf("Imported Notes = %+v, %v; want a pending subtask of the imported Release", notes, err)
+	}
+}
+
+func TestImportTasksUpsert(t *testing.T) {
+	store := newTestStore(t)
+	handler := NewRouter(&App{Store: store})
+	id := createTaskInStore(t, store, Task{Title: "Draft", DueDate: "2024-12-01", Priority: 3})
+	other, _ := addTestUser(t, store, "other", RoleEditor)
+	theirs := createTaskInStore(t, store, Task{Title: "Theirs", DueDate: "2024-12-01", Priority: 3, OwnerID: other.ID})
+
+	ndjson := fmt.Sprintf(`{"id": %d, "title": "Final", "due_date": "2024-12-01", "priority": 1}
+{"id": %d, "title": "Mine now", "due_date": "2024-12-01", "priority": 1}
+{"title": "New", "due_date": "2024-12-01", "priority": 2}
+`, id, theirs)
+	summary := importFile(t, handler, "?upsert=true&format=ndjson", "text/plain", ndjson)
+	if summary.Updated != 1 || summary.Created != 2 || summary.Failed != 0 {
+		t.Fatalf("Upsert = %+v, want 1 updated and 2 created", summary)
+	}
+	if task, _ := store.Get(id); task.Title != "Final" || task.Priority != 1 {
+		t.Errorf("Upserted task = %+v, want Final", task)
+	}
+	if task, _ := store.Get(theirs); task.Title != "Theirs" {
+		t.Errorf("Upsert changed a task of another user: %+v", task)
+	}
+
+	summary = importFile(t, handler, "", "application/json", `[{"title": "Array", "due_date": "2024-12-01", "priority": 1}, 5]`)
+	if summary.Created != 1 || summary.Failed != 1 {
+		t.Errorf("JSON import = %+v, want 1 created and 1 failed", summary)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/tasks/import", strings.NewReader(`{"title": "Not an array"}`))
+	assertProblem(t, executeRequest(req, handler), http.StatusBadRequest, "invalid_body")
+}
+
+func TestImportTasksUpsertByUID(t *testing.T) {
+	store := newTestStore(t)
+	handler := NewRouter(&App{Store: store, TaskIDs: TaskIDsUUID})
+	rr := executeRequest(httptest.NewRequest(http.MethodPost, "/tasks",
+		strings.NewReader(`{"title": "Draft", "due_date": "2024-12-01", "priority": 3}`)), handler)
+	var draft Task
+	json.Unmarshal(rr.Body.Bytes(), &draft)
+
+	rr = executeRequest(httptest.NewRequest(http.MethodGet, "/tasks/export?format=ndjson", nil), handler)
+	export := strings.Replace(rr.Body.String(), `"title":"Draft"`, `"title":"Final"`, 1)
+	if !strings.Contains(export, draft.UID) {
+		t.Fatalf("Export %s lacks the UID %s", export, draft.UID)
+	}
+
+	// The UID of the row picks the task to replace, whatever its ID says.
+	export = strings.Replace(export, fmt.Sprintf(`"id":%d`, draft.ID), `"id":999`, 1)
+	summary := importFile(t, handler, "?upsert=true&format=ndjson", "text/plain", export)
+	if summary.Updated != 1 || summary.Failed != 0 || summary.Results[0].ID != draft.ID {
+		t.Fatalf("Upsert of the export = %+v, want the task updated", summary)
+	}
+	if task, _ := store.Get(draft.ID); task.Title != "Final" || task.UID != draft.UID {
+		t.Errorf("Upserted task = %+v, want Final with its UID", task)
+	}
+
+	summary = importFile(t, handler, "?format=ndjson", "text/plain", export)
+	if summary.Created != 1 || summary.Failed != 0 {
+		t.Fatalf("Import of the export = %+v, want 1 created", summary)
+	}
+	if task, _ := store.Get(summary.Results[0].ID); task.UID == "" || task.UID == draft.UID {
+		t.Errorf("Imported task = %+v, want a UID of its own", task)
+	}
+}
+
+func TestImportTasksRoundTrip(t *testing.T) {
+	for _, strategy := range []string{TaskIDsSequence, TaskIDsUUID, TaskIDsULID} {
+		for format, contentType := range formatContentTypes {
+			t.Run(strategy+"/"+format, func(t *testing.T) {
+				store := newTestStore(t)
+				handler := NewRouter(&App{Store: store, TaskIDs: strategy})
+				rr := executeRequest(httptest.NewRequest(http.MethodPost, "/tasks",
+					strings.NewReader(`{"title": "Release", "due_date": "2024-12-01", "priority": 1, "tags": ["ops"]}`)), handler)
+				var release Task
+				json.Unmarshal(rr.Body.Bytes(), &release)
+				executeRequest(httptest.NewRequest(http.MethodPost, "/tasks", strings.NewReader(fmt.Sprintf(
+					`{"title": "Notes", "due_date": "2024-12-02", "priority": 2, "parent_id": %d, "recurrence": "FREQ=WEEKLY"}`, release.ID))), handler)
+
+				rr = executeRequest(httptest.NewRequest(http.MethodGet, "/tasks/export?format="+format, nil), handler)
+				if rr.Code != http.StatusOK {
+					t.Fatalf("GET /tasks/export returned %v: %s", rr.Code, rr.Body.String())
+				}
+				summary := importFile(t, handler, "?format="+format, contentType, rr.Body.String())
+				if summary.Created != 2 || summary.Failed != 0 {
+					t.Fatalf("Import of the export = %+v, want both tasks created", summary)
+				}
+				copied, _ := store.Get(summary.Results[0].ID)
+				notes, _ := store.Get(summary.Results[1].ID)
+				if copied.Title != "Release" || strings.Join(copied.Tags, ",") != "ops" || (strategy == TaskIDsSequence) != (copied.UID == "") ||
+					copied.UID != "" && copied.UID == release.UID {
+					t.Errorf("Imported Release = %+v", copied)
+				}
+				if notes.Title != "Notes" || notes.ParentID != copied.ID || notes.Recurrence != "FREQ=WEEKLY" {
+					t.Errorf("Imported Notes = %+v, want a subtask of the imported Release", notes)
+				}
+			})
+		}
+	}
+}
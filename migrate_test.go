@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+func openTestSQLite(t *testing.T, path string) *sql.DB {
+	t.Helper()
+	db, _, err := openSQLStore("sqlite", path)
+	if err != nil {
+		t.Fatalf("Failed to open SQLite database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/0002_add_index.up.sql":      {Data: []byte("CREATE INDEX i ON t (x);")},
+		"m/0002_add_index.down.sql":    {Data: []byte("DROP INDEX i;")},
+		"m/0001_create_table.up.sql":   {Data: []byte("CREATE TABLE t (x INT);")},
+		"m/0001_create_table.down.sql": {Data: []byte("DROP TABLE t;")},
+	}
+
+	migrations, err := loadMigrations(fsys, "m")
+	if err != nil {
+		t.Fatalf("loadMigrations returned error: %v", err)
+	}
+	if len(migrations) != 2 || migrations[0].Version != 1 || migrations[1].Name != "add_index" {
+		t.Errorf("Unexpected migrations: %+v", migrations)
+	}
+
+	delete(fsys, "m/0002_add_index.down.sql")
+	if _, err := loadMigrations(fsys, "m"); err == nil || !strings.Contains(err.Error(), "down") {
+		t.Errorf("Expected missing down file error, got %v", err)
+	}
+
+	fsys["m/add_index.sql"] = &fstest.MapFile{Data: []byte("")}
+	if _, err := loadMigrations(fsys, "m"); err == nil {
+		t.Error("Expected bad file name error, got nil")
+	}
+}
+
+func TestEmbeddedMigrationsMatchAcrossDialects(t *testing.T) {
+	postgres, err := loadMigrations(migrationFiles, "migrations/postgres")
+	if err != nil {
+		t.Fatalf("Loading postgres migrations: %v", err)
+	}
+	sqlite, err := loadMigrations(migrationFiles, "migrations/sqlite")
+	if err != nil {
+		t.Fatalf("Loading sqlite migrations: %v", err)
+	}
+
+	if len(postgres) != len(sqlite) {
+		t.Fatalf("postgres has %d migrations, sqlite has %d", len(postgres), len(sqlite))
+	}
+	for i := range postgres {
+		if postgres[i].Version != sqlite[i].Version || postgres[i].Name != sqlite[i].Name {
+			t.Errorf("Migration %d differs: postgres %04d_%s, sqlite %04d_%s", i,
+				postgres[i].Version, postgres[i].Name, sqlite[i].Version, sqlite[i].Name)
+		}
+	}
+}
+
+func TestMigrateUpDownStatus(t *testing.T) {
+	db := openTestSQLite(t, ":memory:")
+	migrator, err := NewMigrator(db, sqliteDialect)
+	if err != nil {
+		t.Fatalf("NewMigrator returned error: %v", err)
+	}
+	total := len(migrator.migrations)
+
+	var out bytes.Buffer
+	if err := runMigrateCommand(migrator, []string{"up"}, &out); err != nil {
+		t.Fatalf("migrate up returned error: %v", err)
+	}
+	if got := strings.Count(out.String(), "applied "); got != total {
+		t.Errorf("migrate up applied %d migrations, want %d:\n%s", got, total, out.String())
+	}
+
+	out.Reset()
+	if err := runMigrateCommand(migrator, []string{"up"}, &out); err != nil {
+		t.Fatalf("Second migrate up returned error: %v", err)
+	}
+	if !strings.Contains(out.String(), "up to date") {
+		t.Errorf("Second migrate up did not report an up to date schema: %s", out.String())
+	}
+
+	if _, err := db.Exec(`INSERT INTO tasks (title, due_date, priority) VALUES ('t', '2024-12-01T09:30:00Z', 1)`); err != nil {
+		t.Errorf("tasks table is not usable after migrating up: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO tasks (title, due_date, priority) VALUES ('t', 'tomorrow', 1)`); err == nil {
+		t.Error("tasks table accepted a due date that is not a timestamp")
+	}
+
+	// Text due dates written before 0004 are converted to timestamps.
+	if _, err := migrator.Down(total - 3); err != nil {
+		t.Fatalf("Reverting to 0003 returned error: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO tasks (id, title, due_date, priority) VALUES (50, 'old', '2024-12-01', 1)`); err != nil {
+		t.Fatalf("Inserting a text due date before 0004 failed: %v", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("Up returned error: %v", err)
+	}
+	store := NewSQLiteStore(db)
+	if task, err := store.Get(50); err != nil || task.DueDate != "2024-12-01" {
+		t.Errorf("Converted task = %+v, %v; want due date 2024-12-01", task, err)
+	}
+	if created, err := store.Create(Task{Title: "new", DueDate: "2024-12-02", Priority: 1, Status: "Pending"}, 0); err != nil || created.ID <= 50 {
+		t.Errorf("Create after the rebuild = %+v, %v; want an ID above 50", created, err)
+	}
+
+	out.Reset()
+	if err := runMigrateCommand(migrator, []string{"down", "99"}, &out); err != nil {
+		t.Fatalf("migrate down returned error: %v", err)
+	}
+	if got := strings.Count(out.String(), "reverted "); got != total {
+		t.Errorf("migrate down reverted %d migrations, want %d:\n%s", got, total, out.String())
+	}
+	if _, err := db.Exec(`SELECT 1 FROM tasks`); err == nil {
+		t.Error("tasks table still exists after migrating all the way down")
+	}
+
+	statuses, err := migrator.Status()
+	if err != nil {
+		t.Fatalf("Status returned error: %v", err)
+	}
+	for _, s := range statuses {
+		if s.Applied {
+			t.Errorf("Migration %04d_%s still applied after migrating down", s.Version, s.Name)
+		}
+	}
+
+	if err := runMigrateCommand(migrator, []string{"sideways"}, &out); err == nil {
+		t.Error("Unknown migrate command was accepted")
+	}
+}
+
+// Reverting a migration that rebuilds the tasks table must not take the
+// tags of the tasks with it.
+func TestSQLiteTaskRebuildKeepsTags(t *testing.T) {
+	db := openTestSQLite(t, ":memory:")
+	migrator, err := NewMigrator(db, sqliteDialect)
+	if err != nil {
+		t.Fatalf("NewMigrator returned error: %v", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("Up returned error: %v", err)
+	}
+	store := NewSQLiteStore(db)
+	parent, err := store.Create(Task{Title: "Parent", DueDate: "2024-12-01", Priority: 1, Status: "Pending"}, 0)
+	if err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+	task, err := store.Create(Task{Title: "Tagged", DueDate: "2024-12-01", Priority: 1, Status: "Pending", ParentID: parent.ID, Tags: []string{"bug"}}, 0)
+	if err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+
+	steps := 0
+	for _, mig := range migrator.migrations {
+		if mig.Version >= 9 {
+			steps++
+		}
+	}
+	if _, err := migrator.Down(steps); err != nil {
+		t.Fatalf("Reverting 0009 returned error: %v", err)
+	}
+	var tags int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM task_tags WHERE task_id = $1`, task.ID).Scan(&tags); err != nil || tags != 1 {
+		t.Errorf("Task has %d tags after reverting 0009 (%v), want 1", tags, err)
+	}
+}
+
+func TestConcurrentMigratorsApplyEachMigrationOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.db")
+
+	var wg sync.WaitGroup
+	applied := make([][]Migration, 4)
+	for i := range applied {
+		db := openTestSQLite(t, path)
+		migrator, err := NewMigrator(db, sqliteDialect)
+		if err != nil {
+			t.Fatalf("NewMigrator returned error: %v", err)
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			if applied[i], err = migrator.Up(); err != nil {
+				t.Errorf("Migrator %d failed: %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	count := 0
+	for _, a := range applied {
+		count += len(a)
+	}
+	migrator, _ := NewMigrator(openTestSQLite(t, path), sqliteDialect)
+	if count != len(migrator.migrations) {
+		t.Errorf("Migrations were applied %d times in total, want %d", count, len(migrator.migrations))
+	}
+}
@@ -0,0 +1,3 @@
+DROP TABLE idempotency_keys;
+ALTER TABLE tasks ALTER COLUMN id DROP DEFAULT;
+DROP SEQUENCE tasks_id_seq;
@@ -0,0 +1,15 @@
+-- Tasks get their IDs from a sequence. Databases whose table was created
+-- with SERIAL already own tasks_id_seq.
+CREATE SEQUENCE IF NOT EXISTS tasks_id_seq OWNED BY tasks.id;
+SELECT setval('tasks_id_seq', COALESCE((SELECT MAX(id) FROM tasks), 0) + 1, false);
+ALTER TABLE tasks ALTER COLUMN id SET DEFAULT nextval('tasks_id_seq');
+
+CREATE TABLE idempotency_keys (
+    key TEXT PRIMARY KEY,
+    request_hash TEXT NOT NULL,
+    status_code INTEGER NOT NULL DEFAULT 0,
+    location TEXT NOT NULL DEFAULT '',
+    body BYTEA,
+    created_at BIGINT NOT NULL
+);
+CREATE INDEX idempotency_keys_created_at ON idempotency_keys (created_at);
@@ -0,0 +1,3 @@
+DROP INDEX tasks_status_id;
+DROP INDEX tasks_due_date_id;
+DROP INDEX tasks_priority_id;
@@ -0,0 +1,5 @@
+-- Support the filters and keyset pagination of GET /tasks. The id column
+-- is the tie-breaker of every order.
+CREATE INDEX tasks_priority_id ON tasks (priority, id);
+CREATE INDEX tasks_due_date_id ON tasks (due_date, id);
+CREATE INDEX tasks_status_id ON tasks (status, id);
@@ -0,0 +1,4 @@
+-- Timestamps lose their time of day.
+ALTER TABLE tasks ALTER COLUMN due_date TYPE TEXT
+    USING to_char(due_date AT TIME ZONE 'UTC', 'YYYY-MM-DD');
+ALTER TABLE tasks DROP COLUMN due_all_day;
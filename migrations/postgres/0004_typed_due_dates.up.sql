@@ -0,0 +1,5 @@
+-- Due dates become timestamps. Rows holding something that is not a date
+-- make this migration fail; fix them by hand and run it again.
+ALTER TABLE tasks ADD COLUMN due_all_day BOOLEAN NOT NULL DEFAULT true;
+ALTER TABLE tasks ALTER COLUMN due_date TYPE TIMESTAMPTZ
+    USING (due_date::date)::timestamp AT TIME ZONE 'UTC';
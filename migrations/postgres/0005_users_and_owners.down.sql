@@ -0,0 +1,4 @@
+ALTER TABLE tasks DROP COLUMN owner_id;
+DROP TABLE sessions;
+DROP TABLE api_tokens;
+DROP TABLE users;
@@ -0,0 +1,4 @@
+DROP INDEX tasks_project_position_id;
+ALTER TABLE tasks DROP COLUMN position;
+ALTER TABLE tasks DROP COLUMN project_id;
+DROP TABLE projects;
@@ -0,0 +1,3 @@
+DROP TABLE task_dependencies;
+DROP INDEX tasks_parent_id;
+ALTER TABLE tasks DROP COLUMN parent_id;
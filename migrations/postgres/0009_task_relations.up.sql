@@ -0,0 +1,12 @@
+-- Subtasks go with their parent.
+ALTER TABLE tasks ADD COLUMN parent_id INTEGER REFERENCES tasks (id) ON DELETE CASCADE;
+CREATE INDEX tasks_parent_id ON tasks (parent_id);
+
+-- task_id cannot be completed while blocker_id is open.
+CREATE TABLE task_dependencies (
+    task_id INTEGER NOT NULL REFERENCES tasks (id) ON DELETE CASCADE,
+    blocker_id INTEGER NOT NULL REFERENCES tasks (id) ON DELETE CASCADE,
+    PRIMARY KEY (task_id, blocker_id),
+    CHECK (task_id <> blocker_id)
+);
+CREATE INDEX task_dependencies_blocker_id ON task_dependencies (blocker_id);
@@ -0,0 +1,11 @@
+-- The history is append-only and outlives the tasks and users it names, so
+-- it has no foreign keys.
+CREATE TABLE task_history (
+    id SERIAL PRIMARY KEY,
+    task_id INTEGER NOT NULL,
+    action TEXT NOT NULL CHECK (action IN ('create', 'update', 'delete')),
+    actor_id INTEGER,
+    changed_at BIGINT NOT NULL,
+    changes TEXT NOT NULL
+);
+CREATE INDEX task_history_task_id ON task_history (task_id, id);
@@ -0,0 +1,3 @@
+-- Every change to a task bumps its version, which clients send back in
+-- If-Match to update only the version they have seen.
+ALTER TABLE tasks ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
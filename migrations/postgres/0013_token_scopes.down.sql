@@ -0,0 +1,3 @@
+-- Without scopes calendar tokens would become API tokens, so they go.
+DELETE FROM api_tokens WHERE scope <> 'api';
+ALTER TABLE api_tokens DROP COLUMN scope;
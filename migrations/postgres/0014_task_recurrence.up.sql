@@ -0,0 +1,2 @@
+-- The RRULE of a recurring task; empty for tasks that do not repeat.
+ALTER TABLE tasks ADD COLUMN recurrence TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+DROP INDEX tasks_uid;
+ALTER TABLE tasks DROP COLUMN uid;
@@ -0,0 +1,9 @@
+-- IF NOT EXISTS adopts databases created before migrations existed.
+CREATE TABLE IF NOT EXISTS tasks (
+    id INTEGER PRIMARY KEY,
+    title TEXT NOT NULL,
+    description TEXT,
+    due_date TEXT NOT NULL,
+    priority INTEGER NOT NULL CHECK (priority >= 1 AND priority <= 3),
+    status TEXT NOT NULL DEFAULT 'Pending'
+);
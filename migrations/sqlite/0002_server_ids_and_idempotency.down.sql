@@ -0,0 +1,14 @@
+DROP TABLE idempotency_keys;
+
+CREATE TABLE tasks_old (
+    id INTEGER PRIMARY KEY,
+    title TEXT NOT NULL,
+    description TEXT,
+    due_date TEXT NOT NULL,
+    priority INTEGER NOT NULL CHECK (priority >= 1 AND priority <= 3),
+    status TEXT NOT NULL DEFAULT 'Pending'
+);
+INSERT INTO tasks_old (id, title, description, due_date, priority, status)
+    SELECT id, title, description, due_date, priority, status FROM tasks;
+DROP TABLE tasks;
+ALTER TABLE tasks_old RENAME TO tasks;
@@ -0,0 +1,24 @@
+-- AUTOINCREMENT keeps SQLite from reusing the IDs of deleted tasks, which
+-- needs the table to be rebuilt.
+CREATE TABLE tasks_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    title TEXT NOT NULL,
+    description TEXT,
+    due_date TEXT NOT NULL,
+    priority INTEGER NOT NULL CHECK (priority >= 1 AND priority <= 3),
+    status TEXT NOT NULL DEFAULT 'Pending'
+);
+INSERT INTO tasks_new (id, title, description, due_date, priority, status)
+    SELECT id, title, description, due_date, priority, status FROM tasks;
+DROP TABLE tasks;
+ALTER TABLE tasks_new RENAME TO tasks;
+
+CREATE TABLE idempotency_keys (
+    key TEXT PRIMARY KEY,
+    request_hash TEXT NOT NULL,
+    status_code INTEGER NOT NULL DEFAULT 0,
+    location TEXT NOT NULL DEFAULT '',
+    body BLOB,
+    created_at INTEGER NOT NULL
+);
+CREATE INDEX idempotency_keys_created_at ON idempotency_keys (created_at);
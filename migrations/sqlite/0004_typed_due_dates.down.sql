@@ -0,0 +1,18 @@
+-- Timestamps lose their time of day.
+CREATE TABLE tasks_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    title TEXT NOT NULL,
+    description TEXT,
+    due_date TEXT NOT NULL,
+    priority INTEGER NOT NULL CHECK (priority >= 1 AND priority <= 3),
+    status TEXT NOT NULL DEFAULT 'Pending'
+);
+INSERT INTO tasks_new (id, title, description, due_date, priority, status)
+    SELECT id, title, description, substr(due_date, 1, 10), priority, status FROM tasks;
+DELETE FROM sqlite_sequence WHERE name = 'tasks_new';
+INSERT INTO sqlite_sequence (name, seq) SELECT 'tasks_new', seq FROM sqlite_sequence WHERE name = 'tasks';
+DROP TABLE tasks;
+ALTER TABLE tasks_new RENAME TO tasks;
+CREATE INDEX tasks_priority_id ON tasks (priority, id);
+CREATE INDEX tasks_due_date_id ON tasks (due_date, id);
+CREATE INDEX tasks_status_id ON tasks (status, id);
@@ -0,0 +1,24 @@
+-- SQLite has no timestamp type, so due dates are UTC timestamps in a
+-- single fixed-width format, whose text order is their order in time. Rows
+-- holding something that is not a date make this migration fail; fix them
+-- by hand and run it again.
+CREATE TABLE tasks_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    title TEXT NOT NULL,
+    description TEXT,
+    due_date TEXT NOT NULL
+        CHECK (due_date GLOB '[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9]T[0-9][0-9]:[0-9][0-9]:[0-9][0-9]Z'),
+    due_all_day INTEGER NOT NULL DEFAULT 1 CHECK (due_all_day IN (0, 1)),
+    priority INTEGER NOT NULL CHECK (priority >= 1 AND priority <= 3),
+    status TEXT NOT NULL DEFAULT 'Pending'
+);
+INSERT INTO tasks_new (id, title, description, due_date, due_all_day, priority, status)
+    SELECT id, title, description, strftime('%Y-%m-%dT%H:%M:%SZ', due_date), 1, priority, status FROM tasks;
+-- Keep the ID sequence, so IDs of deleted tasks stay unused.
+DELETE FROM sqlite_sequence WHERE name = 'tasks_new';
+INSERT INTO sqlite_sequence (name, seq) SELECT 'tasks_new', seq FROM sqlite_sequence WHERE name = 'tasks';
+DROP TABLE tasks;
+ALTER TABLE tasks_new RENAME TO tasks;
+CREATE INDEX tasks_priority_id ON tasks (priority, id);
+CREATE INDEX tasks_due_date_id ON tasks (due_date, id);
+CREATE INDEX tasks_status_id ON tasks (status, id);
@@ -0,0 +1,3 @@
+-- Existing users keep creating and editing their own tasks.
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'editor'
+    CHECK (role IN ('viewer', 'editor', 'admin'));
@@ -0,0 +1,14 @@
+CREATE TABLE projects (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    owner_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at INTEGER NOT NULL,
+    UNIQUE (owner_id, name)
+);
+
+-- Deleting a project with tasks is refused here; the store deletes the
+-- tasks first when asked to cascade.
+ALTER TABLE tasks ADD COLUMN project_id INTEGER REFERENCES projects (id);
+ALTER TABLE tasks ADD COLUMN position INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX tasks_project_position_id ON tasks (project_id, position, id);
@@ -0,0 +1,32 @@
+DROP TABLE task_dependencies;
+
+-- SQLite cannot drop a column with a foreign key, so tasks is rebuilt.
+-- Dropping the old table deletes the tags of its tasks, which are put
+-- back afterwards.
+CREATE TEMP TABLE task_tags_saved AS SELECT task_id, tag_id FROM task_tags;
+CREATE TABLE tasks_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    title TEXT NOT NULL,
+    description TEXT,
+    due_date TEXT NOT NULL
+        CHECK (due_date GLOB '[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9]T[0-9][0-9]:[0-9][0-9]:[0-9][0-9]Z'),
+    due_all_day INTEGER NOT NULL DEFAULT 1 CHECK (due_all_day IN (0, 1)),
+    priority INTEGER NOT NULL CHECK (priority >= 1 AND priority <= 3),
+    status TEXT NOT NULL DEFAULT 'Pending',
+    owner_id INTEGER REFERENCES users (id) ON DELETE CASCADE,
+    project_id INTEGER REFERENCES projects (id),
+    position INTEGER NOT NULL DEFAULT 0
+);
+INSERT INTO tasks_new (id, title, description, due_date, due_all_day, priority, status, owner_id, project_id, position)
+    SELECT id, title, description, due_date, due_all_day, priority, status, owner_id, project_id, position FROM tasks;
+DELETE FROM sqlite_sequence WHERE name = 'tasks_new';
+INSERT INTO sqlite_sequence (name, seq) SELECT 'tasks_new', seq FROM sqlite_sequence WHERE name = 'tasks';
+DROP TABLE tasks;
+ALTER TABLE tasks_new RENAME TO tasks;
+CREATE INDEX tasks_priority_id ON tasks (priority, id);
+CREATE INDEX tasks_due_date_id ON tasks (due_date, id);
+CREATE INDEX tasks_status_id ON tasks (status, id);
+CREATE INDEX tasks_owner_id ON tasks (owner_id);
+CREATE INDEX tasks_project_position_id ON tasks (project_id, position, id);
+INSERT INTO task_tags (task_id, tag_id) SELECT task_id, tag_id FROM task_tags_saved;
+DROP TABLE task_tags_saved;
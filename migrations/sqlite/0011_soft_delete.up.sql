@@ -0,0 +1,4 @@
+-- Deleted tasks stay in the trash, with the unix time they were deleted
+-- at, until they are restored or purged.
+ALTER TABLE tasks ADD COLUMN deleted_at INTEGER;
+CREATE INDEX tasks_deleted_at ON tasks (deleted_at);
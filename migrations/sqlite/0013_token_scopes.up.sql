@@ -0,0 +1,3 @@
+-- Calendar tokens only read the calendar feeds, which calendar apps fetch
+-- with the token in the URL; every other token is an API token.
+ALTER TABLE api_tokens ADD COLUMN scope TEXT NOT NULL DEFAULT 'api';
@@ -0,0 +1,9 @@
+-- One row per reminder sent, so that each is sent once. A task gets new
+-- reminders when its due date moves.
+CREATE TABLE task_reminders (
+    task_id INTEGER NOT NULL REFERENCES tasks (id) ON DELETE CASCADE,
+    due_date TEXT NOT NULL,
+    threshold_seconds INTEGER NOT NULL,
+    sent_at INTEGER NOT NULL,
+    PRIMARY KEY (task_id, due_date, threshold_seconds)
+);
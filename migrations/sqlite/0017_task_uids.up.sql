@@ -0,0 +1,4 @@
+-- The UID of a task created under the uuid or ulid task ID strategy; NULL
+-- for tasks named only by their ID.
+ALTER TABLE tasks ADD COLUMN uid TEXT;
+CREATE UNIQUE INDEX tasks_uid ON tasks (uid);
@@ -0,0 +1,2 @@
+-- The ETag of the response replayed to retries, if it had one.
+ALTER TABLE idempotency_keys ADD COLUMN etag TEXT NOT NULL DEFAULT '';
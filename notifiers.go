@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Notifier delivers reminders to wherever people will see them.
+type Notifier interface {
+	Notify(ctx context.Context, rem Reminder) error
+}
+
+// newNotifiers returns the notifiers cfg.ReminderNotifiers names.
+func newNotifiers(cfg Config) []Notifier {
+	var notifiers []Notifier
+	for _, name := range cfg.ReminderNotifiers {
+		switch name {
+		case "log":
+			notifiers = append(notifiers, LogNotifier{})
+		case "webhook":
+			notifiers = append(notifiers, &WebhookNotifier{URL: cfg.ReminderWebhookURL})
+		case "smtp":
+			notifiers = append(notifiers, &SMTPNotifier{
+				Addr:     cfg.SMTPAddr,
+				Username: cfg.SMTPUsername,
+				Password: cfg.SMTPPassword,
+				From:     cfg.SMTPFrom,
+				To:       cfg.SMTPTo,
+				Location: cfg.Location,
+			})
+		}
+	}
+	return notifiers
+}
+
+// LogNotifier writes reminders to the server log.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, rem Reminder) error {
+	slog.InfoContext(ctx, "task due soon", "task_id", rem.Task.ID, "title", rem.Task.Title, "owner_id", rem.Task.OwnerID,
+		"due_date", rem.Task.DueDate, "threshold", formatThreshold(rem.Threshold))
+	return nil
+}
+
+// webhookTimeout bounds a request of WebhookNotifier without a Client.
+const webhookTimeout = 10 * time.Second
+
+// WebhookNotifier posts reminders as JSON to a URL, such as an incoming
+// webhook of a chat app. Any response but a 2xx is a failure.
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+// reminderPayload is the body WebhookNotifier posts.
+type reminderPayload struct {
+	Event            string    `json:"event"`
+	Text             string    `json:"text"`
+	Threshold        string    `json:"threshold"`
+	ThresholdSeconds int64     `json:"threshold_seconds"`
+	DueAt            time.Time `json:"due_at"`
+	Task             Task      `json:"task"`
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, rem Reminder) error {
+	body, err := json.Marshal(reminderPayload{
+		Event:            "task.due_soon",
+		Text:             rem.Subject(),
+		Threshold:        formatThreshold(rem.Threshold),
+		ThresholdSeconds: int64(rem.Threshold.Seconds()),
+		DueAt:            rem.DueAt.UTC(),
+		Task:             rem.Task,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := n.Client
+	if client == nil {
+		client = &http.Client{Timeout: webhookTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("reminder webhook: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("reminder webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// SMTPNotifier emails reminders to a fixed list of addresses.
+type SMTPNotifier struct {
+	// Addr is the host:port of the mail server. Username and Password,
+	// when set, authenticate with PLAIN, which net/smtp only sends over TLS
+	// or to localhost.
+	Addr     string
+	Username string
+	Password string
+	From     string
+	To       []string
+	// Location is the time zone of the times in emails.
+	Location *time.Location
+
+	// sendMail is smtp.SendMail; tests replace it.
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+func (n *SMTPNotifier) Notify(ctx context.Context, rem Reminder) error {
+	var auth smtp.Auth
+	if n.Username != "" {
+		host, _, _ := net.SplitHostPort(n.Addr)
+		auth = smtp.PlainAuth("", n.Username, n.Password, host)
+	}
+	send := n.sendMail
+	if send == nil {
+		send = smtp.SendMail
+	}
+	if err := send(n.Addr, auth, n.From, n.To, n.message(rem, time.Now())); err != nil {
+		return fmt.Errorf("reminder email: %w", err)
+	}
+	return nil
+}
+
+// message returns the email of a reminder sent at now.
+func (n *SMTPNotifier) message(rem Reminder, now time.Time) []byte {
+	loc := n.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", n.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(n.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", rem.Subject()))
+	fmt.Fprintf(&b, "Date: %s\r\n", now.In(loc).Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(rem.Text(loc), "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// The retries of a webhook delivery wait webhookRetryDelay, then twice as
+// long each time up to webhookMaxRetryDelay. A delivery fails for good
+// after webhookMaxAttempts attempts, about 15 hours after the first.
+const (
+	webhookRetryDelay    = 30 * time.Second
+	webhookMaxRetryDelay = 6 * time.Hour
+	webhookMaxAttempts   = 12
+)
+
+// webhookBatchSize is how many deliveries WebhookDispatcher claims at a
+// time, and webhookLease how long it holds them: long enough to send a
+// whole batch to webhooks that time out.
+const (
+	webhookBatchSize = 20
+	webhookLease     = 5 * time.Minute
+)
+
+// webhookEvent is the body of a webhook delivery. ID is the ID of the
+// history entry of the change, the same for every webhook it goes to.
+type webhookEvent struct {
+	ID      int           `json:"id"`
+	Event   string        `json:"event"`
+	At      time.Time     `json:"at"`
+	ActorID int           `json:"actor_id,omitempty"`
+	Task    Task          `json:"task"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// eventName returns the webhook event of the change entry records.
+// Restoring a task from the trash is an update.
+func eventName(entry HistoryEntry) string {
+	switch entry.Action {
+	case HistoryCreate:
+		return EventTaskCreated
+	case HistoryDelete:
+		return EventTaskDeleted
+	}
+	completed, _ := json.Marshal(StatusCompleted)
+	for _, change := range entry.Changes {
+		if change.Field == "status" && bytes.Equal(change.New, completed) {
+			return EventTaskCompleted
+		}
+	}
+	return EventTaskUpdated
+}
+
+// newDelivery returns the pending delivery of the change entry records,
+// which left the task as task, to the webhook hookID.
+func newDelivery(hookID int, entry HistoryEntry, task Task) WebhookDelivery {
+	event := eventName(entry)
+	// Tasks and history entries always marshal.
+	payload, _ := json.Marshal(webhookEvent{
+		ID:      entry.ID,
+		Event:   event,
+		At:      entry.At.UTC(),
+		ActorID: entry.ActorID,
+		Task:    task,
+		Changes: entry.Changes,
+	})
+	return WebhookDelivery{
+		WebhookID:     hookID,
+		Event:         event,
+		TaskID:        task.ID,
+		Payload:       payload,
+		Status:        DeliveryPending,
+		NextAttemptAt: &entry.At,
+		CreatedAt:     entry.At,
+	}
+}
+
+// webhookBackoff returns how long to wait after the given number of failed
+// attempts.
+func webhookBackoff(attempts int) time.Duration {
+	delay := webhookRetryDelay
+	for i := 1; i < attempts && delay < webhookMaxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, webhookMaxRetryDelay)
+}
+
+// signWebhook returns the hex HMAC-SHA256, keyed with secret, of the
+// timestamp, a dot and the body. Receivers compute the same to check the
+// Calidad-Signature header.
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookDispatcher sends the deliveries queued in the outbox and retries
+// those that fail with exponential backoff. Deliveries are sent at least
+// once: one whose outcome could not be recorded is sent again.
+type WebhookDispatcher struct {
+	Store Store
+	// Client sends the deliveries. The default one times out after
+	// webhookTimeout, does not follow redirects and refuses to connect to
+	// addresses webhooks may not be sent to, whatever the host of a webhook
+	// resolves to by the time a delivery is sent.
+	Client *http.Client
+	// AllowPrivate lets the default Client connect to loopback, private
+	// and link-local addresses.
+	AllowPrivate bool
+}
+
+// Deliver sends the deliveries that are due at now.
+func (d *WebhookDispatcher) Deliver(ctx context.Context, now time.Time) error {
+	client := d.Client
+	if client == nil {
+		dialer := &net.Dialer{Timeout: webhookTimeout}
+		if !d.AllowPrivate {
+			dialer.Control = checkWebhookDial
+		}
+		transport := &http.Transport{DialContext: dialer.DialContext}
+		defer transport.CloseIdleConnections()
+		client = &http.Client{
+			Transport:     transport,
+			Timeout:       webhookTimeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		}
+	}
+
+	hooks := make(map[int]Webhook)
+	var errs []error
+	for {
+		deliveries, err := d.Store.ClaimWebhookDeliveries(now, webhookLease, webhookBatchSize)
+		if err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		for _, delivery := range deliveries {
+			hook, ok := hooks[delivery.WebhookID]
+			if !ok {
+				hook, err = d.Store.GetWebhook(delivery.WebhookID)
+				if errors.Is(err, ErrWebhookNotFound) {
+					// Deleted, along with the delivery, since it was claimed.
+					continue
+				} else if err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				hooks[hook.ID] = hook
+			}
+			delivery = d.send(ctx, client, hook, delivery, now)
+			if err := d.Store.RecordWebhookAttempt(delivery); err != nil {
+				errs = append(errs, fmt.Errorf("delivery %d: %w", delivery.ID, err))
+			}
+		}
+		if len(deliveries) < webhookBatchSize {
+			break
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkWebhookDial is the net.Dialer Control of deliveries. It sees the
+// address about to be connected to, after name resolution.
+func checkWebhookDial(network, address string, _ syscall.RawConn) error {
+	addr, err := netip.ParseAddrPort(address)
+	if err != nil || !webhookAddrAllowed(addr.Addr()) {
+		return fmt.Errorf("%s: %w", address, errWebhookTarget)
+	}
+	return nil
+}
+
+// send makes one attempt at a delivery and returns it with the outcome.
+// Deliveries to webhooks that were deactivated since they were queued fail
+// without being sent.
+func (d *WebhookDispatcher) send(ctx context.Context, client *http.Client, hook Webhook, delivery WebhookDelivery, now time.Time) WebhookDelivery {
+	delivery.NextAttemptAt = nil
+	if !hook.Active {
+		delivery.Status = DeliveryFailed
+		delivery.Error = "webhook is inactive"
+		return delivery
+	}
+
+	delivery.Attempts++
+	delivery.ResponseCode, delivery.Error = 0, ""
+	code, err := postDelivery(ctx, client, hook, delivery)
+	delivery.ResponseCode = code
+	switch {
+	case err == nil:
+		delivery.Status = DeliveryDelivered
+		delivery.DeliveredAt = &now
+	case delivery.Attempts >= webhookMaxAttempts:
+		delivery.Status = DeliveryFailed
+		delivery.Error = err.Error()
+		slog.WarnContext(ctx, "webhook delivery failed", "webhook_id", hook.ID, "delivery_id", delivery.ID,
+			"attempts", delivery.Attempts, "error", err)
+	default:
+		next := now.Add(webhookBackoff(delivery.Attempts))
+		delivery.NextAttemptAt = &next
+		delivery.Error = err.Error()
+	}
+	return delivery
+}
+
+// postDelivery sends a delivery to its webhook, signed with the secret of the
+// webhook, and returns the status code of the response. Any response but a
+// 2xx is an error.
+func postDelivery(ctx context.Context, client *http.Client, hook Webhook, delivery WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Calidad-Event", delivery.Event)
+	req.Header.Set("Calidad-Delivery", strconv.Itoa(delivery.ID))
+	req.Header.Set("Calidad-Timestamp", timestamp)
+	req.Header.Set("Calidad-Signature", "sha256="+signWebhook(hook.Secret, timestamp, delivery.Payload))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	// Drain a little of the body so the connection can be reused.
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// projectNotFound rejects a project_id that names no project the user can
+// see.
+var projectNotFound = FieldError{Field: "project_id", Message: "project not found"}
+
+func writeProjectNotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusNotFound, "project_not_found", "project not found")
+}
+
+// validateProject checks that the calling user may file tasks under the
+// project with the given ID. Zero means no project.
+func (app *App) validateProject(r *http.Request, id int) ([]FieldError, error) {
+	if id == 0 {
+		return nil, nil
+	}
+	project, err := app.Store.GetProject(id)
+	if err == nil {
+		err = app.authorizer().AuthorizeProject(currentUser(r.Context()), ActionRead, project)
+	}
+	if errors.Is(err, ErrProjectNotFound) || errors.Is(err, ErrForbidden) {
+		return []FieldError{projectNotFound}, nil
+	}
+	return nil, err
+}
+
+func validateProjectFields(project Project) []FieldError {
+	if strings.TrimSpace(project.Name) == "" {
+		return []FieldError{{Field: "name", Message: "name is required"}}
+	}
+	return nil
+}
+
+// loadProject fetches the project named by the {id} path parameter,
+// answering with a problem when that fails. Projects the calling user may
+// not read are reported as not found.
+func (app *App) loadProject(w http.ResponseWriter, r *http.Request) (Project, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_project_id", "project ID must be a number")
+		return Project{}, false
+	}
+	project, err := app.Store.GetProject(id)
+	if err == nil {
+		err = app.authorizer().AuthorizeProject(currentUser(r.Context()), ActionRead, project)
+		if errors.Is(err, ErrForbidden) {
+			err = ErrProjectNotFound
+		}
+	}
+	if errors.Is(err, ErrProjectNotFound) {
+		writeProjectNotFound(w, r)
+		return Project{}, false
+	} else if err != nil {
+		writeServerError(w, r, "Failed to fetch project", err)
+		return Project{}, false
+	}
+	return project, true
+}
+
+// getProjects handles GET /projects, listing the projects the calling user
+// may read.
+func (app *App) getProjects(w http.ResponseWriter, r *http.Request) {
+	projects, err := app.Store.ListProjects()
+	if err != nil {
+		writeServerError(w, r, "Failed to fetch projects", err)
+		return
+	}
+	user := currentUser(r.Context())
+	visible := []Project{}
+	for _, project := range projects {
+		if app.authorizer().AuthorizeProject(user, ActionRead, project) == nil {
+			visible = append(visible, project)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(visible)
+}
+
+func (app *App) createProject(w http.ResponseWriter, r *http.Request) {
+	var project Project
+	if err := json.NewDecoder(r.Body).Decode(&project); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "request body must be a JSON object")
+		return
+	}
+	project.ID = 0
+	project.OwnerID = currentUser(r.Context()).ID
+	project.CreatedAt = time.Now()
+	if !app.authorizeProject(w, r, ActionCreate, project) {
+		return
+	}
+	if errs := validateProjectFields(project); len(errs) > 0 {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	created, err := app.Store.CreateProject(project)
+	if errors.Is(err, ErrProjectExists) {
+		writeError(w, r, http.StatusConflict, "project_exists", fmt.Sprintf("you already have a project named %q", project.Name))
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Failed to create project", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", fmt.Sprintf("/projects/%d", created.ID))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (app *App) getProject(w http.ResponseWriter, r *http.Request) {
+	project, ok := app.loadProject(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(project)
+}
+
+// updateProject handles PUT and PATCH /projects/{id}. Only the name and
+// description can change; PATCH leaves out members untouched.
+func (app *App) updateProject(w http.ResponseWriter, r *http.Request) {
+	project, ok := app.loadProject(w, r)
+	if !ok || !app.authorizeProject(w, r, ActionUpdate, project) {
+		return
+	}
+
+	var body struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "request body must be a JSON object")
+		return
+	}
+	if body.Name != nil || r.Method == http.MethodPut {
+		project.Name = ""
+		if body.Name != nil {
+			project.Name = *body.Name
+		}
+	}
+	if body.Description != nil || r.Method == http.MethodPut {
+		project.Description = ""
+		if body.Description != nil {
+			project.Description = *body.Description
+		}
+	}
+	if errs := validateProjectFields(project); len(errs) > 0 {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	updated, err := app.Store.UpdateProject(project)
+	if errors.Is(err, ErrProjectExists) {
+		writeError(w, r, http.StatusConflict, "project_exists", fmt.Sprintf("a project named %q already exists", project.Name))
+		return
+	} else if errors.Is(err, ErrProjectNotFound) {
+		writeProjectNotFound(w, r)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Failed to update project", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// deleteProject handles DELETE /projects/{id}. A project that still has
+// tasks is only deleted with ?cascade=true, which moves its tasks to the
+// trash.
+func (app *App) deleteProject(w http.ResponseWriter, r *http.Request) {
+	project, ok := app.loadProject(w, r)
+	if !ok || !app.authorizeProject(w, r, ActionDelete, project) {
+		return
+	}
+	cascade := false
+	if v := r.URL.Query().Get("cascade"); v != "" {
+		var err error
+		if cascade, err = strconv.ParseBool(v); err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid_query", "cascade must be true or false")
+			return
+		}
+	}
+
+	err := app.Store.DeleteProject(project.ID, cascade, currentUser(r.Context()).ID)
+	if errors.Is(err, ErrProjectNotEmpty) {
+		writeError(w, r, http.StatusConflict, "project_not_empty", "the project still has tasks; move them or delete with ?cascade=true")
+		return
+	} else if errors.Is(err, ErrProjectNotFound) {
+		writeProjectNotFound(w, r)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Failed to delete project", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": fmt.Sprintf("Project with ID %d deleted successfully", project.ID)})
+}
+
+// getProjectTasks handles GET /projects/{id}/tasks. It takes the filters of
+// GET /tasks and orders the tasks by position unless sort_by says
+// otherwise.
+func (app *App) getProjectTasks(w http.ResponseWriter, r *http.Request) {
+	project, ok := app.loadProject(w, r)
+	if !ok {
+		return
+	}
+	query, err := parseTaskQuery(r.URL.Query(), app.location(), time.Now())
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_query", err.Error())
+		return
+	}
+	query.ProjectID = project.ID
+	if len(query.Sort) == 0 {
+		query.Sort = []SortKey{{Field: "position"}}
+	}
+	app.writeTaskPage(w, r, query)
+}
+
+// createProjectTask handles POST /projects/{id}/tasks, creating a task in
+// the project.
+func (app *App) createProjectTask(w http.ResponseWriter, r *http.Request) {
+	project, ok := app.loadProject(w, r)
+	if !ok {
+		return
+	}
+	var task Task
+	if err := json.NewDecoder(r.Body).Decode(&task); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "request body must be a JSON object")
+		return
+	}
+
+	var errs []FieldError
+	if task.ProjectID != 0 && task.ProjectID != project.ID {
+		errs = append(errs, FieldError{Field: "project_id", Message: "project_id does not match the project in the path"})
+	}
+	task.ProjectID = project.ID
+	app.insertTask(w, r, task, errs)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// createProjectInStore stores a project owned by the test user unless it
+// names another owner.
+func createProjectInStore(t *testing.T, store Store, project Project) int {
+	t.Helper()
+	if project.OwnerID == 0 {
+		project.OwnerID = testUser(t, store).ID
+	}
+	created, err := store.CreateProject(project)
+	if err != nil {
+		t.Fatalf("CreateProject returned error: %v", err)
+	}
+	return created.ID
+}
+
+func TestProjectCRUD(t *testing.T) {
+	store := newTestStore(t)
+	handler := NewRouter(&App{Store: store})
+
+	rr := executeRequest(httptest.NewRequest(http.MethodPost, "/projects", strings.NewReader(`{"name": "Backend", "description": "API work"}`)), handler)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("POST /projects returned %v want %v: %s", rr.Code, http.StatusCreated, rr.Body.String())
+	}
+	var project Project
+	json.Unmarshal(rr.Body.Bytes(), &project)
+	path := fmt.Sprintf("/projects/%d", project.ID)
+	if rr.Header().Get("Location") != path || project.Name != "Backend" || project.OwnerID != testUser(t, store).ID {
+		t.Errorf("Created project %s at %q", rr.Body.String(), rr.Header().Get("Location"))
+	}
+
+	assertProblem(t, executeRequest(httptest.NewRequest(http.MethodPost, "/projects", strings.NewReader(`{"name": "Backend"}`)), handler),
+		http.StatusConflict, "project_exists")
+	assertProblem(t, executeRequest(httptest.NewRequest(http.MethodPost, "/projects", strings.NewReader(`{"name": " "}`)), handler),
+		http.StatusUnprocessableEntity, "validation_failed")
+
+	rr = executeRequest(httptest.NewRequest(http.MethodPatch, path, strings.NewReader(`{"name": "Platform"}`)), handler)
+	json.Unmarshal(rr.Body.Bytes(), &project)
+	if rr.Code != http.StatusOK || project.Name != "Platform" || project.Description != "API work" {
+		t.Errorf("PATCH %s returned %v %s, want the name changed and the description kept", path, rr.Code, rr.Body.String())
+	}
+	rr = executeRequest(httptest.NewRequest(http.MethodPut, path, strings.NewReader(`{"name": "Platform"}`)), handler)
+	json.Unmarshal(rr.Body.Bytes(), &project)
+	if rr.Code != http.StatusOK || project.Description != "" {
+		t.Errorf("PUT %s returned %v %s, want the description cleared", path, rr.Code, rr.Body.String())
+	}
+
+	rr = executeRequest(httptest.NewRequest(http.MethodGet, "/projects", nil), handler)
+	var projects []Project
+	json.Unmarshal(rr.Body.Bytes(), &projects)
+	if len(projects) != 1 || projects[0].Name != "Platform" {
+		t.Errorf("GET /projects returned %s, want the one project", rr.Body.String())
+	}
+
+	if rr := executeRequest(httptest.NewRequest(http.MethodDelete, path, nil), handler); rr.Code != http.StatusOK {
+		t.Errorf("DELETE %s returned %v want %v", path, rr.Code, http.StatusOK)
+	}
+	assertProblem(t, executeRequest(httptest.NewRequest(http.MethodGet, path, nil), handler), http.StatusNotFound, "project_not_found")
+}
+
+func TestProjectTasks(t *testing.T) {
+	store := newTestStore(t)
+	handler := NewRouter(&App{Store: store})
+
+	board := createProjectInStore(t, store, Project{Name: "Board"})
+	other := createProjectInStore(t, store, Project{Name: "Other"})
+	tasksPath := fmt.Sprintf("/projects/%d/tasks", board)
+
+	var ids []int
+	for _, title := range []string{"First", "Second", "Third"} {
+		body := fmt.Sprintf(`{"title": %q, "due_date": "2024-12-01", "priority": 3}`, title)
+		rr := executeRequest(httptest.NewRequest(http.MethodPost, tasksPath, strings.NewReader(body)), handler)
+		var task Task
+		json.Unmarshal(rr.Body.Bytes(), &task)
+		if rr.Code != http.StatusCreated || task.ProjectID != board || task.Position != len(ids)+1 {
+			t.Fatalf("POST %s returned %v %s, want position %d", tasksPath, rr.Code, rr.Body.String(), len(ids)+1)
+		}
+		ids = append(ids, task.ID)
+	}
+	createTaskInStore(t, store, Task{Title: "Elsewhere", DueDate: "2024-12-01", Priority: 1, ProjectID: other})
+	createTaskInStore(t, store, Task{Title: "Loose", DueDate: "2024-12-01", Priority: 1})
+
+	listTitles := func(path string) []string {
+		t.Helper()
+		rr := executeRequest(httptest.NewRequest(http.MethodGet, path, nil), handler)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("GET %s returned %v: %s", path, rr.Code, rr.Body.String())
+		}
+		var tasks []Task
+		json.Unmarshal(rr.Body.Bytes(), &tasks)
+		titles := make([]string, len(tasks))
+		for i, task := range tasks {
+			titles[i] = task.Title
+		}
+		return titles
+	}
+
+	// Move the first task to the end of the board.
+	patch := `{"position": 10}`
+	if rr := executeRequest(httptest.NewRequest(http.MethodPatch, fmt.Sprintf("/tasks/%d", ids[0]), strings.NewReader(patch)), handler); rr.Code != http.StatusOK {
+		t.Fatalf("PATCH position returned %v: %s", rr.Code, rr.Body.String())
+	}
+	if got := strings.Join(listTitles(tasksPath), ","); got != "Second,Third,First" {
+		t.Errorf("Project tasks are in order %s, want Second,Third,First", got)
+	}
+	if got := strings.Join(listTitles(tasksPath+"?sort_by=title&limit=1"), ","); got != "First" {
+		t.Errorf("Sorted project tasks start with %s, want First", got)
+	}
+	if got := listTitles(fmt.Sprintf("/tasks?project_id=%d", other)); len(got) != 1 || got[0] != "Elsewhere" {
+		t.Errorf("GET /tasks?project_id=%d returned %v, want Elsewhere", other, got)
+	}
+
+	// Moving a task to another project appends it there.
+	rr := executeRequest(httptest.NewRequest(http.MethodPatch, fmt.Sprintf("/tasks/%d", ids[1]), strings.NewReader(fmt.Sprintf(`{"project_id": %d}`, other))), handler)
+	var moved Task
+	json.Unmarshal(rr.Body.Bytes(), &moved)
+	if rr.Code != http.StatusOK || moved.ProjectID != other || moved.Position != 2 {
+		t.Errorf("Moving a task returned %v %s, want position 2 in project %d", rr.Code, rr.Body.String(), other)
+	}
+
+	for _, body := range []string{
+		`{"title": "Lost", "due_date": "2024-12-01", "priority": 1, "project_id": 999}`,
+		`{"title": "Loose", "due_date": "2024-12-01", "priority": 1, "position": 3}`,
+	} {
+		assertProblem(t, executeRequest(httptest.NewRequest(http.MethodPost, "/tasks", strings.NewReader(body)), handler),
+			http.StatusUnprocessableEntity, "validation_failed")
+	}
+}
+
+func TestDeleteProjectBlocksOrCascades(t *testing.T) {
+	store := newTestStore(t)
+	handler := NewRouter(&App{Store: store})
+
+	project := createProjectInStore(t, store, Project{Name: "Doomed"})
+	task := createTaskInStore(t, store, Task{Title: "Inside", DueDate: "2024-12-01", Priority: 1, ProjectID: project})
+	path := fmt.Sprintf("/projects/%d", project)
+
+	assertProblem(t, executeRequest(httptest.NewRequest(http.MethodDelete, path, nil), handler), http.StatusConflict, "project_not_empty")
+	if _, err := store.Get(task); err != nil {
+		t.Fatalf("Blocked delete lost the task: %v", err)
+	}
+
+	if rr := executeRequest(httptest.NewRequest(http.MethodDelete, path+"?cascade=true", nil), handler); rr.Code != http.StatusOK {
+		t.Fatalf("Cascading delete returned %v: %s", rr.Code, rr.Body.String())
+	}
+	// The task goes to the trash without the project, and comes back from
+	// it like any other.
+	if got, err := store.Get(task); err != nil || got.DeletedAt == nil || got.ProjectID != 0 {
+		t.Fatalf("Task after a cascading delete = %+v, %v; want it in the trash without a project", got, err)
+	}
+	rr := executeRequest(httptest.NewRequest(http.MethodPost, fmt.Sprintf("/tasks/%d/restore", task), nil), handler)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Restoring a task of the deleted project returned %v: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestDeleteProjectIgnoresTrash(t *testing.T) {
+	store := newTestStore(t)
+	handler := NewRouter(&App{Store: store})
+
+	project := createProjectInStore(t, store, Project{Name: "Emptied"})
+	task := createTaskInStore(t, store, Task{Title: "Inside", DueDate: "2024-12-01", Priority: 1, ProjectID: project})
+	if err := store.Delete(task, 0, 0); err != nil {
+		t.Fatalf("Delete returned error: %v", err)
+	}
+
+	path := fmt.Sprintf("/projects/%d", project)
+	if rr := executeRequest(httptest.NewRequest(http.MethodDelete, path, nil), handler); rr.Code != http.StatusOK {
+		t.Fatalf("Deleting a project with only deleted tasks returned %v: %s", rr.Code, rr.Body.String())
+	}
+	if got, err := store.Get(task); err != nil || got.DeletedAt == nil || got.ProjectID != 0 {
+		t.Errorf("Deleted task after deleting the project = %+v, %v; want it in the trash without a project", got, err)
+	}
+}
+
+func TestProjectsAreScopedByRole(t *testing.T) {
+	store := newTestStore(t)
+	handler := NewRouter(&App{Store: store})
+
+	_, viewer := addTestUser(t, store, "vera", RoleViewer)
+	_, admin := addTestUser(t, store, "ada", RoleAdmin)
+	project := createProjectInStore(t, store, Project{Name: "Mine"})
+	path := fmt.Sprintf("/projects/%d", project)
+
+	as := func(token string, req *http.Request) *httptest.ResponseRecorder {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return executeRequest(req, handler)
+	}
+
+	assertProblem(t, as(viewer, httptest.NewRequest(http.MethodGet, path, nil)), http.StatusNotFound, "project_not_found")
+	assertProblem(t, as(viewer, httptest.NewRequest(http.MethodPost, "/projects", strings.NewReader(`{"name": "Mine"}`))), http.StatusForbidden, "forbidden")
+	body := `{"title": "Sneaky", "due_date": "2024-12-01", "priority": 1}`
+	assertProblem(t, as(viewer, httptest.NewRequest(http.MethodPost, path+"/tasks", strings.NewReader(body))), http.StatusNotFound, "project_not_found")
+
+	if rr := as(admin, httptest.NewRequest(http.MethodPatch, path, strings.NewReader(`{"name": "Renamed"}`))); rr.Code != http.StatusOK {
+		t.Errorf("Admin PATCH of another user's project returned %v: %s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultPageSize is how many tasks GET /tasks returns without a limit
+	// parameter; maxPageSize is the largest limit accepted.
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// sortableFields are the task fields GET /tasks can be ordered by.
+var sortableFields = map[string]bool{
+	"id":       true,
+	"title":    true,
+	"due_date": true,
+	"priority": true,
+	"status":   true,
+	"position": true,
+}
+
+// listCursor is the position a next link continues from. It remembers the
+// sort it was made for, because keyset positions are meaningless in any
+// other order.
+type listCursor struct {
+	Sort  string `json:"sort"`
+	After Task   `json:"after"`
+}
+
+func encodeCursor(c listCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (listCursor, error) {
+	var c listCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(data, &c)
+	}
+	return c, err
+}
+
+// listValues splits repeated and comma-separated values of a query
+// parameter, so ?status=a,b and ?status=a&status=b mean the same.
+func listValues(values url.Values, name string) []string {
+	var out []string
+	for _, v := range values[name] {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				out = append(out, part)
+			}
+		}
+	}
+	return out
+}
+
+// parseSort parses sort_by, a comma-separated list of fields where a leading
+// "-" sorts that field in descending order, e.g. "due_date,-priority".
+func parseSort(spec string) ([]SortKey, error) {
+	var keys []SortKey
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key := SortKey{Field: strings.TrimPrefix(part, "-"), Desc: strings.HasPrefix(part, "-")}
+		if !sortableFields[key.Field] {
+			return nil, fmt.Errorf("cannot sort by %q", key.Field)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// parseTaskQuery turns the query string of GET /tasks into a TaskQuery.
+// Limit is set to the page size the caller asked for. Dates in due_from,
+// due_before and due_to start at midnight in loc, and overdue=true selects
+// unfinished tasks that were due before now. Tasks with any of the tag
+// parameters are kept, or with all of them when tag_match=all. Tasks in the
+// trash are listed instead of the others with deleted=true.
+func parseTaskQuery(values url.Values, loc *time.Location, now time.Time) (TaskQuery, error) {
+	q := TaskQuery{
+		Statuses: listValues(values, "status"),
+		Search:   strings.TrimSpace(values.Get("q")),
+		Limit:    defaultPageSize,
+	}
+
+	for _, p := range listValues(values, "priority") {
+		priority, err := strconv.Atoi(p)
+		if err != nil || priority < 1 || priority > 3 {
+			return TaskQuery{}, fmt.Errorf("priority must be between 1 and 3, got %q", p)
+		}
+		q.Priorities = append(q.Priorities, priority)
+	}
+
+	if v := values.Get("due_from"); v != "" {
+		bound, err := parseDueBound(v, loc)
+		if err != nil {
+			return TaskQuery{}, fmt.Errorf("due_from must be a date (YYYY-MM-DD) or an RFC 3339 timestamp")
+		}
+		q.DueFrom = &bound
+	}
+	if v := values.Get("due_before"); v != "" {
+		bound, err := parseDueBound(v, loc)
+		if err != nil {
+			return TaskQuery{}, fmt.Errorf("due_before must be a date (YYYY-MM-DD) or an RFC 3339 timestamp")
+		}
+		q.DueBefore = &bound
+	}
+	if v := values.Get("due_to"); v != "" {
+		day, err := time.Parse(dueDateLayout, v)
+		if err != nil {
+			return TaskQuery{}, fmt.Errorf("due_to must be a date in YYYY-MM-DD format")
+		}
+		bound := dueBoundOn(day.AddDate(0, 0, 1), loc)
+		q.DueBefore = earlierBound(q.DueBefore, &bound)
+	}
+	if v := values.Get("overdue"); v != "" {
+		overdue, err := strconv.ParseBool(v)
+		if err != nil {
+			return TaskQuery{}, fmt.Errorf("overdue must be true or false")
+		}
+		if overdue {
+			bound := dueBoundAt(now, loc)
+			q.DueBefore = earlierBound(q.DueBefore, &bound)
+			q.ExcludeStatuses = append(q.ExcludeStatuses, StatusCompleted)
+		}
+	}
+
+	if v := values.Get("project_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id < 1 {
+			return TaskQuery{}, fmt.Errorf("project_id must be a project ID, got %q", v)
+		}
+		q.ProjectID = id
+	}
+
+	if v := values.Get("deleted"); v != "" {
+		deleted, err := strconv.ParseBool(v)
+		if err != nil {
+			return TaskQuery{}, fmt.Errorf("deleted must be true or false")
+		}
+		q.Deleted = deleted
+	}
+
+	q.Tags = normalizeTags(listValues(values, "tag"))
+	switch match := values.Get("tag_match"); match {
+	case "", "any":
+	case "all":
+		q.AllTags = true
+	default:
+		return TaskQuery{}, fmt.Errorf("tag_match must be any or all, got %q", match)
+	}
+
+	sortSpec := values.Get("sort_by")
+	sort, err := parseSort(sortSpec)
+	if err != nil {
+		return TaskQuery{}, err
+	}
+	q.Sort = sort
+
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return TaskQuery{}, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+		q.Limit = limit
+	}
+
+	if v := values.Get("cursor"); v != "" {
+		cursor, err := decodeCursor(v)
+		if err != nil {
+			return TaskQuery{}, fmt.Errorf("invalid cursor")
+		}
+		if cursor.Sort != sortSpec {
+			return TaskQuery{}, fmt.Errorf("cursor was issued for a different sort_by")
+		}
+		q.After = &cursor.After
+	}
+	return q, nil
+}
+
+// nextPageURL returns the URL of the page after last, keeping every other
+// parameter of the current request.
+func nextPageURL(u *url.URL, last Task) string {
+	values := u.Query()
+	// Not sort keys; leaving them out keeps links short.
+	last.Description = ""
+	last.Tags = nil
+	last.DeletedAt = nil
+	last.Version = 0
+	last.Recurrence = ""
+	values.Set("cursor", encodeCursor(listCursor{Sort: values.Get("sort_by"), After: last}))
+	next := url.URL{Path: u.Path, RawQuery: values.Encode()}
+	return next.String()
+}
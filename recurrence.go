@@ -0,0 +1,244 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The frequencies a recurrence rule can have.
+const (
+	FreqDaily   = "DAILY"
+	FreqWeekly  = "WEEKLY"
+	FreqMonthly = "MONTHLY"
+)
+
+// The forms of the UNTIL part of a rule: a date, or a time in UTC.
+const (
+	untilDateLayout = "20060102"
+	untilTimeLayout = "20060102T150405Z"
+)
+
+// Recurrence is a parsed repeat rule, the subset of the RRULE of RFC 5545
+// that tasks support: FREQ=DAILY, WEEKLY or MONTHLY, INTERVAL, either COUNT
+// or UNTIL, and BYMONTHDAY for monthly rules. Tasks carry it in the
+// canonical form String returns.
+type Recurrence struct {
+	Freq     string
+	Interval int
+	// Count is how many occurrences are left, counting the task that has
+	// the rule. Zero means no limit.
+	Count int
+	// Until is the last day occurrences may fall on, as midnight UTC, when
+	// UntilDay is set, and otherwise the last instant. The zero time means
+	// no limit.
+	Until    time.Time
+	UntilDay bool
+	// MonthDay is the day of the month monthly occurrences fall on. In
+	// shorter months they fall on the last day instead.
+	MonthDay int
+}
+
+// parseRecurrence reads a rule such as "FREQ=WEEKLY;INTERVAL=2;COUNT=4",
+// optionally prefixed with "RRULE:". Names and values are not case
+// sensitive.
+func parseRecurrence(s string) (Recurrence, error) {
+	rule := Recurrence{Interval: 1}
+	s = strings.TrimSpace(s)
+	if len(s) >= 6 && strings.EqualFold(s[:6], "RRULE:") {
+		s = s[6:]
+	}
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(strings.ToUpper(strings.TrimSpace(part)), "=")
+		if !ok || value == "" {
+			return Recurrence{}, fmt.Errorf("recurrence part %q must be NAME=VALUE", part)
+		}
+		if seen[name] {
+			return Recurrence{}, fmt.Errorf("recurrence has %s twice", name)
+		}
+		seen[name] = true
+
+		var err error
+		switch name {
+		case "FREQ":
+			rule.Freq = value
+			if value != FreqDaily && value != FreqWeekly && value != FreqMonthly {
+				err = errors.New("FREQ must be DAILY, WEEKLY or MONTHLY")
+			}
+		case "INTERVAL":
+			rule.Interval, err = ruleNumber(name, value, 1000)
+		case "COUNT":
+			rule.Count, err = ruleNumber(name, value, 1000)
+		case "BYMONTHDAY":
+			rule.MonthDay, err = ruleNumber(name, value, 31)
+		case "UNTIL":
+			if rule.Until, err = time.Parse(untilDateLayout, value); err == nil {
+				rule.UntilDay = true
+			} else if rule.Until, err = time.Parse(untilTimeLayout, value); err != nil {
+				err = errors.New("UNTIL must be a date (YYYYMMDD) or a UTC time (YYYYMMDDTHHMMSSZ)")
+			}
+		default:
+			err = fmt.Errorf("recurrence part %s is not supported", name)
+		}
+		if err != nil {
+			return Recurrence{}, err
+		}
+	}
+
+	switch {
+	case rule.Freq == "":
+		return Recurrence{}, errors.New("recurrence must have a FREQ")
+	case rule.Count != 0 && !rule.Until.IsZero():
+		return Recurrence{}, errors.New("recurrence can have COUNT or UNTIL, not both")
+	case rule.MonthDay != 0 && rule.Freq != FreqMonthly:
+		return Recurrence{}, errors.New("BYMONTHDAY only applies to MONTHLY recurrences")
+	}
+	return rule, nil
+}
+
+// ruleNumber parses the value of a numeric rule part, between 1 and max.
+func ruleNumber(name, value string, max int) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > max {
+		return 0, fmt.Errorf("%s must be between 1 and %d", name, max)
+	}
+	return n, nil
+}
+
+// String returns the canonical form of the rule.
+func (rule Recurrence) String() string {
+	parts := []string{"FREQ=" + rule.Freq}
+	if rule.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(rule.Interval))
+	}
+	if rule.MonthDay != 0 {
+		parts = append(parts, "BYMONTHDAY="+strconv.Itoa(rule.MonthDay))
+	}
+	if rule.Count != 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(rule.Count))
+	}
+	if rule.UntilDay {
+		parts = append(parts, "UNTIL="+rule.Until.Format(untilDateLayout))
+	} else if !rule.Until.IsZero() {
+		parts = append(parts, "UNTIL="+rule.Until.UTC().Format(untilTimeLayout))
+	}
+	return strings.Join(parts, ";")
+}
+
+// normalizeRecurrence rewrites a rule into canonical form. Monthly rules
+// get the day of the month of due, so that an occurrence pushed to the end
+// of a short month does not drag the ones after it along. current is the
+// stored task an update replaces, or the zero Task for a new one: when the
+// update moves the due date, a day of the month the rule kept from current
+// follows the new due date, while one the update sets is left alone. Rules
+// it cannot parse are returned unchanged, for validateTask to reject.
+func normalizeRecurrence(s, due string, current Task, loc *time.Location) string {
+	if s == "" {
+		return ""
+	}
+	rule, err := parseRecurrence(s)
+	if err != nil {
+		return s
+	}
+	if rule.Freq == FreqMonthly && (rule.MonthDay == 0 || due != current.DueDate && rule.MonthDay == monthDay(current.Recurrence)) {
+		if t, allDay, err := parseDueDate(due, time.UTC); err == nil {
+			if !allDay {
+				t = t.In(loc)
+			}
+			rule.MonthDay = t.Day()
+		}
+	}
+	return rule.String()
+}
+
+// monthDay returns the BYMONTHDAY of a monthly rule, or 0.
+func monthDay(s string) int {
+	rule, err := parseRecurrence(s)
+	if err != nil || rule.Freq != FreqMonthly {
+		return 0
+	}
+	return rule.MonthDay
+}
+
+// next returns the due date of the occurrence after one due at due, and
+// false when the rule has none. Times of day are kept on the wall clock of
+// loc, so that a task due at 09:00 stays at 09:00 across daylight saving
+// changes.
+func (rule Recurrence) next(due string, loc *time.Location) (string, bool) {
+	if rule.Count == 1 {
+		return "", false
+	}
+	t, allDay, err := parseDueDate(due, time.UTC)
+	if err != nil {
+		return "", false
+	}
+	if !allDay {
+		t = t.In(loc)
+	}
+
+	switch rule.Freq {
+	case FreqDaily:
+		t = t.AddDate(0, 0, rule.Interval)
+	case FreqWeekly:
+		t = t.AddDate(0, 0, 7*rule.Interval)
+	case FreqMonthly:
+		day := rule.MonthDay
+		if day == 0 {
+			day = t.Day()
+		}
+		y, m, _ := t.Date()
+		m += time.Month(rule.Interval)
+		// Day zero of the month after is the last day of m.
+		day = min(day, time.Date(y, m+1, 0, 0, 0, 0, 0, time.UTC).Day())
+		t = time.Date(y, m, day, t.Hour(), t.Minute(), t.Second(), 0, t.Location())
+	}
+
+	if !rule.Until.IsZero() {
+		last := t
+		switch {
+		case rule.UntilDay && !allDay:
+			y, m, d := t.Date()
+			last = time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+		case !rule.UntilDay && allDay:
+			y, m, d := t.Date()
+			last = time.Date(y, m, d, 0, 0, 0, 0, loc)
+		}
+		if last.After(rule.Until) {
+			return "", false
+		}
+	}
+	return formatDueDate(t, allDay), true
+}
+
+// nextOccurrence returns the task that follows task, which is being
+// completed: a pending copy due on the next date of its recurrence, with
+// the count of occurrences left lowered. It returns false when the
+// recurrence has ended. Subtasks and blockers are not copied.
+func nextOccurrence(task Task, loc *time.Location) (Task, bool) {
+	rule, err := parseRecurrence(task.Recurrence)
+	if err != nil {
+		return Task{}, false
+	}
+	due, ok := rule.next(task.DueDate, loc)
+	if !ok {
+		return Task{}, false
+	}
+	if rule.Count > 1 {
+		rule.Count--
+	}
+	return Task{
+		Title:       task.Title,
+		Description: task.Description,
+		DueDate:     due,
+		Priority:    task.Priority,
+		Status:      StatusPending,
+		OwnerID:     task.OwnerID,
+		ProjectID:   task.ProjectID,
+		ParentID:    task.ParentID,
+		Tags:        task.Tags,
+		Recurrence:  rule.String(),
+	}, true
+}
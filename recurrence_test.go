@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRecurrence(t *testing.T) {
+	madrid, err := time.LoadLocation("Europe/Madrid")
+	if err != nil {
+		t.Fatalf("LoadLocation returned error: %v", err)
+	}
+
+	tests := []struct {
+		in, due, want string
+	}{
+		{"FREQ=DAILY", "2024-12-01", "FREQ=DAILY"},
+		{"rrule:freq=weekly;interval=2;count=4", "2024-12-01", "FREQ=WEEKLY;INTERVAL=2;COUNT=4"},
+		{"FREQ=WEEKLY;INTERVAL=1;UNTIL=20250101", "2024-12-01", "FREQ=WEEKLY;UNTIL=20250101"},
+		{"UNTIL=20250101T120000Z;FREQ=DAILY", "2024-12-01", "FREQ=DAILY;UNTIL=20250101T120000Z"},
+		// Monthly rules remember the day of the month they started on, in
+		// the configured zone for times of day.
+		{"FREQ=MONTHLY", "2024-01-31", "FREQ=MONTHLY;BYMONTHDAY=31"},
+		{"FREQ=MONTHLY", "2024-01-31T23:30:00Z", "FREQ=MONTHLY;BYMONTHDAY=1"},
+		{"FREQ=MONTHLY;BYMONTHDAY=15", "2024-01-31", "FREQ=MONTHLY;BYMONTHDAY=15"},
+		// Unparseable rules are left for validateTask to reject.
+		{"FREQ=YEARLY", "2024-12-01", "FREQ=YEARLY"},
+	}
+	for _, tt := range tests {
+		if got := normalizeRecurrence(tt.in, tt.due, Task{}, madrid); got != tt.want {
+			t.Errorf("normalizeRecurrence(%q, %q) = %q, want %q", tt.in, tt.due, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{
+		"", "FREQ", "INTERVAL=2", "FREQ=YEARLY", "FREQ=DAILY;INTERVAL=0", "FREQ=DAILY;FREQ=WEEKLY",
+		"FREQ=DAILY;COUNT=2;UNTIL=20250101", "FREQ=WEEKLY;BYMONTHDAY=3", "FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=DAILY;UNTIL=2025-01-01", "FREQ=WEEKLY;BYDAY=MO",
+	} {
+		if _, err := parseRecurrence(in); err == nil {
+			t.Errorf("parseRecurrence(%q) succeeded, want an error", in)
+		}
+	}
+}
+
+func TestRecurrenceNext(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("LoadLocation returned error: %v", err)
+	}
+
+	tests := []struct {
+		name, rule, due string
+		want            []string
+	}{
+		{"daily", "FREQ=DAILY;INTERVAL=3;COUNT=3", "2024-12-30", []string{"2025-01-02", "2025-01-05"}},
+		{"weekly", "FREQ=WEEKLY;COUNT=3", "2024-02-22", []string{"2024-02-29", "2024-03-07"}},
+		{"month end", "FREQ=MONTHLY;BYMONTHDAY=31;COUNT=5", "2024-01-31", []string{"2024-02-29", "2024-03-31", "2024-04-30", "2024-05-31"}},
+		{"month end outside leap years", "FREQ=MONTHLY;BYMONTHDAY=31;COUNT=3", "2023-01-31", []string{"2023-02-28", "2023-03-31"}},
+		{"month interval across a year", "FREQ=MONTHLY;INTERVAL=5;BYMONTHDAY=30;COUNT=3", "2024-08-30", []string{"2025-01-30", "2025-06-30"}},
+		{"count", "FREQ=DAILY;COUNT=3", "2024-12-01", []string{"2024-12-02", "2024-12-03"}},
+		{"until a date", "FREQ=WEEKLY;UNTIL=20241215", "2024-12-01", []string{"2024-12-08", "2024-12-15"}},
+		{"until a time", "FREQ=DAILY;UNTIL=20241203T050000Z", "2024-12-01", []string{"2024-12-02", "2024-12-03"}},
+		// 09:00 in New York stays 09:00 when the clocks change, so the
+		// UTC time moves.
+		{"spring forward", "FREQ=DAILY;COUNT=3", "2024-03-09T14:00:00Z", []string{"2024-03-10T13:00:00Z", "2024-03-11T13:00:00Z"}},
+		{"fall back", "FREQ=WEEKLY;COUNT=2", "2024-10-28T13:00:00Z", []string{"2024-11-04T14:00:00Z"}},
+		{"monthly across a change", "FREQ=MONTHLY;BYMONTHDAY=31;COUNT=3", "2024-01-31T14:00:00Z", []string{"2024-02-29T14:00:00Z", "2024-03-31T13:00:00Z"}},
+		{"until a date in the local zone", "FREQ=DAILY;UNTIL=20241202", "2024-12-01T23:00:00Z", []string{"2024-12-02T23:00:00Z"}},
+	}
+	for _, tt := range tests {
+		task := Task{DueDate: tt.due, Recurrence: tt.rule}
+		var got []string
+		for {
+			next, ok := nextOccurrence(task, newYork)
+			if !ok || len(got) == 10 {
+				break
+			}
+			got = append(got, next.DueDate)
+			task = next
+		}
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("%s: occurrences after %s = %q, want %q", tt.name, tt.due, got, tt.want)
+		}
+	}
+}
+
+func TestCompletingRecurringTask(t *testing.T) {
+	store := newTestStore(t)
+	handler := NewRouter(&App{Store: store})
+
+	rr := executeRequest(httptest.NewRequest(http.MethodPost, "/tasks",
+		strings.NewReader(`{"title": "Rent", "due_date": "2024-01-31", "priority": 1, "tags": ["home"], "recurrence": "FREQ=MONTHLY;COUNT=2"}`)), handler)
+	var rent Task
+	json.Unmarshal(rr.Body.Bytes(), &rent)
+	if rr.Code != http.StatusCreated || rent.Recurrence != "FREQ=MONTHLY;BYMONTHDAY=31;COUNT=2" {
+		t.Fatalf("POST /tasks returned %v: %s", rr.Code, rr.Body.String())
+	}
+
+	complete := func(task Task) *httptest.ResponseRecorder {
+		t.Helper()
+		task.Status = StatusCompleted
+		body, _ := json.Marshal(task)
+		rr := executeRequest(httptest.NewRequest(http.MethodPut, fmt.Sprintf("/tasks/%d", task.ID), strings.NewReader(string(body))), handler)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Completing task %d returned %v: %s", task.ID, rr.Code, rr.Body.String())
+		}
+		return rr
+	}
+
+	rr = complete(rent)
+	var nextID int
+	if _, err := fmt.Sscanf(rr.Header().Get("Link"), "</tasks/%d>; rel=\"next-occurrence\"", &nextID); err != nil {
+		t.Fatalf("Link = %q, want the next occurrence", rr.Header().Get("Link"))
+	}
+	next, err := store.Get(nextID)
+	if err != nil || next.DueDate != "2024-02-29" || next.Status != StatusPending || next.Title != "Rent" ||
+		strings.Join(next.Tags, ",") != "home" || next.Recurrence != "FREQ=MONTHLY;BYMONTHDAY=31;COUNT=1" {
+		t.Fatalf("Next occurrence = %+v, %v", next, err)
+	}
+
+	// Editing a completed task does not spawn it again, and the last
+	// occurrence has no successor.
+	done, _ := store.Get(rent.ID)
+	done.Title = "Rent paid"
+	body, _ := json.Marshal(done)
+	rr = executeRequest(httptest.NewRequest(http.MethodPut, fmt.Sprintf("/tasks/%d", rent.ID), strings.NewReader(string(body))), handler)
+	if rr.Code != http.StatusOK || rr.Header().Get("Link") != "" {
+		t.Errorf("Editing a completed recurring task returned %v with Link %q", rr.Code, rr.Header().Get("Link"))
+	}
+	if rr := complete(next); rr.Header().Get("Link") != "" {
+		t.Errorf("Completing the last occurrence linked to %q", rr.Header().Get("Link"))
+	}
+	if tasks, _ := store.List(TaskQuery{}); len(tasks) != 2 {
+		t.Errorf("Store has %d tasks, want 2", len(tasks))
+	}
+
+	// Moving the due date of a monthly task moves the day of the month it
+	// recurs on, unless the update sets that day itself.
+	rr = executeRequest(httptest.NewRequest(http.MethodPost, "/tasks",
+		strings.NewReader(`{"title": "Gym", "due_date": "2024-01-31", "priority": 1, "recurrence": "FREQ=MONTHLY"}`)), handler)
+	var gym Task
+	json.Unmarshal(rr.Body.Bytes(), &gym)
+	gymPath := fmt.Sprintf("/tasks/%d", gym.ID)
+	for _, step := range []struct{ method, body, want string }{
+		{http.MethodPatch, `{"due_date": "2024-02-10"}`, "FREQ=MONTHLY;BYMONTHDAY=10"},
+		{http.MethodPatch, `{"title": "Gym day"}`, "FREQ=MONTHLY;BYMONTHDAY=10"},
+		{http.MethodPut, `{"title": "Gym", "due_date": "2024-02-12", "priority": 1, "recurrence": "FREQ=MONTHLY;BYMONTHDAY=10"}`, "FREQ=MONTHLY;BYMONTHDAY=12"},
+		{http.MethodPatch, `{"due_date": "2024-02-14", "recurrence": "FREQ=MONTHLY;BYMONTHDAY=20"}`, "FREQ=MONTHLY;BYMONTHDAY=20"},
+	} {
+		rr := executeRequest(httptest.NewRequest(step.method, gymPath, strings.NewReader(step.body)), handler)
+		var moved Task
+		json.Unmarshal(rr.Body.Bytes(), &moved)
+		if rr.Code != http.StatusOK || moved.Recurrence != step.want {
+			t.Errorf("%s %s with %s returned %v: %s; want recurrence %q", step.method, gymPath, step.body, rr.Code, rr.Body.String(), step.want)
+		}
+	}
+
+	rr = executeRequest(httptest.NewRequest(http.MethodPost, "/tasks",
+		strings.NewReader(`{"title": "Bad", "due_date": "2024-01-31", "priority": 1, "recurrence": "FREQ=HOURLY"}`)), handler)
+	assertProblem(t, rr, http.StatusUnprocessableEntity, "validation_failed")
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// The field errors of a parent_id that cannot be used.
+var (
+	parentNotFound = FieldError{Field: "parent_id", Message: "parent task not found"}
+	parentCycle    = FieldError{Field: "parent_id", Message: "a task cannot be a subtask of itself or of its subtasks"}
+)
+
+// relationError returns the field error for a store error about the
+// project or parent of a task.
+func relationError(err error) (FieldError, bool) {
+	switch {
+	case errors.Is(err, ErrProjectNotFound):
+		return projectNotFound, true
+	case errors.Is(err, ErrParentNotFound):
+		return parentNotFound, true
+	case errors.Is(err, ErrCycle):
+		return parentCycle, true
+	}
+	return FieldError{}, false
+}
+
+// validateRelations checks that the calling user may file task under its
+// project and parent, where they differ from those of current.
+func (app *App) validateRelations(r *http.Request, task, current Task) ([]FieldError, error) {
+	var errs []FieldError
+	if task.ProjectID != current.ProjectID {
+		projectErrs, err := app.validateProject(r, task.ProjectID)
+		if err != nil {
+			return nil, err
+		}
+		errs = append(errs, projectErrs...)
+	}
+	if task.ParentID != current.ParentID && task.ParentID != 0 {
+		if task.ParentID == task.ID {
+			return append(errs, parentCycle), nil
+		}
+		parent, err := app.Store.Get(task.ParentID)
+		if err == nil && parent.DeletedAt != nil {
+			err = ErrTaskNotFound
+		} else if err == nil {
+			err = app.authorizer().Authorize(currentUser(r.Context()), ActionRead, parent)
+		}
+		if errors.Is(err, ErrTaskNotFound) || errors.Is(err, ErrForbidden) {
+			errs = append(errs, parentNotFound)
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return errs, nil
+}
+
+// getSubtasks handles GET /tasks/{id}/subtasks. It takes the filters of
+// GET /tasks.
+func (app *App) getSubtasks(w http.ResponseWriter, r *http.Request) {
+	id, ok := app.pathID(w, r)
+	if !ok {
+		return
+	}
+	if _, ok := app.loadTask(w, r, id); !ok {
+		return
+	}
+	query, err := parseTaskQuery(r.URL.Query(), app.location(), time.Now())
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_query", err.Error())
+		return
+	}
+	query.ParentID = id
+	app.writeTaskPage(w, r, query)
+}
+
+// linkSubtask handles PUT /tasks/{id}/subtasks/{subtask_id}, making an
+// existing task a subtask of {id}. It responds with the subtask.
+func (app *App) linkSubtask(w http.ResponseWriter, r *http.Request) {
+	parentID, ok := app.pathID(w, r)
+	if !ok {
+		return
+	}
+	subtaskID, ok := app.pathTaskID(w, r, "subtask_id")
+	if !ok {
+		return
+	}
+	if _, ok := app.loadTask(w, r, parentID); !ok {
+		return
+	}
+	subtask, ok := app.loadTask(w, r, subtaskID)
+	if !ok || !app.authorize(w, r, ActionUpdate, subtask) {
+		return
+	}
+
+	subtask.ParentID = parentID
+	app.saveTask(w, r, subtask)
+}
+
+// unlinkSubtask handles DELETE /tasks/{id}/subtasks/{subtask_id], turning a
+// subtask back into a task of its own. It responds with the former
+// subtask.
+func (app *App) unlinkSubtask(w http.ResponseWriter, r *http.Request) {
+	parentID, ok := app.pathID(w, r)
+	if !ok {
+		return
+	}
+	subtaskID, ok := app.pathTaskID(w, r, "subtask_id")
+	if !ok {
+		return
+	}
+	subtask, ok := app.loadTask(w, r, subtaskID)
+	if !ok {
+		return
+	}
+	if subtask.ParentID != parentID {
+		writeError(w, r, http.StatusNotFound, "subtask_not_found", "the task is not a subtask of this task")
+		return
+	}
+	if !app.authorize(w, r, ActionUpdate, subtask) {
+		return
+	}
+
+	subtask.ParentID = 0
+	app.saveTask(w, r, subtask)
+}
+
+// getBlockers handles GET /tasks/{id}/blockers, listing the tasks the
+// task waits on.
+func (app *App) getBlockers(w http.ResponseWriter, r *http.Request) {
+	id, ok := app.pathID(w, r)
+	if !ok {
+		return
+	}
+	if _, ok := app.loadTask(w, r, id); !ok {
+		return
+	}
+	app.writeBlockers(w, r, id)
+}
+
+// addBlocker handles PUT /tasks/{id}/blockers/{blocker_id}, recording that
+// {id} cannot be completed before {blocker_id}. It responds with the
+// blockers of the task.
+func (app *App) addBlocker(w http.ResponseWriter, r *http.Request) {
+	task, blockerID, ok := app.loadDependency(w, r)
+	if !ok {
+		return
+	}
+	if _, ok := app.loadTask(w, r, blockerID); !ok {
+		return
+	}
+
+	err := app.Store.AddBlocker(task.ID, blockerID)
+	if errors.Is(err, ErrCycle) {
+		writeError(w, r, http.StatusConflict, "dependency_cycle", "the blocker already waits on this task, so it cannot block it")
+		return
+	} else if errors.Is(err, ErrTaskNotFound) {
+		writeTaskNotFound(w, r)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Failed to add blocker", err)
+		return
+	}
+	app.writeBlockers(w, r, task.ID)
+}
+
+// removeBlocker handles DELETE /tasks/{id}/blockers/{blocker_id}. It
+// responds with the remaining blockers of the task.
+func (app *App) removeBlocker(w http.ResponseWriter, r *http.Request) {
+	task, blockerID, ok := app.loadDependency(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.Store.RemoveBlocker(task.ID, blockerID)
+	if errors.Is(err, ErrDependencyNotFound) {
+		writeError(w, r, http.StatusNotFound, "dependency_not_found", "the task is not blocked by that task")
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Failed to remove blocker", err)
+		return
+	}
+	app.writeBlockers(w, r, task.ID)
+}
+
+// loadDependency reads the path of a blocker route, returning the task the
+// calling user is changing the blockers of and the blocker ID.
+func (app *App) loadDependency(w http.ResponseWriter, r *http.Request) (Task, int, bool) {
+	id, ok := app.pathID(w, r)
+	if !ok {
+		return Task{}, 0, false
+	}
+	blockerID, ok := app.pathTaskID(w, r, "blocker_id")
+	if !ok {
+		return Task{}, 0, false
+	}
+	task, ok := app.loadTask(w, r, id)
+	if !ok || !app.authorize(w, r, ActionUpdate, task) {
+		return Task{}, 0, false
+	}
+	return task, blockerID, true
+}
+
+// writeBlockers responds with the blockers of a task the calling user can
+// read, leaving out those they cannot.
+func (app *App) writeBlockers(w http.ResponseWriter, r *http.Request, id int) {
+	blockers, err := app.Store.ListBlockers(id)
+	if err != nil {
+		writeServerError(w, r, "Failed to fetch blockers", err)
+		return
+	}
+	user := currentUser(r.Context())
+	visible := []Task{}
+	for _, blocker := range blockers {
+		if app.authorizer().Authorize(user, ActionRead, blocker) == nil {
+			visible = append(visible, blocker)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(visible)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSubtasks(t *testing.T) {
+	store := newTestStore(t)
+	handler := NewRouter(&App{Store: store})
+
+	release := createTaskInStore(t, store, Task{Title: "Release", DueDate: "2024-12-01", Priority: 1})
+	loose := createTaskInStore(t, store, Task{Title: "Changelog", DueDate: "2024-12-01", Priority: 2})
+	other, _ := addTestUser(t, store, "other", RoleEditor)
+	theirs := createTaskInStore(t, store, Task{Title: "Theirs", DueDate: "2024-12-01", Priority: 1, OwnerID: other.ID})
+
+	body := fmt.Sprintf(`{"title": "Review", "due_date": "2024-12-01", "priority": 1, "parent_id": %d}`, release)
+	rr := executeRequest(httptest.NewRequest(http.MethodPost, "/tasks", strings.NewReader(body)), handler)
+	var review Task
+	json.Unmarshal(rr.Body.Bytes(), &review)
+	if rr.Code != http.StatusCreated || review.ParentID != release {
+		t.Fatalf("POST /tasks with a parent returned %v %s", rr.Code, rr.Body.String())
+	}
+
+	for _, parent := range []int{999, theirs} {
+		body := fmt.Sprintf(`{"title": "Lost", "due_date": "2024-12-01", "priority": 1, "parent_id": %d}`, parent)
+		assertProblem(t, executeRequest(httptest.NewRequest(http.MethodPost, "/tasks", strings.NewReader(body)), handler),
+			http.StatusUnprocessableEntity, "validation_failed")
+	}
+	cycle := fmt.Sprintf(`{"parent_id": %d}`, review.ID)
+	assertProblem(t, executeRequest(httptest.NewRequest(http.MethodPatch, fmt.Sprintf("/tasks/%d", release), strings.NewReader(cycle)), handler),
+		http.StatusUnprocessableEntity, "validation_failed")
+
+	subtasksPath := fmt.Sprintf("/tasks/%d/subtasks", release)
+	if rr := executeRequest(httptest.NewRequest(http.MethodPut, fmt.Sprintf("%s/%d", subtasksPath, loose), nil), handler); rr.Code != http.StatusOK {
+		t.Fatalf("PUT %s/%d returned %v: %s", subtasksPath, loose, rr.Code, rr.Body.String())
+	}
+	listTitles := func() string {
+		t.Helper()
+		rr := executeRequest(httptest.NewRequest(http.MethodGet, subtasksPath+"?sort_by=title", nil), handler)
+		var tasks []Task
+		json.Unmarshal(rr.Body.Bytes(), &tasks)
+		var titles []string
+		for _, task := range tasks {
+			titles = append(titles, task.Title)
+		}
+		return strings.Join(titles, ",")
+	}
+	if got := listTitles(); got != "Changelog,Review" {
+		t.Errorf("GET %s = %s, want Changelog,Review", subtasksPath, got)
+	}
+
+	if rr := executeRequest(httptest.NewRequest(http.MethodDelete, fmt.Sprintf("%s/%d", subtasksPath, loose), nil), handler); rr.Code != http.StatusOK {
+		t.Errorf("DELETE %s/%d returned %v: %s", subtasksPath, loose, rr.Code, rr.Body.String())
+	}
+	if got := listTitles(); got != "Review" {
+		t.Errorf("GET %s after unlinking = %s, want Review", subtasksPath, got)
+	}
+	assertProblem(t, executeRequest(httptest.NewRequest(http.MethodDelete, fmt.Sprintf("%s/%d", subtasksPath, loose), nil), handler),
+		http.StatusNotFound, "subtask_not_found")
+}
+
+func TestBlockersHoldBackCompletion(t *testing.T) {
+	store := newTestStore(t)
+	handler := NewRouter(&App{Store: store})
+
+	deploy := createTaskInStore(t, store, Task{Title: "Deploy", DueDate: "2024-12-01", Priority: 1})
+	review := createTaskInStore(t, store, Task{Title: "Review", DueDate: "2024-12-01", Priority: 1})
+	blockersPath := fmt.Sprintf("/tasks/%d/blockers", deploy)
+
+	rr := executeRequest(httptest.NewRequest(http.MethodPut, fmt.Sprintf("%s/%d", blockersPath, review), nil), handler)
+	var blockers []Task
+	json.Unmarshal(rr.Body.Bytes(), &blockers)
+	if rr.Code != http.StatusOK || len(blockers) != 1 || blockers[0].ID != review {
+		t.Fatalf("PUT %s/%d returned %v %s, want Review as the blocker", blockersPath, review, rr.Code, rr.Body.String())
+	}
+	assertProblem(t, executeRequest(httptest.NewRequest(http.MethodPut, fmt.Sprintf("/tasks/%d/blockers/%d", review, deploy), nil), handler),
+		http.StatusConflict, "dependency_cycle")
+	assertProblem(t, executeRequest(httptest.NewRequest(http.MethodPut, fmt.Sprintf("%s/999", blockersPath), nil), handler),
+		http.StatusNotFound, "task_not_found")
+
+	complete := func() *httptest.ResponseRecorder {
+		return executeRequest(httptest.NewRequest(http.MethodPatch, fmt.Sprintf("/tasks/%d", deploy), strings.NewReader(`{"status": "Completed"}`)), handler)
+	}
+	rr = complete()
+	assertProblem(t, rr, http.StatusConflict, "task_blocked")
+	var problem struct {
+		BlockedBy []int `json:"blocked_by"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &problem)
+	if len(problem.BlockedBy) != 1 || problem.BlockedBy[0] != review {
+		t.Errorf("task_blocked problem lists %v, want [%d]", problem.BlockedBy, review)
+	}
+
+	if rr := executeRequest(httptest.NewRequest(http.MethodPatch, fmt.Sprintf("/tasks/%d", review), strings.NewReader(`{"status": "Completed"}`)), handler); rr.Code != http.StatusOK {
+		t.Fatalf("Completing the blocker returned %v: %s", rr.Code, rr.Body.String())
+	}
+	if rr := complete(); rr.Code != http.StatusOK {
+		t.Errorf("Completing a task whose blockers are done returned %v: %s", rr.Code, rr.Body.String())
+	}
+
+	if rr := executeRequest(httptest.NewRequest(http.MethodDelete, fmt.Sprintf("%s/%d", blockersPath, review), nil), handler); rr.Code != http.StatusOK || strings.TrimSpace(rr.Body.String()) != "[]" {
+		t.Errorf("DELETE %s/%d returned %v %s, want no blockers left", blockersPath, review, rr.Code, rr.Body.String())
+	}
+	assertProblem(t, executeRequest(httptest.NewRequest(http.MethodDelete, fmt.Sprintf("%s/%d", blockersPath, review), nil), handler),
+		http.StatusNotFound, "dependency_not_found")
+}
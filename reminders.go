@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// reminderPageSize is how many tasks a reminder scan reads at a time.
+const reminderPageSize = 500
+
+// Reminder warns that a task is about to be due.
+type Reminder struct {
+	Task Task
+	// Threshold is how long before the task is due the reminder is for.
+	Threshold time.Duration
+	// DueAt is when the task is due: its due time, or the end of its due
+	// date.
+	DueAt time.Time
+}
+
+// Subject is a one-line summary of the reminder.
+func (rem Reminder) Subject() string {
+	return fmt.Sprintf("Task %q is due in less than %s", rem.Task.Title, formatThreshold(rem.Threshold))
+}
+
+// Text describes the reminder for people, with times in loc.
+func (rem Reminder) Text(loc *time.Location) string {
+	due := "on " + rem.Task.DueDate
+	if _, allDay := dueKey(rem.Task); !allDay {
+		due = "at " + rem.DueAt.In(loc).Format("2006-01-02 15:04 MST")
+	}
+	text := fmt.Sprintf("Task %d, %q, is due %s, in less than %s.", rem.Task.ID, rem.Task.Title, due, formatThreshold(rem.Threshold))
+	if rem.Task.Description != "" {
+		text += "\n\n" + rem.Task.Description
+	}
+	return text
+}
+
+// formatThreshold writes a threshold without the zero minutes and seconds
+// of time.Duration.String, such as "24h" or "1h30m".
+func formatThreshold(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// dueAt returns when a task is due. Tasks due on a date are due at the end
+// of it in loc.
+func dueAt(task Task, loc *time.Location) time.Time {
+	t, allDay := dueKey(task)
+	if allDay {
+		return dueBoundOn(t.AddDate(0, 0, 1), loc).At
+	}
+	return t
+}
+
+// ReminderScheduler sends reminders of the unfinished tasks that are about
+// to be due through its notifiers, once per task and threshold.
+type ReminderScheduler struct {
+	Store     Store
+	Notifiers []Notifier
+	// Thresholds are how long before their due times tasks get reminders.
+	Thresholds []time.Duration
+	// Location is where dates end.
+	Location *time.Location
+}
+
+// Scan sends the reminders that are due at now. Each threshold covers the
+// tasks due between it and the next shorter one, so that a task that is
+// already close to due only gets the reminder of the shortest threshold
+// rather than all of them at once. A reminder that no notifier could send
+// is tried again on the next scan.
+func (s *ReminderScheduler) Scan(ctx context.Context, now time.Time) error {
+	loc := s.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	thresholds := slices.Clone(s.Thresholds)
+	slices.Sort(thresholds)
+
+	var errs []error
+	from := dueBoundAt(now, loc)
+	for _, threshold := range thresholds {
+		to := dueBoundAt(now.Add(threshold), loc)
+		query := TaskQuery{
+			ExcludeStatuses: []string{StatusCompleted},
+			DueFrom:         &from,
+			DueBefore:       &to,
+			Sort:            []SortKey{{Field: "id"}},
+			Limit:           reminderPageSize,
+		}
+		for {
+			tasks, err := s.Store.List(query)
+			if err != nil {
+				return errors.Join(append(errs, err)...)
+			}
+			for _, task := range tasks {
+				if err := s.remind(ctx, task, threshold, now, loc); err != nil {
+					errs = append(errs, fmt.Errorf("task %d: %w", task.ID, err))
+				}
+			}
+			if len(tasks) < query.Limit {
+				break
+			}
+			query.After = &tasks[len(tasks)-1]
+		}
+		from = to
+	}
+	return errors.Join(errs...)
+}
+
+// remind sends the reminder of task for threshold unless it was sent.
+func (s *ReminderScheduler) remind(ctx context.Context, task Task, threshold time.Duration, now time.Time, loc *time.Location) error {
+	claimed, err := s.Store.ClaimReminder(task.ID, task.DueDate, threshold, now)
+	if errors.Is(err, ErrTaskNotFound) {
+		// Purged since it was listed.
+		return nil
+	} else if err != nil || !claimed {
+		return err
+	}
+
+	rem := Reminder{Task: task, Threshold: threshold, DueAt: dueAt(task, loc)}
+	var errs []error
+	for _, notifier := range s.Notifiers {
+		if err := notifier.Notify(ctx, rem); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 && len(errs) == len(s.Notifiers) {
+		if err := s.Store.ReleaseReminder(task.ID, task.DueDate, threshold); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordingNotifier collects the reminders it is sent, or fails with err.
+type recordingNotifier struct {
+	sent []string
+	err  error
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, rem Reminder) error {
+	if n.err != nil {
+		return n.err
+	}
+	n.sent = append(n.sent, fmt.Sprintf("%s/%s", rem.Task.Title, formatThreshold(rem.Threshold)))
+	return nil
+}
+
+func TestReminderScheduler(t *testing.T) {
+	store := newTestStore(t)
+	now := time.Date(2024, 12, 1, 12, 0, 0, 0, time.UTC)
+	createTaskInStore(t, store, Task{Title: "Soon", DueDate: "2024-12-01T12:30:00Z", Priority: 1})
+	tomorrow := createTaskInStore(t, store, Task{Title: "Tomorrow", DueDate: "2024-12-02T06:00:00Z", Priority: 1})
+	createTaskInStore(t, store, Task{Title: "Today", DueDate: "2024-12-01", Priority: 1})
+	createTaskInStore(t, store, Task{Title: "Done", DueDate: "2024-12-01T12:30:00Z", Priority: 1, Status: StatusCompleted})
+	createTaskInStore(t, store, Task{Title: "Later", DueDate: "2024-12-05", Priority: 1})
+	createTaskInStore(t, store, Task{Title: "Late", DueDate: "2024-11-30T12:00:00Z", Priority: 1})
+
+	notifier := &recordingNotifier{}
+	scheduler := &ReminderScheduler{Store: store, Notifiers: []Notifier{notifier}, Thresholds: []time.Duration{24 * time.Hour, time.Hour}}
+	scan := func(at time.Time) []string {
+		t.Helper()
+		notifier.sent = nil
+		if err := scheduler.Scan(context.Background(), at); err != nil {
+			t.Fatalf("Scan returned error: %v", err)
+		}
+		slices.Sort(notifier.sent)
+		return notifier.sent
+	}
+
+	// A task already within the shortest threshold only gets its reminder.
+	if got, want := scan(now), []string{"Soon/1h", "Today/24h", "Tomorrow/24h"}; !slices.Equal(got, want) {
+		t.Errorf("First scan sent %q, want %q", got, want)
+	}
+	if got := scan(now.Add(time.Minute)); len(got) != 0 {
+		t.Errorf("Second scan sent %q again", got)
+	}
+	if got, want := scan(now.Add(17*time.Hour+30*time.Minute)), []string{"Tomorrow/1h"}; !slices.Equal(got, want) {
+		t.Errorf("Scan an hour before Tomorrow sent %q, want %q", got, want)
+	}
+
+	// A new due date gets reminders of its own.
+	task, _ := store.Get(tomorrow)
+	task.DueDate = "2024-12-02T08:00:00Z"
+	if _, err := store.Update(task, 0); err != nil {
+		t.Fatalf("Update returned error: %v", err)
+	}
+	if got, want := scan(now.Add(17*time.Hour+30*time.Minute)), []string{"Tomorrow/24h"}; !slices.Equal(got, want) {
+		t.Errorf("Scan after moving Tomorrow sent %q, want %q", got, want)
+	}
+
+	// Reminders no notifier could send are tried again.
+	createTaskInStore(t, store, Task{Title: "Retry", DueDate: "2024-12-01T12:40:00Z", Priority: 1})
+	notifier.err = errors.New("mail server down")
+	if err := scheduler.Scan(context.Background(), now); err == nil || !strings.Contains(err.Error(), "mail server down") {
+		t.Errorf("Scan with a failing notifier returned %v", err)
+	}
+	notifier.err = nil
+	if got, want := scan(now), []string{"Retry/1h"}; !slices.Equal(got, want) {
+		t.Errorf("Scan after a failure sent %q, want %q", got, want)
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var payload reminderPayload
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Content-Type = %q", r.Header.Get("Content-Type"))
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	rem := Reminder{Task: Task{ID: 7, Title: "Ship"}, Threshold: 90 * time.Minute, DueAt: time.Date(2024, 12, 1, 12, 0, 0, 0, time.UTC)}
+	notifier := &WebhookNotifier{URL: server.URL}
+	if err := notifier.Notify(context.Background(), rem); err != nil {
+		t.Fatalf("Notify returned error: %v", err)
+	}
+	if payload.Event != "task.due_soon" || payload.Task.ID != 7 || payload.Threshold != "1h30m" || payload.ThresholdSeconds != 5400 ||
+		payload.Text != `Task "Ship" is due in less than 1h30m` {
+		t.Errorf("Webhook received %+v", payload)
+	}
+
+	status = http.StatusInternalServerError
+	if err := notifier.Notify(context.Background(), rem); err == nil {
+		t.Error("Notify succeeded on a 500 response")
+	}
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	var to []string
+	var msg string
+	notifier := &SMTPNotifier{
+		Addr: "mail.example.com:587", Username: "calidad", Password: "secret",
+		From: "calidad@example.com", To: []string{"a@example.com", "b@example.com"},
+		sendMail: func(addr string, a smtp.Auth, from string, rcpt []string, body []byte) error {
+			if addr != "mail.example.com:587" || a == nil || from != "calidad@example.com" {
+				t.Errorf("sendMail(%q, %v, %q)", addr, a, from)
+			}
+			to, msg = rcpt, string(body)
+			return nil
+		},
+	}
+	rem := Reminder{Task: Task{ID: 7, Title: "Café", DueDate: "2024-12-01T12:00:00Z", Description: "Beans\nand milk"},
+		Threshold: time.Hour, DueAt: time.Date(2024, 12, 1, 12, 0, 0, 0, time.UTC)}
+	if err := notifier.Notify(context.Background(), rem); err != nil {
+		t.Fatalf("Notify returned error: %v", err)
+	}
+	if len(to) != 2 {
+		t.Errorf("Email sent to %q", to)
+	}
+	for _, want := range []string{
+		"To: a@example.com, b@example.com\r\n",
+		"Subject: =?utf-8?q?Task_\"Caf=C3=A9\"_is_due_in_less_than_1h?=\r\n",
+		"\r\n\r\nTask 7, \"Café\", is due at 2024-12-01 12:00 UTC, in less than 1h.\r\n\r\nBeans\r\nand milk\r\n",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("Email does not contain %q:\n%s", want, msg)
+		}
+	}
+}
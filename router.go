@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// router collects the routes of the API on a ServeMux. Each path is one
+// ServeMux pattern that dispatches on the method itself, so literal paths
+// such as /tasks/export can sit next to wildcard ones such as /tasks/{id}.
+// Every path answers methods it does not support with a 405 problem
+// listing the allowed ones.
+type router struct {
+	mux      *http.ServeMux
+	handlers map[string]map[string]http.HandlerFunc
+}
+
+func (rt *router) handle(method, path string, h http.HandlerFunc) {
+	handlers, ok := rt.handlers[path]
+	if !ok {
+		handlers = make(map[string]http.HandlerFunc)
+		rt.handlers[path] = handlers
+		rt.mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			h, ok := handlers[r.Method]
+			if !ok && r.Method == http.MethodHead {
+				h, ok = handlers[http.MethodGet]
+			}
+			if !ok {
+				w.Header().Set("Allow", strings.Join(allowedMethods(handlers), ", "))
+				writeMethodNotAllowed(w, r)
+				return
+			}
+			h(w, r)
+		})
+	}
+	handlers[method] = h
+}
+
+// allowedMethods lists the methods of a path, sorted. GET handlers answer
+// HEAD too.
+func allowedMethods(handlers map[string]http.HandlerFunc) []string {
+	methods := make([]string, 0, len(handlers)+1)
+	for method := range handlers {
+		methods = append(methods, method)
+	}
+	if _, ok := handlers[http.MethodGet]; ok {
+		if _, ok := handlers[http.MethodHead]; !ok {
+			methods = append(methods, http.MethodHead)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// NewRouter returns the HTTP API of app, without the CORS handling main
+// adds for browsers.
+func NewRouter(app *App) http.Handler {
+	rt := &router{mux: http.NewServeMux(), handlers: make(map[string]map[string]http.HandlerFunc)}
+
+	rt.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, http.StatusNotFound, "not_found", "no resource at "+r.URL.Path)
+	})
+
+	rt.handle(http.MethodPost, "/auth/login", app.login)
+	rt.handle(http.MethodPost, "/auth/logout", app.logout)
+	rt.handle(http.MethodGet, "/auth/me", app.requireUser(app.getMe))
+	rt.handle(http.MethodGet, "/auth/tokens", app.requireUser(app.listTokens))
+	rt.handle(http.MethodPost, "/auth/tokens", app.requireUser(app.createAPIToken))
+	rt.handle(http.MethodDelete, "/auth/tokens/{id}", app.requireUser(app.deleteAPIToken))
+
+	rt.handle(http.MethodGet, "/tasks", app.requireUser(app.getAllTasks))
+	rt.handle(http.MethodPost, "/tasks", app.requireUser(app.withIdempotencyKey(app.createTask)))
+	rt.handle(http.MethodPost, "/tasks:batch", app.requireUser(app.withIdempotencyKey(app.batchTasks)))
+	rt.handle(http.MethodGet, "/tasks.ics", app.requireFeedUser(app.getTasksCalendar))
+	rt.handle(http.MethodGet, "/tasks/export", app.requireUser(app.exportTasks))
+	rt.handle(http.MethodPost, "/tasks/import", app.requireUser(app.importTasks))
+	rt.handle(http.MethodGet, "/tasks/{id}", app.requireUser(app.getTaskByID))
+	rt.handle(http.MethodPut, "/tasks/{id}", app.requireUser(app.updateTask))
+	rt.handle(http.MethodPatch, "/tasks/{id}", app.requireUser(app.patchTask))
+	rt.handle(http.MethodDelete, "/tasks/{id}", app.requireUser(app.deleteTask))
+	rt.handle(http.MethodPost, "/tasks/{id}/reopen", app.requireUser(app.reopenTask))
+	rt.handle(http.MethodPost, "/tasks/{id}/restore", app.requireUser(app.restoreTask))
+	rt.handle(http.MethodGet, "/tasks/{id}/history", app.requireUser(app.getTaskHistory))
+	rt.handle(http.MethodGet, "/tasks/{id}/subtasks", app.requireUser(app.getSubtasks))
+	rt.handle(http.MethodPut, "/tasks/{id}/subtasks/{subtask_id}", app.requireUser(app.linkSubtask))
+	rt.handle(http.MethodDelete, "/tasks/{id}/subtasks/{subtask_id}", app.requireUser(app.unlinkSubtask))
+	rt.handle(http.MethodGet, "/tasks/{id}/blockers", app.requireUser(app.getBlockers))
+	rt.handle(http.MethodPut, "/tasks/{id}/blockers/{blocker_id}", app.requireUser(app.addBlocker))
+	rt.handle(http.MethodDelete, "/tasks/{id}/blockers/{blocker_id}", app.requireUser(app.removeBlocker))
+
+	rt.handle(http.MethodGet, "/tags", app.requireUser(app.getTags))
+	rt.handle(http.MethodPatch, "/tags/{name}", app.requireUser(app.renameTag))
+	rt.handle(http.MethodPost, "/tags/{name}/merge", app.requireUser(app.mergeTags))
+
+	rt.handle(http.MethodGet, "/projects", app.requireUser(app.getProjects))
+	rt.handle(http.MethodPost, "/projects", app.requireUser(app.createProject))
+	rt.handle(http.MethodGet, "/projects/{id}", app.requireUser(app.getProject))
+	rt.handle(http.MethodPut, "/projects/{id}", app.requireUser(app.updateProject))
+	rt.handle(http.MethodPatch, "/projects/{id}", app.requireUser(app.updateProject))
+	rt.handle(http.MethodDelete, "/projects/{id}", app.requireUser(app.deleteProject))
+	rt.handle(http.MethodGet, "/projects/{id}/tasks", app.requireUser(app.getProjectTasks))
+	rt.handle(http.MethodPost, "/projects/{id}/tasks", app.requireUser(app.withIdempotencyKey(app.createProjectTask)))
+	rt.handle(http.MethodGet, "/projects/{id}/tasks.ics", app.requireFeedUser(app.getProjectCalendar))
+
+	rt.handle(http.MethodGet, "/webhooks", app.requireAdmin(app.getWebhooks))
+	rt.handle(http.MethodPost, "/webhooks", app.requireAdmin(app.createWebhook))
+	rt.handle(http.MethodGet, "/webhooks/{id}", app.requireAdmin(app.getWebhook))
+	rt.handle(http.MethodPut, "/webhooks/{id}", app.requireAdmin(app.updateWebhook))
+	rt.handle(http.MethodPatch, "/webhooks/{id}", app.requireAdmin(app.updateWebhook))
+	rt.handle(http.MethodDelete, "/webhooks/{id}", app.requireAdmin(app.deleteWebhook))
+	rt.handle(http.MethodGet, "/webhooks/{id}/deliveries", app.requireAdmin(app.getWebhookDeliveries))
+
+	return requestIDMiddleware(rt.mux)
+}
+
+// pathID reads the task named by the {id} path parameter, answering with a
+// problem when it names none.
+func (app *App) pathID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	return app.pathTaskID(w, r, "id")
+}
+
+// pathTaskID is pathID for a task in the named path parameter. Tasks are
+// named by ID, or by UID under the uuid and ulid task ID strategies.
+func (app *App) pathTaskID(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	value := r.PathValue(name)
+	if id, err := strconv.Atoi(value); err == nil {
+		return id, true
+	}
+	if app.TaskIDs == "" || app.TaskIDs == TaskIDsSequence {
+		writeError(w, r, http.StatusBadRequest, "invalid_task_id", "task ID must be a number")
+		return 0, false
+	}
+	task, err := app.Store.GetByUID(value)
+	if errors.Is(err, ErrTaskNotFound) {
+		writeTaskNotFound(w, r)
+		return 0, false
+	} else if err != nil {
+		writeServerError(w, r, "Failed to fetch task", err)
+		return 0, false
+	}
+	return task.ID, true
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRouterMethodNotAllowed(t *testing.T) {
+	router := NewRouter(&App{Store: NewMemoryStore()})
+
+	tests := []struct {
+		method string
+		path   string
+		allow  string
+	}{
+		{http.MethodPut, "/tasks", "GET, HEAD, POST"},
+		{http.MethodPost, "/tasks/5", "DELETE, GET, HEAD, PATCH, PUT"},
+		{http.MethodGet, "/tasks/5/reopen", "POST"},
+		{http.MethodGet, "/tags/bug/merge", "POST"},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, tt.path, nil)
+		rr := executeRequest(req, router)
+		assertProblem(t, rr, http.StatusMethodNotAllowed, "method_not_allowed")
+		if got := rr.Header().Get("Allow"); got != tt.allow {
+			t.Errorf("%s %s: Allow is %q, want %q", tt.method, tt.path, got, tt.allow)
+		}
+	}
+}
+
+func TestRouterPaths(t *testing.T) {
+	router := NewRouter(&App{Store: newTestStore(t)})
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+		code   string
+	}{
+		{http.MethodGet, "/tasks/5/anything", http.StatusNotFound, "not_found"},
+		{http.MethodGet, "/projects/5/anything", http.StatusNotFound, "not_found"},
+		{http.MethodGet, "/projects/abc", http.StatusBadRequest, "invalid_project_id"},
+		{http.MethodGet, "/projects/5/tasks", http.StatusNotFound, "project_not_found"},
+		{http.MethodGet, "/tasks/abc", http.StatusBadRequest, "invalid_task_id"},
+		{http.MethodPost, "/tasks/abc/reopen", http.StatusBadRequest, "invalid_task_id"},
+		{http.MethodGet, "/tasks/5", http.StatusNotFound, "task_not_found"},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, tt.path, nil)
+		rr := executeRequest(req, router)
+		assertProblem(t, rr, tt.status, tt.code)
+		if rr.Header().Get("X-Request-ID") == "" {
+			t.Errorf("%s %s: response has no X-Request-ID", tt.method, tt.path)
+		}
+	}
+}
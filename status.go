@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// The statuses a task can be in.
+const (
+	StatusPending    = "Pending"
+	StatusInProgress = "In Progress"
+	StatusCompleted  = "Completed"
+)
+
+// taskStatuses lists every valid status, in workflow order.
+var taskStatuses = []string{StatusPending, StatusInProgress, StatusCompleted}
+
+func isTaskStatus(status string) bool {
+	return slices.Contains(taskStatuses, status)
+}
+
+// StatusTransitions maps each status to the statuses a task may move to
+// from it with an update. Staying in the same status is always allowed.
+type StatusTransitions map[string][]string
+
+// defaultTransitions lets open tasks move freely and completes them for
+// good: leaving Completed takes the reopen action.
+const defaultTransitions = "Pending->In Progress, Pending->Completed, In Progress->Pending, In Progress->Completed"
+
+// reopenedStatus is where the reopen action puts a completed task.
+const reopenedStatus = StatusPending
+
+// parseTransitions reads a comma-separated list of "From->To" edges.
+func parseTransitions(spec string) (StatusTransitions, error) {
+	transitions := make(StatusTransitions)
+	for _, edge := range strings.Split(spec, ",") {
+		edge = strings.TrimSpace(edge)
+		if edge == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(edge, "->")
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		if !ok {
+			return nil, fmt.Errorf("transition %q must look like Pending->Completed", edge)
+		}
+		for _, status := range []string{from, to} {
+			if !isTaskStatus(status) {
+				return nil, fmt.Errorf("transition %q: unknown status %q", edge, status)
+			}
+		}
+		if !slices.Contains(transitions[from], to) {
+			transitions[from] = append(transitions[from], to)
+		}
+	}
+	return transitions, nil
+}
+
+// Allows reports whether an update may move a task from one status to
+// another.
+func (t StatusTransitions) Allows(from, to string) bool {
+	return from == to || slices.Contains(t[from], to)
+}
+
+// From returns the statuses an update may move a task to from status, in
+// workflow order.
+func (t StatusTransitions) From(status string) []string {
+	allowed := []string{}
+	for _, to := range taskStatuses {
+		if to != status && t.Allows(status, to) {
+			allowed = append(allowed, to)
+		}
+	}
+	return allowed
+}
+
+// mustParseTransitions is for transition graphs known to be valid.
+func mustParseTransitions(spec string) StatusTransitions {
+	transitions, err := parseTransitions(spec)
+	if err != nil {
+		panic(err)
+	}
+	return transitions
+}
+
+var defaultStatusTransitions = mustParseTransitions(defaultTransitions)
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseTransitions(t *testing.T) {
+	transitions, err := parseTransitions("Pending->In Progress, In Progress -> Completed")
+	if err != nil {
+		t.Fatalf("parseTransitions returned error: %v", err)
+	}
+	if !transitions.Allows(StatusPending, StatusInProgress) || !transitions.Allows(StatusInProgress, StatusCompleted) {
+		t.Errorf("Listed transitions are not allowed: %v", transitions)
+	}
+	if transitions.Allows(StatusPending, StatusCompleted) {
+		t.Error("Unlisted transition Pending->Completed is allowed")
+	}
+	if !transitions.Allows(StatusCompleted, StatusCompleted) {
+		t.Error("Keeping the same status is not allowed")
+	}
+	if got := fmt.Sprint(transitions.From(StatusPending)); got != "[In Progress]" {
+		t.Errorf("From(Pending) = %s, want [In Progress]", got)
+	}
+
+	for _, spec := range []string{"Pending", "Pending->Done", "Archived->Pending"} {
+		if _, err := parseTransitions(spec); err == nil {
+			t.Errorf("parseTransitions(%q) accepted an invalid graph", spec)
+		}
+	}
+}
+
+func TestDefaultTransitionsNeedReopen(t *testing.T) {
+	for _, status := range taskStatuses {
+		if status != StatusCompleted && !defaultStatusTransitions.Allows(status, StatusCompleted) {
+			t.Errorf("%s tasks cannot be completed", status)
+		}
+	}
+	if len(defaultStatusTransitions.From(StatusCompleted)) != 0 {
+		t.Errorf("Completed tasks can leave without reopen: %v", defaultStatusTransitions.From(StatusCompleted))
+	}
+}
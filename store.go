@@ -0,0 +1,481 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrTaskNotFound is returned when no task has the requested ID.
+	ErrTaskNotFound = errors.New("task not found")
+	// ErrTaskExists is returned by Create when the task ID is already taken.
+	ErrTaskExists = errors.New("task already exists")
+	// ErrConstraintViolation is returned when a task breaks a rule the
+	// storage enforces on its own, such as the priority range.
+	ErrConstraintViolation = errors.New("task violates a storage constraint")
+	// ErrIdempotencyKeyNotFound is returned when no request was recorded
+	// under an idempotency key.
+	ErrIdempotencyKeyNotFound = errors.New("idempotency key not found")
+	// ErrIdempotencyKeyExists is returned when reserving a key that another
+	// request already holds.
+	ErrIdempotencyKeyExists = errors.New("idempotency key already in use")
+	// ErrUserNotFound is returned when no user matches a name, ID, token or
+	// session.
+	ErrUserNotFound = errors.New("user not found")
+	// ErrUserExists is returned by CreateUser when the username is taken.
+	ErrUserExists = errors.New("user already exists")
+	// ErrTokenNotFound is returned when a user has no API token with the
+	// requested ID.
+	ErrTokenNotFound = errors.New("API token not found")
+	// ErrProjectNotFound is returned when no project has the requested ID,
+	// including when a task is filed under one.
+	ErrProjectNotFound = errors.New("project not found")
+	// ErrProjectExists is returned when a user already has a project with
+	// the same name.
+	ErrProjectExists = errors.New("project already exists")
+	// ErrProjectNotEmpty is returned when deleting a project that still
+	// has tasks without cascading to them.
+	ErrProjectNotEmpty = errors.New("project has tasks")
+	// ErrParentNotFound is returned when a task is made a subtask of a
+	// task that does not exist.
+	ErrParentNotFound = errors.New("parent task not found")
+	// ErrCycle is returned when a parent or blocker would make a task
+	// depend on itself.
+	ErrCycle = errors.New("task relation would form a cycle")
+	// ErrDependencyNotFound is returned when removing a blocker a task
+	// does not have.
+	ErrDependencyNotFound = errors.New("dependency not found")
+	// ErrTaskNotDeleted is returned when restoring a task that is not in
+	// the trash.
+	ErrTaskNotDeleted = errors.New("task is not deleted")
+	// ErrParentDeleted is returned when restoring a subtask whose parent
+	// is still in the trash.
+	ErrParentDeleted = errors.New("parent task is deleted")
+	// ErrVersionConflict is returned when updating a task that changed
+	// since the version the caller read.
+	ErrVersionConflict = errors.New("task version conflict")
+	// ErrWebhookNotFound is returned when no webhook has the requested ID.
+	ErrWebhookNotFound = errors.New("webhook not found")
+)
+
+// Store is everything the App needs from a storage backend.
+type Store interface {
+	TaskStore
+	IdempotencyStore
+	UserStore
+	ProjectStore
+	TagStore
+	DependencyStore
+	HistoryStore
+	ReminderStore
+	WebhookStore
+
+	// Atomically runs fn with a Store whose writes are kept only if fn
+	// returns nil, and which nobody else sees before then. The Store must
+	// not be used after fn returns.
+	Atomically(fn func(tx Store) error) error
+}
+
+// TaskStore persists tasks. The HTTP handlers only talk to this interface,
+// so they behave the same whichever backend is configured.
+//
+// Create, Update and Delete record what they change in the history of the
+// task, in the same transaction, as done by the user actorID. Zero stands
+// for the server itself. Every change recorded also queues a delivery to
+// each webhook subscribed to it, in that transaction too.
+type TaskStore interface {
+	// Create stores a new task and returns it as stored. A zero ID is
+	// replaced by the next value of a sequence that never reuses IDs, even
+	// of deleted tasks. Every backend rejects priorities outside 1-3 with
+	// ErrConstraintViolation and unknown projects with ErrProjectNotFound.
+	// A task filed under a project without a position goes to the end of
+	// the project. A missing or deleted parent task is ErrParentNotFound.
+	// DeletedAt is ignored: new tasks are never in the trash. The first
+	// version of a task is 1.
+	Create(task Task, actorID int) (Task, error)
+	// Get returns the task with the given ID, even one in the trash, or
+	// ErrTaskNotFound.
+	Get(id int) (Task, error)
+	// GetByUID returns the task with the given UID, even one in the trash,
+	// or ErrTaskNotFound.
+	GetByUID(uid string) (Task, error)
+	// List returns the tasks matching q in the order it asks for.
+	List(q TaskQuery) ([]Task, error)
+	// Update overwrites every field of an existing task, identified by its
+	// ID, and returns it as stored. Positions are assigned as by Create.
+	// A parent that is the task itself or one of its subtasks is ErrCycle.
+	// DeletedAt is left as stored. A non-zero Version must be the stored
+	// one, or ErrVersionConflict is returned; the stored task gets the
+	// next version. Every other change to a task bumps its version too.
+	Update(task Task, actorID int) (Task, error)
+	// Delete moves the task with the given ID and its subtasks to the
+	// trash, or returns ErrTaskNotFound. Their dependencies are kept for
+	// when they are restored. A non-zero version must be the stored one,
+	// or ErrVersionConflict is returned.
+	Delete(id, version, actorID int) error
+	// Restore takes a task out of the trash, together with the subtasks
+	// deleted along with it, and returns it. It returns ErrTaskNotDeleted
+	// if the task is not in the trash and ErrParentDeleted if its parent
+	// still is.
+	Restore(id, actorID int) (Task, error)
+	// PurgeDeletedTasks removes for good the tasks put in the trash before
+	// the cutoff and returns how many were removed. Their history is kept.
+	PurgeDeletedTasks(before time.Time) (int, error)
+}
+
+// SortKey orders tasks by one field. Field is one of sortableFields.
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// defaultSort is the order of task lists that do not ask for one: highest
+// priority first.
+var defaultSort = []SortKey{{Field: "priority"}}
+
+// TaskQuery selects and orders tasks for TaskStore.List. Zero values do not
+// filter.
+type TaskQuery struct {
+	// OwnerID keeps only the tasks of one user.
+	OwnerID int
+	// ProjectID keeps only the tasks filed under one project.
+	ProjectID int
+	// ParentID keeps only the subtasks of one task.
+	ParentID int
+	Statuses []string
+	// ExcludeStatuses drops tasks in any of these statuses.
+	ExcludeStatuses []string
+	Priorities      []int
+	// DueFrom keeps tasks due at or after it, DueBefore those due strictly
+	// before it.
+	DueFrom   *DueBound
+	DueBefore *DueBound
+	// Search matches tasks whose title or description contains it,
+	// ignoring case.
+	Search string
+	// Tags keeps tasks that have any of these tags, or all of them when
+	// AllTags is set.
+	Tags    []string
+	AllTags bool
+	// Deleted lists the tasks in the trash instead of the others.
+	Deleted bool
+	// Sort defaults to defaultSort. Ties are always broken by ascending ID,
+	// so the order is total and pages never overlap.
+	Sort []SortKey
+	// After continues a previous page: only tasks that sort strictly after
+	// it are returned.
+	After *Task
+	// Limit caps the number of tasks returned; zero means no limit.
+	Limit int
+}
+
+// orderKeys returns the sort keys of q with the ID tie-breaker appended.
+func (q TaskQuery) orderKeys() []SortKey {
+	keys := q.Sort
+	if len(keys) == 0 {
+		keys = defaultSort
+	}
+	for _, key := range keys {
+		if key.Field == "id" {
+			return keys
+		}
+	}
+	return append(keys[:len(keys):len(keys)], SortKey{Field: "id"})
+}
+
+// IdempotencyRecord is the outcome of a request made with an
+// Idempotency-Key header. StatusCode is zero while the request is still
+// being processed.
+type IdempotencyRecord struct {
+	Key         string
+	RequestHash string
+	StatusCode  int
+	Location    string
+	ETag        string
+	Body        []byte
+	CreatedAt   time.Time
+}
+
+// IdempotencyStore remembers responses to requests carrying an
+// Idempotency-Key so that retries can be answered without repeating them.
+type IdempotencyStore interface {
+	// GetIdempotencyKey returns the record for key or
+	// ErrIdempotencyKeyNotFound.
+	GetIdempotencyKey(key string) (IdempotencyRecord, error)
+	// ReserveIdempotencyKey records an in-progress request, or returns
+	// ErrIdempotencyKeyExists if the key is already recorded.
+	ReserveIdempotencyKey(rec IdempotencyRecord) error
+	// CompleteIdempotencyKey stores the response of a reserved request.
+	CompleteIdempotencyKey(rec IdempotencyRecord) error
+	// ReleaseIdempotencyKey forgets a key so the request can be retried.
+	ReleaseIdempotencyKey(key string) error
+	// PurgeIdempotencyKeys forgets every key created before the cutoff and
+	// returns how many were removed.
+	PurgeIdempotencyKeys(before time.Time) (int, error)
+}
+
+// User is someone who can sign in. PasswordHash is never sent to clients.
+type User struct {
+	ID           int    `json:"id"`
+	Username     string `json:"username"`
+	PasswordHash string `json:"-"`
+	// Role is one of RoleViewer, RoleEditor or RoleAdmin. Stores save
+	// users without one as editors.
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// APIToken is a bearer token of a user. Only a hash of the token is stored;
+// the token itself is shown once, when it is created.
+type APIToken struct {
+	ID     int    `json:"id"`
+	UserID int    `json:"-"`
+	Name   string `json:"name"`
+	Hash   string `json:"-"`
+	// Scope is TokenScopeAPI or TokenScopeCalendar. Stores save tokens
+	// without one as API tokens.
+	Scope      string     `json:"scope"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// Session is a signed-in browser, identified by the hash of its cookie.
+type Session struct {
+	Hash      string
+	UserID    int
+	ExpiresAt time.Time
+}
+
+// UserStore persists users and the credentials they authenticate with.
+type UserStore interface {
+	// CreateUser stores a new user, or returns ErrUserExists if the
+	// username is taken.
+	CreateUser(user User) (User, error)
+	// GetUser returns the user with the given ID or ErrUserNotFound.
+	GetUser(id int) (User, error)
+	// GetUserByName returns the user with the given username or
+	// ErrUserNotFound.
+	GetUserByName(username string) (User, error)
+	// SetUserRole changes the role of a user or returns ErrUserNotFound.
+	SetUserRole(id int, role string) error
+
+	// CreateToken stores a new API token and returns it with its ID.
+	CreateToken(token APIToken) (APIToken, error)
+	// ListTokens returns the API tokens of a user, oldest first.
+	ListTokens(userID int) ([]APIToken, error)
+	// DeleteToken revokes an API token of a user or returns
+	// ErrTokenNotFound.
+	DeleteToken(userID, id int) error
+	// UserForToken returns the owner of the token with the given hash and
+	// scope and records that the token was used at now, or returns
+	// ErrUserNotFound.
+	UserForToken(hash, scope string, now time.Time) (User, error)
+
+	// CreateSession stores a new session.
+	CreateSession(session Session) error
+	// UserForSession returns the user of an unexpired session or
+	// ErrUserNotFound.
+	UserForSession(hash string, now time.Time) (User, error)
+	// DeleteSession ends a session. Ending an unknown session is not an
+	// error.
+	DeleteSession(hash string) error
+	// PurgeSessions removes the sessions that expired before the cutoff
+	// and returns how many were removed.
+	PurgeSessions(before time.Time) (int, error)
+}
+
+// Project groups tasks, such as the board of one team. Tasks in a project
+// are kept in the order of their Position.
+type Project struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	OwnerID     int       `json:"owner_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ProjectStore persists projects.
+type ProjectStore interface {
+	// CreateProject stores a new project, or returns ErrProjectExists if
+	// its owner has another project with the same name and ErrUserNotFound
+	// if the owner does not exist.
+	CreateProject(project Project) (Project, error)
+	// GetProject returns the project with the given ID or
+	// ErrProjectNotFound.
+	GetProject(id int) (Project, error)
+	// ListProjects returns every project, by ID.
+	ListProjects() ([]Project, error)
+	// UpdateProject overwrites the name and description of a project.
+	UpdateProject(project Project) (Project, error)
+	// DeleteProject removes a project. With cascade its tasks go to the
+	// trash, as by Delete done by actorID; otherwise a project that has
+	// tasks is kept and ErrProjectNotEmpty returned. Its tasks in the trash
+	// never keep it. Either way its tasks leave the project, so that they
+	// can be restored without it.
+	DeleteProject(id int, cascade bool, actorID int) error
+}
+
+// Tag is a label in use on tasks, with the number of tasks that have it.
+type Tag struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// TagStore manages the tags of tasks as a whole. Tags are attached to and
+// removed from single tasks through the Tags field of Task.
+type TagStore interface {
+	// ListTags returns the tags on the tasks of one user, or of every user
+	// when ownerID is zero, by name. Tasks in the trash are not counted.
+	ListTags(ownerID int) ([]Tag, error)
+	// MergeTags replaces the tags in from with into on the tasks of one
+	// user, or of every user when ownerID is zero, and returns how many
+	// tasks changed. Renaming a tag is merging it into a new name. The
+	// change is recorded in the history of each task as done by actorID.
+	// Tasks in the trash are changed too, so they come back renamed.
+	MergeTags(ownerID int, from []string, into string, actorID int) (int, error)
+}
+
+// DependencyStore records which tasks block which. A task is blocked by
+// the tasks it depends on until they are completed.
+type DependencyStore interface {
+	// AddBlocker records that blockerID blocks taskID. Adding a dependency
+	// twice does nothing. It returns ErrTaskNotFound if either task is
+	// missing and ErrCycle if taskID already blocks blockerID, directly or
+	// through other tasks, or is blockerID.
+	AddBlocker(taskID, blockerID int) error
+	// RemoveBlocker drops a dependency or returns ErrDependencyNotFound.
+	RemoveBlocker(taskID, blockerID int) error
+	// ListBlockers returns the tasks blocking taskID, by ID, leaving out
+	// those in the trash.
+	ListBlockers(taskID int) ([]Task, error)
+}
+
+// The actions a HistoryEntry records.
+const (
+	HistoryCreate = "create"
+	HistoryUpdate = "update"
+	HistoryDelete = "delete"
+)
+
+// HistoryEntry records one change to a task: who made it, when, and the
+// fields it changed.
+type HistoryEntry struct {
+	ID      int           `json:"id"`
+	TaskID  int           `json:"task_id"`
+	Action  string        `json:"action"`
+	ActorID int           `json:"actor_id,omitempty"`
+	At      time.Time     `json:"at"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// FieldChange is a task field changed by a HistoryEntry, with its JSON
+// values before and after. A value is null when the task did not have the
+// field, as before it was created.
+type FieldChange struct {
+	Field string          `json:"field"`
+	Old   json.RawMessage `json:"old"`
+	New   json.RawMessage `json:"new"`
+}
+
+// HistoryStore reads the history TaskStore writes. Entries are never
+// changed or removed, and outlive the task they are about.
+type HistoryStore interface {
+	// TaskHistory returns the changes made to a task, oldest first.
+	TaskHistory(taskID int) ([]HistoryEntry, error)
+}
+
+// ReminderStore remembers the reminders of due dates that were sent, so
+// that each is sent once.
+type ReminderStore interface {
+	// ClaimReminder records at now that the reminder of a task due at
+	// dueDate, threshold before it is due, is being sent, or returns false
+	// if it already was. Moving the due date of a task gives it new
+	// reminders.
+	ClaimReminder(taskID int, dueDate string, threshold time.Duration, now time.Time) (bool, error)
+	// ReleaseReminder forgets a claimed reminder that could not be sent,
+	// so that it is sent again.
+	ReleaseReminder(taskID int, dueDate string, threshold time.Duration) error
+}
+
+// The events webhooks can subscribe to.
+const (
+	EventTaskCreated   = "task.created"
+	EventTaskUpdated   = "task.updated"
+	EventTaskCompleted = "task.completed"
+	EventTaskDeleted   = "task.deleted"
+)
+
+// Webhook is a subscription of a user to the events of the tasks they can
+// read: their own, or every task for admins. Secret signs the deliveries
+// and is only shown when the webhook is created.
+type Webhook struct {
+	ID        int       `json:"id"`
+	OwnerID   int       `json:"owner_id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"-"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// The states of a WebhookDelivery.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is one event queued for one webhook, together with how
+// sending it went so far.
+type WebhookDelivery struct {
+	ID        int             `json:"id"`
+	WebhookID int             `json:"webhook_id"`
+	Event     string          `json:"event"`
+	TaskID    int             `json:"task_id"`
+	Payload   json.RawMessage `json:"payload"`
+	Status    string          `json:"status"`
+	Attempts  int             `json:"attempts"`
+	// NextAttemptAt is when a pending delivery is sent next.
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	// ResponseCode and Error describe the last attempt. Error is empty
+	// when it succeeded.
+	ResponseCode int        `json:"response_code,omitempty"`
+	Error        string     `json:"error,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	DeliveredAt  *time.Time `json:"delivered_at,omitempty"`
+}
+
+// WebhookStore persists webhooks and the outbox of their deliveries,
+// which TaskStore fills.
+type WebhookStore interface {
+	// CreateWebhook stores a new webhook, or returns ErrUserNotFound if its
+	// owner does not exist.
+	CreateWebhook(hook Webhook) (Webhook, error)
+	// GetWebhook returns the webhook with the given ID or
+	// ErrWebhookNotFound.
+	GetWebhook(id int) (Webhook, error)
+	// ListWebhooks returns the webhooks of a user, or of every user when
+	// ownerID is zero, by ID.
+	ListWebhooks(ownerID int) ([]Webhook, error)
+	// UpdateWebhook overwrites the URL, events and active flag of a
+	// webhook.
+	UpdateWebhook(hook Webhook) (Webhook, error)
+	// DeleteWebhook removes a webhook along with its deliveries.
+	DeleteWebhook(id int) error
+
+	// ClaimWebhookDeliveries returns up to limit pending deliveries due at
+	// now, oldest first, and puts their next attempt off until now+lease
+	// so that nobody else sends them meanwhile.
+	ClaimWebhookDeliveries(now time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error)
+	// RecordWebhookAttempt stores the status, attempts, next attempt,
+	// response code, error and delivery time of a delivery that was sent.
+	RecordWebhookAttempt(delivery WebhookDelivery) error
+	// ListWebhookDeliveries returns the latest limit deliveries of a
+	// webhook, newest first.
+	ListWebhookDeliveries(webhookID, limit int) ([]WebhookDelivery, error)
+	// PurgeWebhookDeliveries removes the deliveries that were delivered or
+	// failed and created before the cutoff, and returns how many were
+	// removed.
+	PurgeWebhookDeliveries(before time.Time) (int, error)
+}
@@ -0,0 +1,1098 @@
+package main
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a TaskStore that keeps tasks in process memory. It is safe
+// for concurrent use and loses everything when the process exits.
+type MemoryStore struct {
+	mu         sync.RWMutex
+	tasks      map[int]Task
+	lastID     int
+	idempotent map[string]IdempotencyRecord
+
+	users       map[int]User
+	lastUserID  int
+	tokens      map[int]APIToken
+	lastTokenID int
+	sessions    map[string]Session
+
+	projects      map[int]Project
+	lastProjectID int
+
+	// blockers maps a task ID to the IDs of the tasks blocking it.
+	blockers map[int]map[int]bool
+
+	history       map[int][]HistoryEntry
+	lastHistoryID int
+
+	// reminders holds when each reminder was claimed.
+	reminders map[reminderKey]time.Time
+
+	webhooks      map[int]Webhook
+	lastWebhookID int
+	// deliveries is the outbox of webhook deliveries.
+	deliveries     map[int]WebhookDelivery
+	lastDeliveryID int
+}
+
+// reminderKey identifies a reminder of MemoryStore.
+type reminderKey struct {
+	taskID    int
+	dueDate   string
+	threshold time.Duration
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		tasks:      make(map[int]Task),
+		idempotent: make(map[string]IdempotencyRecord),
+		users:      make(map[int]User),
+		tokens:     make(map[int]APIToken),
+		sessions:   make(map[string]Session),
+		projects:   make(map[int]Project),
+		blockers:   make(map[int]map[int]bool),
+		history:    make(map[int][]HistoryEntry),
+		reminders:  make(map[reminderKey]time.Time),
+		webhooks:   make(map[int]Webhook),
+		deliveries: make(map[int]WebhookDelivery),
+	}
+}
+
+// Atomically runs fn on a copy of the store, which replaces the store if
+// fn succeeds. The store is locked meanwhile.
+func (s *MemoryStore) Atomically(fn func(tx Store) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := &MemoryStore{
+		tasks:          maps.Clone(s.tasks),
+		lastID:         s.lastID,
+		idempotent:     maps.Clone(s.idempotent),
+		users:          maps.Clone(s.users),
+		lastUserID:     s.lastUserID,
+		tokens:         maps.Clone(s.tokens),
+		lastTokenID:    s.lastTokenID,
+		sessions:       maps.Clone(s.sessions),
+		projects:       maps.Clone(s.projects),
+		lastProjectID:  s.lastProjectID,
+		blockers:       make(map[int]map[int]bool, len(s.blockers)),
+		history:        make(map[int][]HistoryEntry, len(s.history)),
+		lastHistoryID:  s.lastHistoryID,
+		reminders:      maps.Clone(s.reminders),
+		webhooks:       maps.Clone(s.webhooks),
+		lastWebhookID:  s.lastWebhookID,
+		deliveries:     maps.Clone(s.deliveries),
+		lastDeliveryID: s.lastDeliveryID,
+	}
+	for id, blockers := range s.blockers {
+		tx.blockers[id] = maps.Clone(blockers)
+	}
+	for id, entries := range s.history {
+		tx.history[id] = slices.Clip(entries)
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	s.tasks, s.lastID, s.idempotent = tx.tasks, tx.lastID, tx.idempotent
+	s.users, s.lastUserID, s.tokens, s.lastTokenID, s.sessions = tx.users, tx.lastUserID, tx.tokens, tx.lastTokenID, tx.sessions
+	s.projects, s.lastProjectID = tx.projects, tx.lastProjectID
+	s.blockers, s.history, s.lastHistoryID = tx.blockers, tx.history, tx.lastHistoryID
+	s.reminders = tx.reminders
+	s.webhooks, s.lastWebhookID, s.deliveries, s.lastDeliveryID = tx.webhooks, tx.lastWebhookID, tx.deliveries, tx.lastDeliveryID
+	return nil
+}
+
+// checkConstraints mirrors the CHECK constraints of the SQL schema.
+func checkConstraints(task Task) error {
+	if task.Priority < 1 || task.Priority > 3 {
+		return ErrConstraintViolation
+	}
+	return nil
+}
+
+func (s *MemoryStore) Create(task Task, actorID int) (Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := checkConstraints(task); err != nil {
+		return Task{}, err
+	}
+	if task.ID == 0 {
+		task.ID = s.lastID + 1
+	}
+	if _, ok := s.tasks[task.ID]; ok {
+		return Task{}, ErrTaskExists
+	}
+	if err := s.placeInProject(&task); err != nil {
+		return Task{}, err
+	}
+	if err := s.checkParent(task); err != nil {
+		return Task{}, err
+	}
+	task.Tags = normalizeTags(task.Tags)
+	task.DeletedAt = nil
+	task.Version = 1
+	if task.ID > s.lastID {
+		s.lastID = task.ID
+	}
+	s.tasks[task.ID] = task
+	s.record(task.ID, HistoryCreate, actorID, diffTasks(nil, &task))
+	return task, nil
+}
+
+// record appends a change to the history of a task and queues its webhook
+// deliveries.
+func (s *MemoryStore) record(taskID int, action string, actorID int, changes []FieldChange) {
+	s.lastHistoryID++
+	entry := HistoryEntry{
+		ID:      s.lastHistoryID,
+		TaskID:  taskID,
+		Action:  action,
+		ActorID: actorID,
+		At:      unixNow(),
+		Changes: changes,
+	}
+	s.history[taskID] = append(s.history[taskID], entry)
+	s.queueWebhooks(entry)
+}
+
+// queueWebhooks adds a delivery of the change entry records to the outbox
+// for every active webhook subscribed to it whose owner can read the task.
+func (s *MemoryStore) queueWebhooks(entry HistoryEntry) {
+	task := s.tasks[entry.TaskID]
+	event := eventName(entry)
+	for _, id := range slices.Sorted(maps.Keys(s.webhooks)) {
+		hook := s.webhooks[id]
+		if !hook.Active || !slices.Contains(hook.Events, event) ||
+			hook.OwnerID != task.OwnerID && s.users[hook.OwnerID].Role != RoleAdmin {
+			continue
+		}
+		delivery := newDelivery(hook.ID, entry, task)
+		s.lastDeliveryID++
+		delivery.ID = s.lastDeliveryID
+		s.deliveries[delivery.ID] = delivery
+	}
+}
+
+// unixNow returns the current time at the precision of the SQL stores, which
+// keep unix seconds.
+func unixNow() time.Time {
+	return time.Unix(time.Now().Unix(), 0)
+}
+
+func (s *MemoryStore) Get(id int) (Task, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	task, ok := s.tasks[id]
+	if !ok {
+		return Task{}, ErrTaskNotFound
+	}
+	return task, nil
+}
+
+func (s *MemoryStore) GetByUID(uid string) (Task, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, task := range s.tasks {
+		if task.UID != "" && task.UID == uid {
+			return task, nil
+		}
+	}
+	return Task{}, ErrTaskNotFound
+}
+
+func (s *MemoryStore) List(q TaskQuery) ([]Task, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := q.orderKeys()
+	tasks := make([]Task, 0, len(s.tasks))
+	for _, task := range s.tasks {
+		if !matchesQuery(task, q) {
+			continue
+		}
+		if q.After != nil && compareTasks(task, *q.After, keys) <= 0 {
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+	sort.Slice(tasks, func(i, j int) bool { return compareTasks(tasks[i], tasks[j], keys) < 0 })
+	if q.Limit > 0 && len(tasks) > q.Limit {
+		tasks = tasks[:q.Limit]
+	}
+	return tasks, nil
+}
+
+// matchesQuery reports whether task passes the filters of q.
+func matchesQuery(task Task, q TaskQuery) bool {
+	if q.OwnerID != 0 && task.OwnerID != q.OwnerID {
+		return false
+	}
+	if q.ProjectID != 0 && task.ProjectID != q.ProjectID {
+		return false
+	}
+	if q.ParentID != 0 && task.ParentID != q.ParentID {
+		return false
+	}
+	if (task.DeletedAt != nil) != q.Deleted {
+		return false
+	}
+	if len(q.Statuses) > 0 && !slices.Contains(q.Statuses, task.Status) {
+		return false
+	}
+	if slices.Contains(q.ExcludeStatuses, task.Status) {
+		return false
+	}
+	if len(q.Priorities) > 0 && !slices.Contains(q.Priorities, task.Priority) {
+		return false
+	}
+	if q.DueFrom != nil && dueBefore(task, *q.DueFrom) {
+		return false
+	}
+	if q.DueBefore != nil && !dueBefore(task, *q.DueBefore) {
+		return false
+	}
+	if len(q.Tags) > 0 {
+		has := func(tag string) bool { return slices.Contains(task.Tags, tag) }
+		matched := slices.ContainsFunc(q.Tags, has)
+		if q.AllTags {
+			matched = allOf(q.Tags, has)
+		}
+		if !matched {
+			return false
+		}
+	}
+	if q.Search != "" {
+		search := strings.ToLower(q.Search)
+		if !strings.Contains(strings.ToLower(task.Title), search) && !strings.Contains(strings.ToLower(task.Description), search) {
+			return false
+		}
+	}
+	return true
+}
+
+// allOf reports whether every element of s satisfies f.
+func allOf[T any](s []T, f func(T) bool) bool {
+	for _, v := range s {
+		if !f(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// dueBefore reports whether task is due strictly before bound.
+func dueBefore(task Task, bound DueBound) bool {
+	due, allDay := dueKey(task)
+	if allDay {
+		return due.Before(bound.Day)
+	}
+	return due.Before(bound.At)
+}
+
+// compareTasks orders a and b by keys, returning a negative number when a
+// sorts first.
+func compareTasks(a, b Task, keys []SortKey) int {
+	for _, key := range keys {
+		var c int
+		switch key.Field {
+		case "id":
+			c = cmp.Compare(a.ID, b.ID)
+		case "title":
+			c = strings.Compare(a.Title, b.Title)
+		case "due_date":
+			ta, _ := dueKey(a)
+			tb, _ := dueKey(b)
+			c = ta.Compare(tb)
+		case "priority":
+			c = cmp.Compare(a.Priority, b.Priority)
+		case "status":
+			c = strings.Compare(a.Status, b.Status)
+		case "position":
+			c = cmp.Compare(a.Position, b.Position)
+		}
+		if key.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func (s *MemoryStore) Update(task Task, actorID int) (Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := checkConstraints(task); err != nil {
+		return Task{}, err
+	}
+	old, ok := s.tasks[task.ID]
+	if !ok {
+		return Task{}, ErrTaskNotFound
+	}
+	if task.Version != 0 && task.Version != old.Version {
+		return Task{}, ErrVersionConflict
+	}
+	if err := s.placeInProject(&task); err != nil {
+		return Task{}, err
+	}
+	if err := s.checkParent(task); err != nil {
+		return Task{}, err
+	}
+	task.Tags = normalizeTags(task.Tags)
+	task.UID = old.UID
+	task.DeletedAt = old.DeletedAt
+	task.Version = old.Version + 1
+	s.tasks[task.ID] = task
+	if changes := diffTasks(&old, &task); len(changes) > 0 {
+		s.record(task.ID, HistoryUpdate, actorID, changes)
+	}
+	return task, nil
+}
+
+// placeInProject checks the project of task exists and, when the task has
+// no position, moves it to the end of the project.
+func (s *MemoryStore) placeInProject(task *Task) error {
+	if task.ProjectID == 0 {
+		return nil
+	}
+	if _, ok := s.projects[task.ProjectID]; !ok {
+		return ErrProjectNotFound
+	}
+	if task.Position == 0 {
+		for _, other := range s.tasks {
+			if other.ProjectID == task.ProjectID && other.ID != task.ID {
+				task.Position = max(task.Position, other.Position)
+			}
+		}
+		task.Position++
+	}
+	return nil
+}
+
+// checkParent rejects a parent that is missing, deleted or would make task
+// its own ancestor.
+func (s *MemoryStore) checkParent(task Task) error {
+	if task.ParentID == 0 {
+		return nil
+	}
+	if parent, ok := s.tasks[task.ParentID]; !ok || parent.DeletedAt != nil {
+		return ErrParentNotFound
+	}
+	for id := task.ParentID; id != 0; id = s.tasks[id].ParentID {
+		if id == task.ID {
+			return ErrCycle
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Delete(id, version, actorID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task, ok := s.tasks[id]
+	if !ok || task.DeletedAt != nil {
+		return ErrTaskNotFound
+	}
+	if version != 0 && version != task.Version {
+		return ErrVersionConflict
+	}
+	s.trash(id, unixNow(), 0, actorID)
+	return nil
+}
+
+// trash moves a task and its subtasks at any depth that are not deleted to
+// the trash at deletedAt. Those in the project projectID leave it.
+func (s *MemoryStore) trash(id int, deletedAt time.Time, projectID, actorID int) {
+	for _, old := range s.subtree(id, nil) {
+		task := old
+		task.DeletedAt = &deletedAt
+		if task.ProjectID == projectID {
+			task.ProjectID = 0
+		}
+		task.Version++
+		s.tasks[task.ID] = task
+		s.record(task.ID, HistoryDelete, actorID, diffTasks(&old, &task))
+	}
+}
+
+func (s *MemoryStore) Restore(id, actorID int) (Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task, ok := s.tasks[id]
+	if !ok {
+		return Task{}, ErrTaskNotFound
+	}
+	if task.DeletedAt == nil {
+		return Task{}, ErrTaskNotDeleted
+	}
+	if parent, ok := s.tasks[task.ParentID]; ok && parent.DeletedAt != nil {
+		return Task{}, ErrParentDeleted
+	}
+	for _, old := range s.subtree(id, task.DeletedAt) {
+		restored := old
+		restored.DeletedAt = nil
+		restored.Version++
+		s.tasks[restored.ID] = restored
+		s.record(restored.ID, HistoryUpdate, actorID, diffTasks(&old, &restored))
+	}
+	return s.tasks[id], nil
+}
+
+// subtree returns a task and its subtasks at any depth that were deleted
+// at deletedAt, or that are not deleted when it is nil, by ID. Subtasks in
+// another state are left out along with their own subtasks.
+func (s *MemoryStore) subtree(id int, deletedAt *time.Time) []Task {
+	tasks := []Task{s.tasks[id]}
+	for i := 0; i < len(tasks); i++ {
+		for _, child := range s.tasks {
+			if child.ParentID != tasks[i].ID {
+				continue
+			}
+			if deletedAt == nil && child.DeletedAt == nil ||
+				deletedAt != nil && child.DeletedAt != nil && child.DeletedAt.Equal(*deletedAt) {
+				tasks = append(tasks, child)
+			}
+		}
+	}
+	slices.SortFunc(tasks, func(a, b Task) int { return cmp.Compare(a.ID, b.ID) })
+	return tasks
+}
+
+func (s *MemoryStore) PurgeDeletedTasks(before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var purged []int
+	for id, task := range s.tasks {
+		if task.DeletedAt != nil && task.DeletedAt.Before(before) {
+			purged = append(purged, id)
+		}
+	}
+	for _, id := range purged {
+		if _, ok := s.tasks[id]; ok {
+			s.deleteTask(id)
+		}
+	}
+	return len(purged), nil
+}
+
+// deleteTask removes a task together with its subtasks and dependencies,
+// as the foreign keys of the SQL schema do.
+func (s *MemoryStore) deleteTask(id int) {
+	delete(s.tasks, id)
+	delete(s.blockers, id)
+	for _, blockers := range s.blockers {
+		delete(blockers, id)
+	}
+	maps.DeleteFunc(s.reminders, func(key reminderKey, _ time.Time) bool { return key.taskID == id })
+	for childID, child := range s.tasks {
+		if child.ParentID == id {
+			s.deleteTask(childID)
+		}
+	}
+}
+
+func (s *MemoryStore) GetIdempotencyKey(key string) (IdempotencyRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rec, ok := s.idempotent[key]
+	if !ok {
+		return IdempotencyRecord{}, ErrIdempotencyKeyNotFound
+	}
+	return rec, nil
+}
+
+func (s *MemoryStore) ReserveIdempotencyKey(rec IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.idempotent[rec.Key]; ok {
+		return ErrIdempotencyKeyExists
+	}
+	s.idempotent[rec.Key] = rec
+	return nil
+}
+
+func (s *MemoryStore) CompleteIdempotencyKey(rec IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.idempotent[rec.Key]; !ok {
+		return ErrIdempotencyKeyNotFound
+	}
+	s.idempotent[rec.Key] = rec
+	return nil
+}
+
+func (s *MemoryStore) ReleaseIdempotencyKey(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.idempotent, key)
+	return nil
+}
+
+func (s *MemoryStore) PurgeIdempotencyKeys(before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purged := 0
+	for key, rec := range s.idempotent {
+		if rec.CreatedAt.Before(before) {
+			delete(s.idempotent, key)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (s *MemoryStore) CreateUser(user User) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.users {
+		if existing.Username == user.Username {
+			return User{}, ErrUserExists
+		}
+	}
+	if user.Role == "" {
+		user.Role = RoleEditor
+	}
+	s.lastUserID++
+	user.ID = s.lastUserID
+	s.users[user.ID] = user
+	return user, nil
+}
+
+func (s *MemoryStore) GetUser(id int) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (s *MemoryStore) GetUserByName(username string) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if user.Username == username {
+			return user, nil
+		}
+	}
+	return User{}, ErrUserNotFound
+}
+
+func (s *MemoryStore) SetUserRole(id int, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.Role = role
+	s.users[id] = user
+	return nil
+}
+
+func (s *MemoryStore) CreateToken(token APIToken) (APIToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[token.UserID]; !ok {
+		return APIToken{}, ErrUserNotFound
+	}
+	if token.Scope == "" {
+		token.Scope = TokenScopeAPI
+	}
+	s.lastTokenID++
+	token.ID = s.lastTokenID
+	s.tokens[token.ID] = token
+	return token, nil
+}
+
+func (s *MemoryStore) ListTokens(userID int) ([]APIToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tokens := []APIToken{}
+	for _, token := range s.tokens {
+		if token.UserID == userID {
+			tokens = append(tokens, token)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].ID < tokens[j].ID })
+	return tokens, nil
+}
+
+func (s *MemoryStore) DeleteToken(userID, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if token, ok := s.tokens[id]; !ok || token.UserID != userID {
+		return ErrTokenNotFound
+	}
+	delete(s.tokens, id)
+	return nil
+}
+
+func (s *MemoryStore) UserForToken(hash, scope string, now time.Time) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, token := range s.tokens {
+		if token.Hash == hash && token.Scope == scope {
+			token.LastUsedAt = &now
+			s.tokens[id] = token
+			return s.users[token.UserID], nil
+		}
+	}
+	return User{}, ErrUserNotFound
+}
+
+func (s *MemoryStore) CreateSession(session Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[session.UserID]; !ok {
+		return ErrUserNotFound
+	}
+	s.sessions[session.Hash] = session
+	return nil
+}
+
+func (s *MemoryStore) UserForSession(hash string, now time.Time) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.sessions[hash]
+	if !ok || !session.ExpiresAt.After(now) {
+		return User{}, ErrUserNotFound
+	}
+	return s.users[session.UserID], nil
+}
+
+func (s *MemoryStore) DeleteSession(hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, hash)
+	return nil
+}
+
+func (s *MemoryStore) PurgeSessions(before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purged := 0
+	for hash, session := range s.sessions {
+		if session.ExpiresAt.Before(before) {
+			delete(s.sessions, hash)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (s *MemoryStore) CreateProject(project Project) (Project, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[project.OwnerID]; !ok {
+		return Project{}, ErrUserNotFound
+	}
+	for _, existing := range s.projects {
+		if existing.OwnerID == project.OwnerID && existing.Name == project.Name {
+			return Project{}, ErrProjectExists
+		}
+	}
+	s.lastProjectID++
+	project.ID = s.lastProjectID
+	s.projects[project.ID] = project
+	return project, nil
+}
+
+func (s *MemoryStore) GetProject(id int) (Project, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	project, ok := s.projects[id]
+	if !ok {
+		return Project{}, ErrProjectNotFound
+	}
+	return project, nil
+}
+
+func (s *MemoryStore) ListProjects() ([]Project, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	projects := make([]Project, 0, len(s.projects))
+	for _, project := range s.projects {
+		projects = append(projects, project)
+	}
+	slices.SortFunc(projects, func(a, b Project) int { return cmp.Compare(a.ID, b.ID) })
+	return projects, nil
+}
+
+func (s *MemoryStore) UpdateProject(project Project) (Project, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.projects[project.ID]
+	if !ok {
+		return Project{}, ErrProjectNotFound
+	}
+	for _, existing := range s.projects {
+		if existing.ID != project.ID && existing.OwnerID == stored.OwnerID && existing.Name == project.Name {
+			return Project{}, ErrProjectExists
+		}
+	}
+	stored.Name = project.Name
+	stored.Description = project.Description
+	s.projects[project.ID] = stored
+	return stored, nil
+}
+
+func (s *MemoryStore) DeleteProject(id int, cascade bool, actorID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.projects[id]; !ok {
+		return ErrProjectNotFound
+	}
+	var tasks []int
+	for taskID, task := range s.tasks {
+		if task.ProjectID != id {
+			continue
+		}
+		if !cascade && task.DeletedAt == nil {
+			return ErrProjectNotEmpty
+		}
+		tasks = append(tasks, taskID)
+	}
+	slices.Sort(tasks)
+	deletedAt := unixNow()
+	for _, taskID := range tasks {
+		// Subtasks may have gone to the trash with their parent already.
+		if s.tasks[taskID].DeletedAt == nil {
+			s.trash(taskID, deletedAt, id, actorID)
+		}
+	}
+	// Tasks that were in the trash already stay there, without the project.
+	for _, taskID := range tasks {
+		old := s.tasks[taskID]
+		if old.ProjectID != id {
+			continue
+		}
+		task := old
+		task.ProjectID = 0
+		task.Version++
+		s.tasks[taskID] = task
+		s.record(taskID, HistoryUpdate, actorID, diffTasks(&old, &task))
+	}
+	delete(s.projects, id)
+	return nil
+}
+
+func (s *MemoryStore) ListTags(ownerID int) ([]Tag, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, task := range s.tasks {
+		if ownerID != 0 && task.OwnerID != ownerID || task.DeletedAt != nil {
+			continue
+		}
+		for _, tag := range task.Tags {
+			counts[tag]++
+		}
+	}
+	tags := make([]Tag, 0, len(counts))
+	for name, count := range counts {
+		tags = append(tags, Tag{Name: name, Count: count})
+	}
+	slices.SortFunc(tags, func(a, b Tag) int { return strings.Compare(a.Name, b.Name) })
+	return tags, nil
+}
+
+func (s *MemoryStore) MergeTags(ownerID int, from []string, into string, actorID int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := 0
+	for id, task := range s.tasks {
+		if ownerID != 0 && task.OwnerID != ownerID {
+			continue
+		}
+		kept := slices.DeleteFunc(slices.Clone(task.Tags), func(tag string) bool {
+			return tag != into && slices.Contains(from, tag)
+		})
+		if len(kept) == len(task.Tags) {
+			continue
+		}
+		old := task
+		task.Tags = normalizeTags(append(kept, into))
+		task.Version++
+		s.tasks[id] = task
+		s.record(id, HistoryUpdate, actorID, diffTasks(&old, &task))
+		changed++
+	}
+	return changed, nil
+}
+
+func (s *MemoryStore) AddBlocker(taskID, blockerID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tasks[taskID]; !ok {
+		return ErrTaskNotFound
+	}
+	if _, ok := s.tasks[blockerID]; !ok {
+		return ErrTaskNotFound
+	}
+	if s.blockedBy(blockerID, taskID) {
+		return ErrCycle
+	}
+	if s.blockers[taskID] == nil {
+		s.blockers[taskID] = make(map[int]bool)
+	}
+	s.blockers[taskID][blockerID] = true
+	return nil
+}
+
+// blockedBy reports whether taskID is blockerID or is blocked by it,
+// directly or through other tasks.
+func (s *MemoryStore) blockedBy(taskID, blockerID int) bool {
+	seen := make(map[int]bool)
+	pending := []int{taskID}
+	for len(pending) > 0 {
+		id := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if id == blockerID {
+			return true
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		for blocker := range s.blockers[id] {
+			pending = append(pending, blocker)
+		}
+	}
+	return false
+}
+
+func (s *MemoryStore) RemoveBlocker(taskID, blockerID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.blockers[taskID][blockerID] {
+		return ErrDependencyNotFound
+	}
+	delete(s.blockers[taskID], blockerID)
+	return nil
+}
+
+func (s *MemoryStore) ListBlockers(taskID int) ([]Task, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tasks := []Task{}
+	for id := range s.blockers[taskID] {
+		if blocker := s.tasks[id]; blocker.DeletedAt == nil {
+			tasks = append(tasks, blocker)
+		}
+	}
+	slices.SortFunc(tasks, func(a, b Task) int { return cmp.Compare(a.ID, b.ID) })
+	return tasks, nil
+}
+
+func (s *MemoryStore) TaskHistory(taskID int) ([]HistoryEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]HistoryEntry{}, s.history[taskID]...), nil
+}
+
+func (s *MemoryStore) ClaimReminder(taskID int, dueDate string, threshold time.Duration, now time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tasks[taskID]; !ok {
+		return false, ErrTaskNotFound
+	}
+	key := reminderKey{taskID, dueDate, threshold}
+	if _, ok := s.reminders[key]; ok {
+		return false, nil
+	}
+	s.reminders[key] = now
+	return true, nil
+}
+
+func (s *MemoryStore) ReleaseReminder(taskID int, dueDate string, threshold time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.reminders, reminderKey{taskID, dueDate, threshold})
+	return nil
+}
+
+func (s *MemoryStore) CreateWebhook(hook Webhook) (Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[hook.OwnerID]; !ok {
+		return Webhook{}, ErrUserNotFound
+	}
+	s.lastWebhookID++
+	hook.ID = s.lastWebhookID
+	hook.Events = slices.Clone(hook.Events)
+	s.webhooks[hook.ID] = hook
+	return hook, nil
+}
+
+func (s *MemoryStore) GetWebhook(id int) (Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	hook, ok := s.webhooks[id]
+	if !ok {
+		return Webhook{}, ErrWebhookNotFound
+	}
+	return hook, nil
+}
+
+func (s *MemoryStore) ListWebhooks(ownerID int) ([]Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	hooks := []Webhook{}
+	for _, hook := range s.webhooks {
+		if ownerID == 0 || hook.OwnerID == ownerID {
+			hooks = append(hooks, hook)
+		}
+	}
+	slices.SortFunc(hooks, func(a, b Webhook) int { return cmp.Compare(a.ID, b.ID) })
+	return hooks, nil
+}
+
+func (s *MemoryStore) UpdateWebhook(hook Webhook) (Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.webhooks[hook.ID]
+	if !ok {
+		return Webhook{}, ErrWebhookNotFound
+	}
+	stored.URL = hook.URL
+	stored.Events = slices.Clone(hook.Events)
+	stored.Active = hook.Active
+	s.webhooks[hook.ID] = stored
+	return stored, nil
+}
+
+func (s *MemoryStore) DeleteWebhook(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.webhooks[id]; !ok {
+		return ErrWebhookNotFound
+	}
+	delete(s.webhooks, id)
+	maps.DeleteFunc(s.deliveries, func(_ int, delivery WebhookDelivery) bool { return delivery.WebhookID == id })
+	return nil
+}
+
+func (s *MemoryStore) ClaimWebhookDeliveries(now time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	claimed := []WebhookDelivery{}
+	for _, id := range slices.Sorted(maps.Keys(s.deliveries)) {
+		if len(claimed) == limit {
+			break
+		}
+		delivery := s.deliveries[id]
+		if delivery.Status != DeliveryPending || delivery.NextAttemptAt.After(now) {
+			continue
+		}
+		claimed = append(claimed, delivery)
+		next := now.Add(lease)
+		delivery.NextAttemptAt = &next
+		s.deliveries[id] = delivery
+	}
+	return claimed, nil
+}
+
+func (s *MemoryStore) RecordWebhookAttempt(delivery WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.deliveries[delivery.ID]
+	if !ok {
+		// Deleted with its webhook meanwhile.
+		return nil
+	}
+	stored.Status = delivery.Status
+	stored.Attempts = delivery.Attempts
+	stored.NextAttemptAt = delivery.NextAttemptAt
+	stored.ResponseCode = delivery.ResponseCode
+	stored.Error = delivery.Error
+	stored.DeliveredAt = delivery.DeliveredAt
+	s.deliveries[delivery.ID] = stored
+	return nil
+}
+
+func (s *MemoryStore) ListWebhookDeliveries(webhookID, limit int) ([]WebhookDelivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	deliveries := []WebhookDelivery{}
+	for _, delivery := range s.deliveries {
+		if delivery.WebhookID == webhookID {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	slices.SortFunc(deliveries, func(a, b WebhookDelivery) int { return cmp.Compare(b.ID, a.ID) })
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func (s *MemoryStore) PurgeWebhookDeliveries(before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purged := 0
+	for id, delivery := range s.deliveries {
+		if delivery.Status != DeliveryPending && delivery.CreatedAt.Before(before) {
+			delete(s.deliveries, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
@@ -0,0 +1,1439 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Define an interface for database operations used by the SQL stores, so
+// they can run on a *sql.DB or inside a *sql.Tx
+type DBExecutor interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// sqlDialect holds what differs between the databases SQLStore runs on. The
+// queries themselves are shared: both Postgres and SQLite accept $N
+// placeholders and RETURNING clauses. The schema lives in the per-dialect
+// migrations under migrations/.
+type sqlDialect struct {
+	name            string
+	uniqueViolation func(err error) bool
+	checkViolation  func(err error) bool
+	// foreignKeyViolation reports a reference to a missing row.
+	foreignKeyViolation func(err error) bool
+
+	// migrationLock and migrationUnlock guard schema changes against
+	// concurrent migrators. SQLite has no advisory locks and relies on its
+	// database-wide write lock instead.
+	migrationLock   string
+	migrationUnlock string
+
+	// syncIDSequence moves the task ID sequence past an explicitly inserted
+	// ID. SQLite's AUTOINCREMENT does this by itself.
+	syncIDSequence string
+}
+
+// migrationLockKey is an arbitrary constant identifying the calidad
+// migration advisory lock.
+const migrationLockKey = 7247810
+
+var postgresDialect = sqlDialect{
+	name:                "postgres",
+	uniqueViolation:     func(err error) bool { return pqErrorCode(err) == "23505" },
+	checkViolation:      func(err error) bool { return pqErrorCode(err) == "23514" },
+	foreignKeyViolation: func(err error) bool { return pqErrorCode(err) == "23503" },
+	migrationLock:       fmt.Sprintf("SELECT pg_advisory_lock(%d)", migrationLockKey),
+	migrationUnlock:     fmt.Sprintf("SELECT pg_advisory_unlock(%d)", migrationLockKey),
+	syncIDSequence:      `SELECT setval('tasks_id_seq', GREATEST((SELECT MAX(id) FROM tasks), (SELECT last_value FROM tasks_id_seq)))`,
+}
+
+var sqliteDialect = sqlDialect{
+	name: "sqlite",
+	uniqueViolation: func(err error) bool {
+		code := sqliteErrorCode(err)
+		return code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY || code == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+	},
+	checkViolation: func(err error) bool { return sqliteErrorCode(err) == sqlite3.SQLITE_CONSTRAINT_CHECK },
+	foreignKeyViolation: func(err error) bool {
+		return sqliteErrorCode(err) == sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY
+	},
+}
+
+func pqErrorCode(err error) pq.ErrorCode {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code
+	}
+	return ""
+}
+
+func sqliteErrorCode(err error) int {
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code()
+	}
+	return 0
+}
+
+// SQLStore is a TaskStore backed by a tasks table in Postgres or SQLite.
+type SQLStore struct {
+	DB      DBExecutor
+	dialect sqlDialect
+}
+
+func NewPostgresStore(db DBExecutor) *SQLStore {
+	return &SQLStore{DB: db, dialect: postgresDialect}
+}
+
+func NewSQLiteStore(db DBExecutor) *SQLStore {
+	return &SQLStore{DB: db, dialect: sqliteDialect}
+}
+
+// inTx runs fn with a store whose statements share one transaction, which
+// is committed if fn succeeds and rolled back otherwise. A store that is
+// already running inside a transaction uses a savepoint instead.
+func (s *SQLStore) inTx(fn func(tx *SQLStore) error) error {
+	db, ok := s.DB.(*sql.DB)
+	if !ok {
+		if _, err := s.DB.Exec(`SAVEPOINT calidad_tx`); err != nil {
+			return err
+		}
+		if err := fn(s); err != nil {
+			s.DB.Exec(`ROLLBACK TO SAVEPOINT calidad_tx`)
+			return err
+		}
+		_, err := s.DB.Exec(`RELEASE SAVEPOINT calidad_tx`)
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(&SQLStore{DB: tx, dialect: s.dialect}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) Atomically(fn func(tx Store) error) error {
+	return s.inTx(func(tx *SQLStore) error { return fn(tx) })
+}
+
+// translateError maps constraint violations of task writes onto the store
+// errors the handlers understand. The only reference a task makes that
+// callers choose is its project.
+func (s *SQLStore) translateError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case s.dialect.uniqueViolation(err):
+		return ErrTaskExists
+	case s.dialect.checkViolation(err):
+		return ErrConstraintViolation
+	case s.dialect.foreignKeyViolation(err):
+		return ErrProjectNotFound
+	}
+	return err
+}
+
+const taskColumns = `id, title, description, due_date, due_all_day, priority, status, owner_id, project_id, position, parent_id, deleted_at, version, recurrence, uid`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTask(row rowScanner) (Task, error) {
+	var t Task
+	var description sql.NullString
+	var due dueValue
+	var allDay bool
+	var ownerID, projectID, parentID, deletedAt sql.NullInt64
+	var uid sql.NullString
+	err := row.Scan(&t.ID, &t.Title, &description, &due, &allDay, &t.Priority, &t.Status, &ownerID, &projectID, &t.Position, &parentID, &deletedAt, &t.Version, &t.Recurrence, &uid)
+	t.Description = description.String
+	t.UID = uid.String
+	t.OwnerID = int(ownerID.Int64)
+	t.ProjectID = int(projectID.Int64)
+	t.ParentID = int(parentID.Int64)
+	t.DueDate = formatDueDate(time.Time(due), allDay)
+	if deletedAt.Valid {
+		deleted := time.Unix(deletedAt.Int64, 0)
+		t.DeletedAt = &deleted
+	}
+	return t, err
+}
+
+// nullID stores a zero ID as NULL.
+func nullID(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
+
+// nullString stores an empty string as NULL.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// dueColumns returns the values of the due_date and due_all_day columns.
+func dueColumns(task Task) (dueValue, bool) {
+	due, allDay := dueKey(task)
+	return dueValue(due), allDay
+}
+
+// placeInProject moves a task of a project that has no position to the end
+// of the project.
+func (s *SQLStore) placeInProject(task *Task) error {
+	if task.ProjectID == 0 || task.Position != 0 {
+		return nil
+	}
+	return s.DB.QueryRow(`SELECT COALESCE(MAX(position), 0) + 1 FROM tasks WHERE project_id = $1 AND id <> $2`,
+		task.ProjectID, task.ID).Scan(&task.Position)
+}
+
+func (s *SQLStore) Create(task Task, actorID int) (Task, error) {
+	var created Task
+	err := s.inTx(func(tx *SQLStore) error {
+		var err error
+		if created, err = tx.insertTask(task); err != nil {
+			return err
+		}
+		if err := tx.setTags(&created, task.Tags); err != nil {
+			return err
+		}
+		return tx.record(created.ID, HistoryCreate, actorID, diffTasks(nil, &created))
+	})
+	if err != nil {
+		return Task{}, err
+	}
+	return created, nil
+}
+
+// checkParent rejects a parent that is missing, deleted or would make task
+// its own ancestor.
+func (s *SQLStore) checkParent(task Task) error {
+	if task.ParentID == 0 {
+		return nil
+	}
+	var found, deleted, cycle int
+	err := s.DB.QueryRow(`WITH RECURSIVE ancestors (id, parent_id) AS (
+                  SELECT id, parent_id FROM tasks WHERE id = $1
+                  UNION SELECT t.id, t.parent_id FROM tasks t JOIN ancestors a ON t.id = a.parent_id)
+              SELECT COUNT(*), (SELECT COUNT(*) FROM tasks WHERE id = $1 AND deleted_at IS NOT NULL),
+                  COUNT(CASE WHEN id = $2 THEN 1 END) FROM ancestors`, task.ParentID, task.ID).Scan(&found, &deleted, &cycle)
+	switch {
+	case err != nil:
+		return err
+	case found == 0 || deleted > 0:
+		return ErrParentNotFound
+	case cycle > 0:
+		return ErrCycle
+	}
+	return nil
+}
+
+// insertTask adds the row of a new task, without its tags.
+func (s *SQLStore) insertTask(task Task) (Task, error) {
+	due, allDay := dueColumns(task)
+	if err := s.placeInProject(&task); err != nil {
+		return Task{}, err
+	}
+	if err := s.checkParent(task); err != nil {
+		return Task{}, err
+	}
+	if task.ID == 0 {
+		query := `INSERT INTO tasks (title, description, due_date, due_all_day, priority, status, owner_id, project_id, position, parent_id, recurrence, uid)
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING ` + taskColumns
+		created, err := scanTask(s.DB.QueryRow(query, task.Title, task.Description, due, allDay, task.Priority, task.Status,
+			nullID(task.OwnerID), nullID(task.ProjectID), task.Position, nullID(task.ParentID), task.Recurrence, nullString(task.UID)))
+		return created, s.translateError(err)
+	}
+
+	query := `INSERT INTO tasks (id, title, description, due_date, due_all_day, priority, status, owner_id, project_id, position, parent_id, recurrence, uid)
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) RETURNING ` + taskColumns
+	created, err := scanTask(s.DB.QueryRow(query, task.ID, task.Title, task.Description, due, allDay, task.Priority, task.Status,
+		nullID(task.OwnerID), nullID(task.ProjectID), task.Position, nullID(task.ParentID), task.Recurrence, nullString(task.UID)))
+	if err != nil {
+		return Task{}, s.translateError(err)
+	}
+	if s.dialect.syncIDSequence != "" {
+		if _, err := s.DB.Exec(s.dialect.syncIDSequence); err != nil {
+			return Task{}, err
+		}
+	}
+	return created, nil
+}
+
+func (s *SQLStore) Get(id int) (Task, error) {
+	task, err := scanTask(s.DB.QueryRow(`SELECT `+taskColumns+` FROM tasks WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return Task{}, ErrTaskNotFound
+	} else if err != nil {
+		return Task{}, err
+	}
+	tasks := []Task{task}
+	if err := s.loadTags(tasks); err != nil {
+		return Task{}, err
+	}
+	return tasks[0], nil
+}
+
+func (s *SQLStore) GetByUID(uid string) (Task, error) {
+	var id int
+	err := s.DB.QueryRow(`SELECT id FROM tasks WHERE uid = $1`, uid).Scan(&id)
+	if err == sql.ErrNoRows {
+		return Task{}, ErrTaskNotFound
+	} else if err != nil {
+		return Task{}, err
+	}
+	return s.Get(id)
+}
+
+// loadTags fills in the tags of tasks.
+func (s *SQLStore) loadTags(tasks []Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+	index := make(map[int]int, len(tasks))
+	placeholders := make([]string, len(tasks))
+	args := make([]interface{}, len(tasks))
+	for i, task := range tasks {
+		index[task.ID] = i
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = task.ID
+	}
+
+	rows, err := s.DB.Query(`SELECT tt.task_id, g.name FROM task_tags tt JOIN tags g ON g.id = tt.tag_id
+              WHERE tt.task_id IN (`+strings.Join(placeholders, ", ")+`) ORDER BY g.name`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var taskID int
+		var name string
+		if err := rows.Scan(&taskID, &name); err != nil {
+			return err
+		}
+		task := &tasks[index[taskID]]
+		task.Tags = append(task.Tags, name)
+	}
+	return rows.Err()
+}
+
+// setTags replaces the tags of task.
+func (s *SQLStore) setTags(task *Task, tags []string) error {
+	task.Tags = normalizeTags(tags)
+	if _, err := s.DB.Exec(`DELETE FROM task_tags WHERE task_id = $1`, task.ID); err != nil {
+		return err
+	}
+	for _, tag := range task.Tags {
+		tagID, err := s.tagID(tag)
+		if err != nil {
+			return err
+		}
+		if _, err := s.DB.Exec(`INSERT INTO task_tags (task_id, tag_id) VALUES ($1, $2)`, task.ID, tagID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tagID returns the ID of the named tag, adding the tag if it is new.
+func (s *SQLStore) tagID(name string) (int, error) {
+	if _, err := s.DB.Exec(`INSERT INTO tags (name) VALUES ($1) ON CONFLICT (name) DO NOTHING`, name); err != nil {
+		return 0, err
+	}
+	var id int
+	err := s.DB.QueryRow(`SELECT id FROM tags WHERE name = $1`, name).Scan(&id)
+	return id, err
+}
+
+func (s *SQLStore) List(q TaskQuery) ([]Task, error) {
+	var where []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if q.OwnerID != 0 {
+		where = append(where, "owner_id = "+arg(q.OwnerID))
+	}
+	if q.ProjectID != 0 {
+		where = append(where, "project_id = "+arg(q.ProjectID))
+	}
+	if q.ParentID != 0 {
+		where = append(where, "parent_id = "+arg(q.ParentID))
+	}
+	if q.Deleted {
+		where = append(where, "deleted_at IS NOT NULL")
+	} else {
+		where = append(where, "deleted_at IS NULL")
+	}
+	if len(q.Statuses) > 0 {
+		placeholders := make([]string, len(q.Statuses))
+		for i, status := range q.Statuses {
+			placeholders[i] = arg(status)
+		}
+		where = append(where, "status IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	if len(q.ExcludeStatuses) > 0 {
+		placeholders := make([]string, len(q.ExcludeStatuses))
+		for i, status := range q.ExcludeStatuses {
+			placeholders[i] = arg(status)
+		}
+		where = append(where, "status NOT IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	if len(q.Priorities) > 0 {
+		placeholders := make([]string, len(q.Priorities))
+		for i, priority := range q.Priorities {
+			placeholders[i] = arg(priority)
+		}
+		where = append(where, "priority IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	// Dates and timestamps are compared with their own side of a bound.
+	if q.DueFrom != nil {
+		where = append(where, fmt.Sprintf("CASE WHEN due_all_day THEN due_date >= %s ELSE due_date >= %s END",
+			arg(dueValue(q.DueFrom.Day)), arg(dueValue(q.DueFrom.At))))
+	}
+	if q.DueBefore != nil {
+		where = append(where, fmt.Sprintf("CASE WHEN due_all_day THEN due_date < %s ELSE due_date < %s END",
+			arg(dueValue(q.DueBefore.Day)), arg(dueValue(q.DueBefore.At))))
+	}
+	if len(q.Tags) > 0 {
+		placeholders := make([]string, len(q.Tags))
+		for i, tag := range q.Tags {
+			placeholders[i] = arg(tag)
+		}
+		tagged := `SELECT tt.task_id FROM task_tags tt JOIN tags g ON g.id = tt.tag_id WHERE g.name IN (` + strings.Join(placeholders, ", ") + `)`
+		if q.AllTags {
+			tagged += ` GROUP BY tt.task_id HAVING COUNT(*) = ` + arg(len(q.Tags))
+		}
+		where = append(where, "id IN ("+tagged+")")
+	}
+	if q.Search != "" {
+		pattern := arg("%" + likeEscaper.Replace(strings.ToLower(q.Search)) + "%")
+		where = append(where, fmt.Sprintf(`(LOWER(title) LIKE %[1]s ESCAPE '\' OR LOWER(COALESCE(description, '')) LIKE %[1]s ESCAPE '\')`, pattern))
+	}
+
+	keys := q.orderKeys()
+	order := make([]string, len(keys))
+	for i, key := range keys {
+		if !sortableFields[key.Field] {
+			return nil, fmt.Errorf("cannot sort tasks by %q", key.Field)
+		}
+		order[i] = key.Field + " ASC"
+		if key.Desc {
+			order[i] = key.Field + " DESC"
+		}
+	}
+
+	if q.After != nil {
+		// Keyset pagination: a row comes after the cursor if it is past it
+		// on the first key that differs.
+		var after []string
+		for i, key := range keys {
+			var terms []string
+			for _, prev := range keys[:i] {
+				terms = append(terms, prev.Field+" = "+arg(taskField(*q.After, prev.Field)))
+			}
+			op := " > "
+			if key.Desc {
+				op = " < "
+			}
+			terms = append(terms, key.Field+op+arg(taskField(*q.After, key.Field)))
+			after = append(after, "("+strings.Join(terms, " AND ")+")")
+		}
+		where = append(where, "("+strings.Join(after, " OR ")+")")
+	}
+
+	query := `SELECT ` + taskColumns + ` FROM tasks`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	query += ` ORDER BY ` + strings.Join(order, ", ")
+	if q.Limit > 0 {
+		query += ` LIMIT ` + arg(q.Limit)
+	}
+
+	return s.queryTasks(query, args...)
+}
+
+// queryTasks runs a query for taskColumns and returns the tasks with their
+// tags.
+func (s *SQLStore) queryTasks(query string, args ...interface{}) ([]Task, error) {
+	rows, err := s.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := []Task{}
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// Let go of the connection before asking for the tags on it.
+	rows.Close()
+	if err := s.loadTags(tasks); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// likeEscaper escapes the LIKE wildcards in a search term.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// taskField returns the value of a sortable task field.
+func taskField(task Task, field string) interface{} {
+	switch field {
+	case "id":
+		return task.ID
+	case "title":
+		return task.Title
+	case "due_date":
+		due, _ := dueColumns(task)
+		return due
+	case "priority":
+		return task.Priority
+	case "status":
+		return task.Status
+	case "position":
+		return task.Position
+	}
+	return nil
+}
+
+func (s *SQLStore) Update(task Task, actorID int) (Task, error) {
+	var updated Task
+	err := s.inTx(func(tx *SQLStore) error {
+		old, err := tx.Get(task.ID)
+		if err != nil {
+			return err
+		}
+		if task.Version != 0 && task.Version != old.Version {
+			return ErrVersionConflict
+		}
+		task.Version = old.Version
+		if updated, err = tx.updateTask(task); err != nil {
+			return err
+		}
+		if err := tx.setTags(&updated, task.Tags); err != nil {
+			return err
+		}
+		if changes := diffTasks(&old, &updated); len(changes) > 0 {
+			return tx.record(task.ID, HistoryUpdate, actorID, changes)
+		}
+		return nil
+	})
+	if err != nil {
+		return Task{}, err
+	}
+	return updated, nil
+}
+
+// updateTask overwrites the row of a task at the version of task, leaving
+// its tags alone.
+func (s *SQLStore) updateTask(task Task) (Task, error) {
+	due, allDay := dueColumns(task)
+	if err := s.placeInProject(&task); err != nil {
+		return Task{}, err
+	}
+	if err := s.checkParent(task); err != nil {
+		return Task{}, err
+	}
+	query := `UPDATE tasks SET title = $1, description = $2, due_date = $3, due_all_day = $4, priority = $5, status = $6,
+              owner_id = $7, project_id = $8, position = $9, parent_id = $10, recurrence = $11, version = version + 1
+              WHERE id = $12 AND version = $13 RETURNING ` + taskColumns
+	updated, err := scanTask(s.DB.QueryRow(query, task.Title, task.Description, due, allDay, task.Priority, task.Status,
+		nullID(task.OwnerID), nullID(task.ProjectID), task.Position, nullID(task.ParentID), task.Recurrence, task.ID, task.Version))
+	if err == sql.ErrNoRows {
+		// Someone else updated the task since it was read.
+		return Task{}, ErrVersionConflict
+	}
+	return updated, s.translateError(err)
+}
+
+func (s *SQLStore) Delete(id, version, actorID int) error {
+	return s.inTx(func(tx *SQLStore) error {
+		task, err := tx.Get(id)
+		if err != nil {
+			return err
+		}
+		if task.DeletedAt != nil {
+			return ErrTaskNotFound
+		}
+		if version != 0 {
+			// Locks the task until the delete commits, checking the
+			// version of whatever update got there first.
+			res, err := tx.DB.Exec(`UPDATE tasks SET version = version WHERE id = $1 AND version = $2`, id, version)
+			if err != nil {
+				return err
+			}
+			if n, err := res.RowsAffected(); err != nil {
+				return err
+			} else if n == 0 {
+				return ErrVersionConflict
+			}
+		}
+		deletedAt := time.Now().Unix()
+		return tx.setDeletedAt(id, sql.NullInt64{}, sql.NullInt64{Int64: deletedAt, Valid: true}, HistoryDelete, 0, actorID)
+	})
+}
+
+func (s *SQLStore) Restore(id, actorID int) (Task, error) {
+	var restored Task
+	err := s.inTx(func(tx *SQLStore) error {
+		task, err := tx.Get(id)
+		if err != nil {
+			return err
+		}
+		if task.DeletedAt == nil {
+			return ErrTaskNotDeleted
+		}
+		if task.ParentID != 0 {
+			parent, err := tx.Get(task.ParentID)
+			if err != nil {
+				return err
+			}
+			if parent.DeletedAt != nil {
+				return ErrParentDeleted
+			}
+		}
+		deletedAt := sql.NullInt64{Int64: task.DeletedAt.Unix(), Valid: true}
+		if err := tx.setDeletedAt(id, deletedAt, sql.NullInt64{}, HistoryUpdate, 0, actorID); err != nil {
+			return err
+		}
+		restored, err = tx.Get(id)
+		return err
+	})
+	if err != nil {
+		return Task{}, err
+	}
+	return restored, nil
+}
+
+// setDeletedAt moves a task and its subtasks at any depth whose deleted_at
+// is from to to, recording action in the history of each. Subtasks with
+// another deleted_at are left alone along with their own subtasks. Those
+// in the project projectID leave it.
+func (s *SQLStore) setDeletedAt(id int, from, to sql.NullInt64, action string, projectID, actorID int) error {
+	state := `t.deleted_at IS NULL`
+	args := []interface{}{id}
+	if from.Valid {
+		state = `t.deleted_at = $2`
+		args = append(args, from.Int64)
+	}
+	tasks, err := s.queryTasks(`WITH RECURSIVE subtree (id) AS (
+                  SELECT id FROM tasks WHERE id = $1
+                  UNION SELECT t.id FROM tasks t JOIN subtree st ON t.parent_id = st.id WHERE `+state+`)
+              SELECT `+taskColumns+` FROM tasks WHERE id IN (SELECT id FROM subtree) ORDER BY id`, args...)
+	if err != nil {
+		return err
+	}
+	for _, old := range tasks {
+		updated, err := scanTask(s.DB.QueryRow(`UPDATE tasks SET deleted_at = $1, project_id = CASE WHEN project_id = $2 THEN NULL ELSE project_id END,
+                  version = version + 1 WHERE id = $3 RETURNING `+taskColumns, to, projectID, old.ID))
+		if err != nil {
+			return err
+		}
+		updated.Tags = old.Tags
+		if err := s.record(old.ID, action, actorID, diffTasks(&old, &updated)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) PurgeDeletedTasks(before time.Time) (int, error) {
+	var purged int
+	err := s.inTx(func(tx *SQLStore) error {
+		// Subtasks go with their parent, so count them before they do.
+		if err := tx.DB.QueryRow(`SELECT COUNT(*) FROM tasks WHERE deleted_at < $1`, before.Unix()).Scan(&purged); err != nil {
+			return err
+		}
+		_, err := tx.DB.Exec(`DELETE FROM tasks WHERE deleted_at < $1`, before.Unix())
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
+
+// record appends a change to the history of a task and queues its webhook
+// deliveries.
+func (s *SQLStore) record(taskID int, action string, actorID int, changes []FieldChange) error {
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	entry := HistoryEntry{TaskID: taskID, Action: action, ActorID: actorID, At: unixNow(), Changes: changes}
+	err = s.DB.QueryRow(`INSERT INTO task_history (task_id, action, actor_id, changed_at, changes) VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		taskID, action, nullID(actorID), entry.At.Unix(), string(data)).Scan(&entry.ID)
+	if err != nil {
+		return err
+	}
+	return s.queueWebhooks(entry)
+}
+
+// queueWebhooks adds a delivery of the change entry records to the outbox
+// for every active webhook subscribed to it whose owner can read the task.
+func (s *SQLStore) queueWebhooks(entry HistoryEntry) error {
+	event := eventName(entry)
+	rows, err := s.DB.Query(`SELECT w.id, w.events FROM webhooks w JOIN users u ON u.id = w.owner_id
+              WHERE w.active AND (u.role = $1 OR w.owner_id = (SELECT owner_id FROM tasks WHERE id = $2)) ORDER BY w.id`,
+		RoleAdmin, entry.TaskID)
+	if err != nil {
+		return err
+	}
+	var hooks []int
+	for rows.Next() {
+		var id int
+		var events string
+		if err := rows.Scan(&id, &events); err != nil {
+			rows.Close()
+			return err
+		}
+		if slices.Contains(splitEvents(events), event) {
+			hooks = append(hooks, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(hooks) == 0 {
+		return err
+	}
+
+	task, err := s.Get(entry.TaskID)
+	if err != nil {
+		return err
+	}
+	for _, id := range hooks {
+		delivery := newDelivery(id, entry, task)
+		_, err := s.DB.Exec(`INSERT INTO webhook_deliveries (webhook_id, event, task_id, payload, status, next_attempt_at, created_at)
+              VALUES ($1, $2, $3, $4, $5, $6, $7)`, delivery.WebhookID, delivery.Event, delivery.TaskID, string(delivery.Payload),
+			delivery.Status, delivery.NextAttemptAt.Unix(), delivery.CreatedAt.Unix())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) TaskHistory(taskID int) ([]HistoryEntry, error) {
+	rows, err := s.DB.Query(`SELECT id, task_id, action, actor_id, changed_at, changes FROM task_history
+              WHERE task_id = $1 ORDER BY id`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []HistoryEntry{}
+	for rows.Next() {
+		var entry HistoryEntry
+		var actorID sql.NullInt64
+		var changedAt int64
+		var changes string
+		if err := rows.Scan(&entry.ID, &entry.TaskID, &entry.Action, &actorID, &changedAt, &changes); err != nil {
+			return nil, err
+		}
+		entry.ActorID = int(actorID.Int64)
+		entry.At = time.Unix(changedAt, 0)
+		if err := json.Unmarshal([]byte(changes), &entry.Changes); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (s *SQLStore) GetIdempotencyKey(key string) (IdempotencyRecord, error) {
+	rec := IdempotencyRecord{Key: key}
+	var createdAt int64
+	err := s.DB.QueryRow(`SELECT request_hash, status_code, location, etag, body, created_at FROM idempotency_keys WHERE key = $1`, key).
+		Scan(&rec.RequestHash, &rec.StatusCode, &rec.Location, &rec.ETag, &rec.Body, &createdAt)
+	if err == sql.ErrNoRows {
+		return IdempotencyRecord{}, ErrIdempotencyKeyNotFound
+	} else if err != nil {
+		return IdempotencyRecord{}, err
+	}
+	rec.CreatedAt = time.Unix(createdAt, 0)
+	return rec, nil
+}
+
+func (s *SQLStore) ReserveIdempotencyKey(rec IdempotencyRecord) error {
+	_, err := s.DB.Exec(`INSERT INTO idempotency_keys (key, request_hash, created_at) VALUES ($1, $2, $3)`,
+		rec.Key, rec.RequestHash, rec.CreatedAt.Unix())
+	if s.dialect.uniqueViolation(err) {
+		return ErrIdempotencyKeyExists
+	}
+	return err
+}
+
+func (s *SQLStore) CompleteIdempotencyKey(rec IdempotencyRecord) error {
+	res, err := s.DB.Exec(`UPDATE idempotency_keys SET status_code = $1, location = $2, etag = $3, body = $4 WHERE key = $5`,
+		rec.StatusCode, rec.Location, rec.ETag, rec.Body, rec.Key)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrIdempotencyKeyNotFound
+	}
+	return nil
+}
+
+func (s *SQLStore) ReleaseIdempotencyKey(key string) error {
+	_, err := s.DB.Exec(`DELETE FROM idempotency_keys WHERE key = $1`, key)
+	return err
+}
+
+func (s *SQLStore) PurgeIdempotencyKeys(before time.Time) (int, error) {
+	res, err := s.DB.Exec(`DELETE FROM idempotency_keys WHERE created_at < $1`, before.Unix())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+const userColumns = `id, username, password_hash, role, created_at`
+
+func scanUser(row rowScanner) (User, error) {
+	var u User
+	var createdAt int64
+	err := row.Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Role, &createdAt)
+	if err == sql.ErrNoRows {
+		return User{}, ErrUserNotFound
+	}
+	u.CreatedAt = time.Unix(createdAt, 0)
+	return u, err
+}
+
+func (s *SQLStore) CreateUser(user User) (User, error) {
+	if user.Role == "" {
+		user.Role = RoleEditor
+	}
+	created, err := scanUser(s.DB.QueryRow(`INSERT INTO users (username, password_hash, role, created_at)
+              VALUES ($1, $2, $3, $4) RETURNING `+userColumns, user.Username, user.PasswordHash, user.Role, user.CreatedAt.Unix()))
+	if s.dialect.uniqueViolation(err) {
+		return User{}, ErrUserExists
+	}
+	return created, err
+}
+
+func (s *SQLStore) GetUser(id int) (User, error) {
+	return scanUser(s.DB.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = $1`, id))
+}
+
+func (s *SQLStore) GetUserByName(username string) (User, error) {
+	return scanUser(s.DB.QueryRow(`SELECT `+userColumns+` FROM users WHERE username = $1`, username))
+}
+
+func (s *SQLStore) SetUserRole(id int, role string) error {
+	res, err := s.DB.Exec(`UPDATE users SET role = $1 WHERE id = $2`, role, id)
+	if s.dialect.checkViolation(err) {
+		return ErrConstraintViolation
+	} else if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func scanToken(row rowScanner) (APIToken, error) {
+	var t APIToken
+	var createdAt int64
+	var lastUsedAt sql.NullInt64
+	err := row.Scan(&t.ID, &t.UserID, &t.Name, &t.Hash, &t.Scope, &createdAt, &lastUsedAt)
+	t.CreatedAt = time.Unix(createdAt, 0)
+	if lastUsedAt.Valid {
+		used := time.Unix(lastUsedAt.Int64, 0)
+		t.LastUsedAt = &used
+	}
+	return t, err
+}
+
+const tokenColumns = `id, user_id, name, token_hash, scope, created_at, last_used_at`
+
+func (s *SQLStore) CreateToken(token APIToken) (APIToken, error) {
+	if token.Scope == "" {
+		token.Scope = TokenScopeAPI
+	}
+	created, err := scanToken(s.DB.QueryRow(`INSERT INTO api_tokens (user_id, name, token_hash, scope, created_at)
+              VALUES ($1, $2, $3, $4, $5) RETURNING `+tokenColumns, token.UserID, token.Name, token.Hash, token.Scope, token.CreatedAt.Unix()))
+	if s.dialect.foreignKeyViolation(err) {
+		return APIToken{}, ErrUserNotFound
+	}
+	return created, err
+}
+
+func (s *SQLStore) ListTokens(userID int) ([]APIToken, error) {
+	rows, err := s.DB.Query(`SELECT `+tokenColumns+` FROM api_tokens WHERE user_id = $1 ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []APIToken{}
+	for rows.Next() {
+		token, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+func (s *SQLStore) DeleteToken(userID, id int) error {
+	res, err := s.DB.Exec(`DELETE FROM api_tokens WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrTokenNotFound
+	}
+	return nil
+}
+
+func (s *SQLStore) UserForToken(hash, scope string, now time.Time) (User, error) {
+	var userID int
+	err := s.DB.QueryRow(`UPDATE api_tokens SET last_used_at = $1 WHERE token_hash = $2 AND scope = $3 RETURNING user_id`,
+		now.Unix(), hash, scope).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return User{}, ErrUserNotFound
+	} else if err != nil {
+		return User{}, err
+	}
+	return s.GetUser(userID)
+}
+
+func (s *SQLStore) CreateSession(session Session) error {
+	_, err := s.DB.Exec(`INSERT INTO sessions (token_hash, user_id, expires_at) VALUES ($1, $2, $3)`,
+		session.Hash, session.UserID, session.ExpiresAt.Unix())
+	if s.dialect.foreignKeyViolation(err) {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+func (s *SQLStore) UserForSession(hash string, now time.Time) (User, error) {
+	return scanUser(s.DB.QueryRow(`SELECT u.id, u.username, u.password_hash, u.role, u.created_at
+              FROM sessions s JOIN users u ON u.id = s.user_id
+              WHERE s.token_hash = $1 AND s.expires_at > $2`, hash, now.Unix()))
+}
+
+func (s *SQLStore) DeleteSession(hash string) error {
+	_, err := s.DB.Exec(`DELETE FROM sessions WHERE token_hash = $1`, hash)
+	return err
+}
+
+func (s *SQLStore) PurgeSessions(before time.Time) (int, error) {
+	res, err := s.DB.Exec(`DELETE FROM sessions WHERE expires_at < $1`, before.Unix())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+const projectColumns = `id, name, description, owner_id, created_at`
+
+func scanProject(row rowScanner) (Project, error) {
+	var p Project
+	var createdAt int64
+	err := row.Scan(&p.ID, &p.Name, &p.Description, &p.OwnerID, &createdAt)
+	if err == sql.ErrNoRows {
+		return Project{}, ErrProjectNotFound
+	}
+	p.CreatedAt = time.Unix(createdAt, 0)
+	return p, err
+}
+
+func (s *SQLStore) CreateProject(project Project) (Project, error) {
+	created, err := scanProject(s.DB.QueryRow(`INSERT INTO projects (name, description, owner_id, created_at)
+              VALUES ($1, $2, $3, $4) RETURNING `+projectColumns,
+		project.Name, project.Description, project.OwnerID, project.CreatedAt.Unix()))
+	if s.dialect.uniqueViolation(err) {
+		return Project{}, ErrProjectExists
+	} else if s.dialect.foreignKeyViolation(err) {
+		return Project{}, ErrUserNotFound
+	}
+	return created, err
+}
+
+func (s *SQLStore) GetProject(id int) (Project, error) {
+	return scanProject(s.DB.QueryRow(`SELECT `+projectColumns+` FROM projects WHERE id = $1`, id))
+}
+
+func (s *SQLStore) ListProjects() ([]Project, error) {
+	rows, err := s.DB.Query(`SELECT ` + projectColumns + ` FROM projects ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	projects := []Project{}
+	for rows.Next() {
+		project, err := scanProject(rows)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, project)
+	}
+	return projects, rows.Err()
+}
+
+func (s *SQLStore) UpdateProject(project Project) (Project, error) {
+	updated, err := scanProject(s.DB.QueryRow(`UPDATE projects SET name = $1, description = $2 WHERE id = $3 RETURNING `+projectColumns,
+		project.Name, project.Description, project.ID))
+	if s.dialect.uniqueViolation(err) {
+		return Project{}, ErrProjectExists
+	}
+	return updated, err
+}
+
+func (s *SQLStore) DeleteProject(id int, cascade bool, actorID int) error {
+	return s.inTx(func(tx *SQLStore) error {
+		if _, err := tx.GetProject(id); err != nil {
+			return err
+		}
+		tasks, err := tx.queryTasks(`SELECT `+taskColumns+` FROM tasks WHERE project_id = $1 ORDER BY id`, id)
+		if err != nil {
+			return err
+		}
+		if !cascade && slices.ContainsFunc(tasks, func(task Task) bool { return task.DeletedAt == nil }) {
+			return ErrProjectNotEmpty
+		}
+		deletedAt := sql.NullInt64{Int64: time.Now().Unix(), Valid: true}
+		for _, task := range tasks {
+			if task.DeletedAt != nil {
+				continue
+			}
+			// Subtasks may have gone to the trash with their parent already.
+			if current, err := tx.Get(task.ID); err != nil {
+				return err
+			} else if current.DeletedAt != nil {
+				continue
+			}
+			if err := tx.setDeletedAt(task.ID, sql.NullInt64{}, deletedAt, HistoryDelete, id, actorID); err != nil {
+				return err
+			}
+		}
+		// Tasks that were in the trash already stay there, without the project.
+		for _, old := range tasks {
+			if old.DeletedAt == nil {
+				continue
+			}
+			updated, err := scanTask(tx.DB.QueryRow(`UPDATE tasks SET project_id = NULL, version = version + 1 WHERE id = $1 RETURNING `+taskColumns, old.ID))
+			if err != nil {
+				return err
+			}
+			updated.Tags = old.Tags
+			if err := tx.record(old.ID, HistoryUpdate, actorID, diffTasks(&old, &updated)); err != nil {
+				return err
+			}
+		}
+
+		res, err := tx.DB.Exec(`DELETE FROM projects WHERE id = $1`, id)
+		if tx.dialect.foreignKeyViolation(err) {
+			// A task was added to the project meanwhile.
+			return ErrProjectNotEmpty
+		} else if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrProjectNotFound
+		}
+		return nil
+	})
+}
+
+func (s *SQLStore) ListTags(ownerID int) ([]Tag, error) {
+	query := `SELECT g.name, COUNT(*) FROM tags g JOIN task_tags tt ON tt.tag_id = g.id JOIN tasks t ON t.id = tt.task_id
+              WHERE t.deleted_at IS NULL`
+	var args []interface{}
+	if ownerID != 0 {
+		query += ` AND t.owner_id = $1`
+		args = append(args, ownerID)
+	}
+	rows, err := s.DB.Query(query+` GROUP BY g.name ORDER BY g.name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []Tag{}
+	for rows.Next() {
+		var tag Tag
+		if err := rows.Scan(&tag.Name, &tag.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+func (s *SQLStore) MergeTags(ownerID int, from []string, into string, actorID int) (int, error) {
+	from = slices.DeleteFunc(slices.Clone(from), func(tag string) bool { return tag == into })
+	if len(from) == 0 {
+		return 0, nil
+	}
+
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	placeholders := make([]string, len(from))
+	for i, tag := range from {
+		placeholders[i] = arg(tag)
+	}
+	names := strings.Join(placeholders, ", ")
+	// matched selects the tasks in scope that have one of the tags merged.
+	matched := `SELECT tt.task_id FROM task_tags tt JOIN tags g ON g.id = tt.tag_id JOIN tasks t ON t.id = tt.task_id
+              WHERE g.name IN (` + names + `)`
+	if ownerID != 0 {
+		matched += ` AND t.owner_id = ` + arg(ownerID)
+	}
+
+	var before []Task
+	err := s.inTx(func(tx *SQLStore) error {
+		rows, err := tx.DB.Query(`SELECT DISTINCT task_id FROM (`+matched+`) m ORDER BY task_id`, args...)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var task Task
+			if err := rows.Scan(&task.ID); err != nil {
+				rows.Close()
+				return err
+			}
+			before = append(before, task)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil || len(before) == 0 {
+			return err
+		}
+		if err := tx.loadTags(before); err != nil {
+			return err
+		}
+		if _, err := tx.DB.Exec(`UPDATE tasks SET version = version + 1 WHERE id IN (`+matched+`)`, args...); err != nil {
+			return err
+		}
+
+		intoID, err := tx.tagID(into)
+		if err != nil {
+			return err
+		}
+		intoArg := fmt.Sprintf("CAST($%d AS INTEGER)", len(args)+1)
+		if _, err := tx.DB.Exec(`INSERT INTO task_tags (task_id, tag_id)
+              SELECT DISTINCT m.task_id, `+intoArg+` FROM (`+matched+`) m
+              WHERE NOT EXISTS (SELECT 1 FROM task_tags x WHERE x.task_id = m.task_id AND x.tag_id = `+intoArg+`)`,
+			append(args, intoID)...); err != nil {
+			return err
+		}
+		if _, err := tx.DB.Exec(`DELETE FROM task_tags WHERE task_id IN (`+matched+`)
+              AND tag_id IN (SELECT id FROM tags WHERE name IN (`+names+`))`, args...); err != nil {
+			return err
+		}
+		if _, err := tx.DB.Exec(`DELETE FROM tags WHERE id NOT IN (SELECT tag_id FROM task_tags)`); err != nil {
+			return err
+		}
+
+		after := make([]Task, len(before))
+		for i, task := range before {
+			after[i].ID = task.ID
+		}
+		if err := tx.loadTags(after); err != nil {
+			return err
+		}
+		for i := range before {
+			if err := tx.record(before[i].ID, HistoryUpdate, actorID, diffTasks(&before[i], &after[i])); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(before), nil
+}
+
+func (s *SQLStore) AddBlocker(taskID, blockerID int) error {
+	return s.inTx(func(tx *SQLStore) error {
+		var found int
+		if err := tx.DB.QueryRow(`SELECT COUNT(*) FROM tasks WHERE id IN ($1, $2)`, taskID, blockerID).Scan(&found); err != nil {
+			return err
+		}
+		if want := len(slices.Compact([]int{taskID, blockerID})); found < want {
+			return ErrTaskNotFound
+		}
+
+		// The blocker may not be the task or wait on it, however indirectly.
+		var cycle int
+		err := tx.DB.QueryRow(`WITH RECURSIVE chain (id) AS (
+                  SELECT id FROM tasks WHERE id = $1
+                  UNION SELECT d.blocker_id FROM task_dependencies d JOIN chain c ON d.task_id = c.id)
+              SELECT COUNT(*) FROM chain WHERE id = $2`, blockerID, taskID).Scan(&cycle)
+		if err != nil {
+			return err
+		} else if cycle > 0 {
+			return ErrCycle
+		}
+
+		_, err = tx.DB.Exec(`INSERT INTO task_dependencies (task_id, blocker_id) VALUES ($1, $2)
+              ON CONFLICT (task_id, blocker_id) DO NOTHING`, taskID, blockerID)
+		return err
+	})
+}
+
+func (s *SQLStore) RemoveBlocker(taskID, blockerID int) error {
+	res, err := s.DB.Exec(`DELETE FROM task_dependencies WHERE task_id = $1 AND blocker_id = $2`, taskID, blockerID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrDependencyNotFound
+	}
+	return nil
+}
+
+func (s *SQLStore) ListBlockers(taskID int) ([]Task, error) {
+	return s.queryTasks(`SELECT `+taskColumns+` FROM tasks
+              WHERE id IN (SELECT blocker_id FROM task_dependencies WHERE task_id = $1) AND deleted_at IS NULL ORDER BY id`, taskID)
+}
+
+func (s *SQLStore) ClaimReminder(taskID int, dueDate string, threshold time.Duration, now time.Time) (bool, error) {
+	res, err := s.DB.Exec(`INSERT INTO task_reminders (task_id, due_date, threshold_seconds, sent_at) VALUES ($1, $2, $3, $4)
+              ON CONFLICT (task_id, due_date, threshold_seconds) DO NOTHING`, taskID, dueDate, int64(threshold.Seconds()), now.Unix())
+	if s.dialect.foreignKeyViolation(err) {
+		return false, ErrTaskNotFound
+	} else if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (s *SQLStore) ReleaseReminder(taskID int, dueDate string, threshold time.Duration) error {
+	_, err := s.DB.Exec(`DELETE FROM task_reminders WHERE task_id = $1 AND due_date = $2 AND threshold_seconds = $3`,
+		taskID, dueDate, int64(threshold.Seconds()))
+	return err
+}
+
+const webhookColumns = `id, owner_id, url, events, secret, active, created_at`
+
+func scanWebhook(row rowScanner) (Webhook, error) {
+	var hook Webhook
+	var events string
+	var createdAt int64
+	err := row.Scan(&hook.ID, &hook.OwnerID, &hook.URL, &events, &hook.Secret, &hook.Active, &createdAt)
+	if err == sql.ErrNoRows {
+		return Webhook{}, ErrWebhookNotFound
+	}
+	hook.Events = splitEvents(events)
+	hook.CreatedAt = time.Unix(createdAt, 0)
+	return hook, err
+}
+
+// splitEvents reads the events column of webhooks, a comma-separated list.
+func splitEvents(events string) []string {
+	if events == "" {
+		return []string{}
+	}
+	return strings.Split(events, ",")
+}
+
+func (s *SQLStore) CreateWebhook(hook Webhook) (Webhook, error) {
+	created, err := scanWebhook(s.DB.QueryRow(`INSERT INTO webhooks (owner_id, url, events, secret, active, created_at)
+              VALUES ($1, $2, $3, $4, $5, $6) RETURNING `+webhookColumns,
+		hook.OwnerID, hook.URL, strings.Join(hook.Events, ","), hook.Secret, hook.Active, hook.CreatedAt.Unix()))
+	if s.dialect.foreignKeyViolation(err) {
+		return Webhook{}, ErrUserNotFound
+	}
+	return created, err
+}
+
+func (s *SQLStore) GetWebhook(id int) (Webhook, error) {
+	return scanWebhook(s.DB.QueryRow(`SELECT `+webhookColumns+` FROM webhooks WHERE id = $1`, id))
+}
+
+func (s *SQLStore) ListWebhooks(ownerID int) ([]Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks`
+	var args []interface{}
+	if ownerID != 0 {
+		query += ` WHERE owner_id = $1`
+		args = append(args, ownerID)
+	}
+	rows, err := s.DB.Query(query+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hooks := []Webhook{}
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, rows.Err()
+}
+
+func (s *SQLStore) UpdateWebhook(hook Webhook) (Webhook, error) {
+	return scanWebhook(s.DB.QueryRow(`UPDATE webhooks SET url = $1, events = $2, active = $3 WHERE id = $4 RETURNING `+webhookColumns,
+		hook.URL, strings.Join(hook.Events, ","), hook.Active, hook.ID))
+}
+
+func (s *SQLStore) DeleteWebhook(id int) error {
+	res, err := s.DB.Exec(`DELETE FROM webhooks WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+const deliveryColumns = `id, webhook_id, event, task_id, payload, status, attempts, next_attempt_at, response_code, error, created_at, delivered_at`
+
+func scanDelivery(row rowScanner) (WebhookDelivery, error) {
+	var d WebhookDelivery
+	var payload string
+	var nextAttemptAt, deliveredAt sql.NullInt64
+	var createdAt int64
+	err := row.Scan(&d.ID, &d.WebhookID, &d.Event, &d.TaskID, &payload, &d.Status, &d.Attempts, &nextAttemptAt,
+		&d.ResponseCode, &d.Error, &createdAt, &deliveredAt)
+	d.Payload = json.RawMessage(payload)
+	d.NextAttemptAt = nullableTime(nextAttemptAt)
+	d.DeliveredAt = nullableTime(deliveredAt)
+	d.CreatedAt = time.Unix(createdAt, 0)
+	return d, err
+}
+
+// nullableTime reads a nullable column of unix seconds.
+func nullableTime(v sql.NullInt64) *time.Time {
+	if !v.Valid {
+		return nil
+	}
+	t := time.Unix(v.Int64, 0)
+	return &t
+}
+
+// nullUnix stores a missing time as NULL.
+func nullUnix(t *time.Time) sql.NullInt64 {
+	if t == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.Unix(), Valid: true}
+}
+
+func (s *SQLStore) ClaimWebhookDeliveries(now time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error) {
+	rows, err := s.DB.Query(`SELECT id, next_attempt_at FROM webhook_deliveries WHERE status = $1 AND next_attempt_at <= $2
+              ORDER BY id LIMIT $3`, DeliveryPending, now.Unix(), limit)
+	if err != nil {
+		return nil, err
+	}
+	type candidate struct {
+		id            int
+		nextAttemptAt int64
+	}
+	var candidates []candidate
+	for rows.Next() {
+		var c candidate
+		if err := rows.Scan(&c.id, &c.nextAttemptAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		candidates = append(candidates, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Another dispatcher may claim the same deliveries meanwhile; only the
+	// one that moves their next attempt gets them.
+	claimed := []WebhookDelivery{}
+	for _, c := range candidates {
+		delivery, err := scanDelivery(s.DB.QueryRow(`UPDATE webhook_deliveries SET next_attempt_at = $1
+              WHERE id = $2 AND status = $3 AND next_attempt_at = $4 RETURNING `+deliveryColumns,
+			now.Add(lease).Unix(), c.id, DeliveryPending, c.nextAttemptAt))
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		claimed = append(claimed, delivery)
+	}
+	return claimed, nil
+}
+
+func (s *SQLStore) RecordWebhookAttempt(delivery WebhookDelivery) error {
+	_, err := s.DB.Exec(`UPDATE webhook_deliveries SET status = $1, attempts = $2, next_attempt_at = $3, response_code = $4,
+              error = $5, delivered_at = $6 WHERE id = $7`, delivery.Status, delivery.Attempts, nullUnix(delivery.NextAttemptAt),
+		delivery.ResponseCode, delivery.Error, nullUnix(delivery.DeliveredAt), delivery.ID)
+	return err
+}
+
+func (s *SQLStore) ListWebhookDeliveries(webhookID, limit int) ([]WebhookDelivery, error) {
+	rows, err := s.DB.Query(`SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE webhook_id = $1 ORDER BY id DESC LIMIT $2`,
+		webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func (s *SQLStore) PurgeWebhookDeliveries(before time.Time) (int, error) {
+	res, err := s.DB.Exec(`DELETE FROM webhook_deliveries WHERE status <> $1 AND created_at < $2`, DeliveryPending, before.Unix())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
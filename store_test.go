@@ -0,0 +1,790 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testStores lists the TaskStore backends every behavior test runs against.
+func testStores() map[string]func(t *testing.T) Store {
+	stores := map[string]func(t *testing.T) Store{
+		"memory": func(t *testing.T) Store { return NewMemoryStore() },
+		"sqlite": newSQLiteTestStore,
+	}
+	if testDB != nil {
+		stores["postgres"] = newTestStore
+	}
+	return stores
+}
+
+// dueBoundOnDate returns the cut-off at the start of a UTC date.
+func dueBoundOnDate(t *testing.T, date string) *DueBound {
+	t.Helper()
+	bound, err := parseDueBound(date, time.UTC)
+	if err != nil {
+		t.Fatalf("parseDueBound(%q) returned error: %v", date, err)
+	}
+	return &bound
+}
+
+func TestTaskStoreBehavior(t *testing.T) {
+	for name, newStore := range testStores() {
+		t.Run(name, func(t *testing.T) {
+			t.Run("CreateAndGet", func(t *testing.T) {
+				store := newStore(t)
+				want := Task{ID: 1, Title: "Write docs", Description: "README", DueDate: "2024-12-01", Priority: 2, Status: "Pending", Tags: []string{"docs", "onboarding"}}
+
+				created, err := store.Create(want, 0)
+				if err != nil {
+					t.Fatalf("Create returned error: %v", err)
+				}
+				want.Version = 1
+				if !reflect.DeepEqual(created, want) {
+					t.Errorf("Create returned %+v, want %+v", created, want)
+				}
+
+				got, err := store.Get(1)
+				if err != nil {
+					t.Fatalf("Get returned error: %v", err)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("Get returned %+v, want %+v", got, want)
+				}
+			})
+
+			t.Run("DuplicateID", func(t *testing.T) {
+				store := newStore(t)
+				task := Task{ID: 7, Title: "Once", DueDate: "2024-12-01", Priority: 1, Status: "Pending"}
+				if _, err := store.Create(task, 0); err != nil {
+					t.Fatalf("Create returned error: %v", err)
+				}
+				if _, err := store.Create(task, 0); !errors.Is(err, ErrTaskExists) {
+					t.Errorf("Second Create returned %v, want ErrTaskExists", err)
+				}
+			})
+
+			t.Run("GeneratedIDs", func(t *testing.T) {
+				store := newStore(t)
+				task := Task{Title: "Generated", DueDate: "2024-12-01", Priority: 2, Status: "Pending"}
+
+				first, err := store.Create(task, 0)
+				if err != nil {
+					t.Fatalf("Create returned error: %v", err)
+				}
+				if err := store.Delete(first.ID, 0, 0); err != nil {
+					t.Fatalf("Delete returned error: %v", err)
+				}
+				second, err := store.Create(task, 0)
+				if err != nil {
+					t.Fatalf("Create returned error: %v", err)
+				}
+				if second.ID <= first.ID {
+					t.Errorf("ID %d of a deleted task was reused or skipped backwards: got %d", first.ID, second.ID)
+				}
+
+				task.ID = second.ID + 10
+				if _, err := store.Create(task, 0); err != nil {
+					t.Fatalf("Create with an explicit ID returned error: %v", err)
+				}
+				task.ID = 0
+				third, err := store.Create(task, 0)
+				if err != nil {
+					t.Fatalf("Create after an explicit ID returned error: %v", err)
+				}
+				if third.ID <= second.ID+10 {
+					t.Errorf("Generated ID %d collides with or precedes explicit ID %d", third.ID, second.ID+10)
+				}
+			})
+
+			t.Run("IdempotencyKeys", func(t *testing.T) {
+				store := newStore(t)
+				now := time.Unix(time.Now().Unix(), 0)
+				rec := IdempotencyRecord{Key: "k", RequestHash: "h", CreatedAt: now}
+
+				if _, err := store.GetIdempotencyKey("k"); !errors.Is(err, ErrIdempotencyKeyNotFound) {
+					t.Errorf("GetIdempotencyKey returned %v, want ErrIdempotencyKeyNotFound", err)
+				}
+				if err := store.ReserveIdempotencyKey(rec); err != nil {
+					t.Fatalf("ReserveIdempotencyKey returned error: %v", err)
+				}
+				if err := store.ReserveIdempotencyKey(rec); !errors.Is(err, ErrIdempotencyKeyExists) {
+					t.Errorf("Second ReserveIdempotencyKey returned %v, want ErrIdempotencyKeyExists", err)
+				}
+
+				rec.StatusCode = 201
+				rec.Location = "/tasks/1"
+				rec.Body = []byte(`{"id":1}`)
+				if err := store.CompleteIdempotencyKey(rec); err != nil {
+					t.Fatalf("CompleteIdempotencyKey returned error: %v", err)
+				}
+				got, err := store.GetIdempotencyKey("k")
+				if err != nil {
+					t.Fatalf("GetIdempotencyKey returned error: %v", err)
+				}
+				if got.StatusCode != 201 || got.Location != "/tasks/1" || string(got.Body) != `{"id":1}` || !got.CreatedAt.Equal(now) {
+					t.Errorf("GetIdempotencyKey returned %+v", got)
+				}
+
+				if n, err := store.PurgeIdempotencyKeys(now); err != nil || n != 0 {
+					t.Errorf("PurgeIdempotencyKeys(now) = %d, %v; want 0, nil", n, err)
+				}
+				if n, err := store.PurgeIdempotencyKeys(now.Add(time.Second)); err != nil || n != 1 {
+					t.Errorf("PurgeIdempotencyKeys(later) = %d, %v; want 1, nil", n, err)
+				}
+			})
+
+			t.Run("PriorityConstraint", func(t *testing.T) {
+				store := newStore(t)
+				task := Task{ID: 1, Title: "Too urgent", DueDate: "2024-12-01", Priority: 4, Status: "Pending"}
+				if _, err := store.Create(task, 0); !errors.Is(err, ErrConstraintViolation) {
+					t.Errorf("Create returned %v, want ErrConstraintViolation", err)
+				}
+
+				task.Priority = 1
+				if _, err := store.Create(task, 0); err != nil {
+					t.Fatalf("Create returned error: %v", err)
+				}
+				task.Priority = 0
+				if _, err := store.Update(task, 0); !errors.Is(err, ErrConstraintViolation) {
+					t.Errorf("Update returned %v, want ErrConstraintViolation", err)
+				}
+			})
+
+			t.Run("NotFound", func(t *testing.T) {
+				store := newStore(t)
+				if _, err := store.Get(404); !errors.Is(err, ErrTaskNotFound) {
+					t.Errorf("Get returned %v, want ErrTaskNotFound", err)
+				}
+				if _, err := store.Update(Task{ID: 404, Title: "x", DueDate: "2024-12-01", Priority: 1, Status: "Pending"}, 0); !errors.Is(err, ErrTaskNotFound) {
+					t.Errorf("Update returned %v, want ErrTaskNotFound", err)
+				}
+				if err := store.Delete(404, 0, 0); !errors.Is(err, ErrTaskNotFound) {
+					t.Errorf("Delete returned %v, want ErrTaskNotFound", err)
+				}
+			})
+
+			t.Run("DeleteChecksVersion", func(t *testing.T) {
+				store := newStore(t)
+				task, _ := store.Create(Task{Title: "Deploy", DueDate: "2024-12-01", Priority: 1, Status: "Pending"}, 0)
+				if _, err := store.Update(task, 0); err != nil {
+					t.Fatalf("Update returned error: %v", err)
+				}
+				if err := store.Delete(task.ID, task.Version, 0); !errors.Is(err, ErrVersionConflict) {
+					t.Errorf("Delete of a stale version returned %v, want ErrVersionConflict", err)
+				}
+				if got, _ := store.Get(task.ID); got.DeletedAt != nil {
+					t.Error("Delete of a stale version moved the task to the trash")
+				}
+				if err := store.Delete(task.ID, task.Version+1, 0); err != nil {
+					t.Errorf("Delete of the current version returned error: %v", err)
+				}
+			})
+
+			t.Run("ListOrdersByPriority", func(t *testing.T) {
+				store := newStore(t)
+				for i, priority := range []int{3, 1, 2, 1} {
+					task := Task{ID: i + 1, Title: fmt.Sprintf("Task %d", i+1), DueDate: "2024-12-01", Priority: priority, Status: "Pending"}
+					if _, err := store.Create(task, 0); err != nil {
+						t.Fatalf("Create returned error: %v", err)
+					}
+				}
+
+				tasks, err := store.List(TaskQuery{})
+				if err != nil {
+					t.Fatalf("List returned error: %v", err)
+				}
+				var gotIDs []int
+				for _, task := range tasks {
+					gotIDs = append(gotIDs, task.ID)
+				}
+				if fmt.Sprint(gotIDs) != fmt.Sprint([]int{2, 4, 3, 1}) {
+					t.Errorf("List returned IDs %v, want [2 4 3 1]", gotIDs)
+				}
+			})
+
+			t.Run("ListFiltersAndSorts", func(t *testing.T) {
+				store := newStore(t)
+				for _, task := range []Task{
+					{ID: 1, Title: "Write report", Description: "quarterly numbers", DueDate: "2024-12-01", Priority: 2, Status: "Pending"},
+					{ID: 2, Title: "Review PR", Description: "100% coverage", DueDate: "2024-12-05", Priority: 1, Status: "In Progress"},
+					{ID: 3, Title: "Ship release", DueDate: "2024-12-05", Priority: 3, Status: "Completed"},
+					{ID: 4, Title: "Plan sprint", Description: "REPORT back", DueDate: "2025-01-10", Priority: 2, Status: "Pending"},
+				} {
+					if _, err := store.Create(task, 0); err != nil {
+						t.Fatalf("Create returned error: %v", err)
+					}
+				}
+
+				tests := []struct {
+					name  string
+					query TaskQuery
+					want  []int
+				}{
+					{"Status", TaskQuery{Statuses: []string{"Pending", "Completed"}}, []int{1, 4, 3}},
+					{"Priority", TaskQuery{Priorities: []int{1, 3}}, []int{2, 3}},
+					{"DueRange", TaskQuery{DueFrom: dueBoundOnDate(t, "2024-12-02"), DueBefore: dueBoundOnDate(t, "2025-01-01")}, []int{2, 3}},
+					{"SearchIgnoresCase", TaskQuery{Search: "report"}, []int{1, 4}},
+					{"SearchEscapesWildcards", TaskQuery{Search: "0%"}, []int{2}},
+					{"MultiKeySort", TaskQuery{Sort: []SortKey{{Field: "due_date", Desc: true}, {Field: "priority"}}}, []int{4, 2, 3, 1}},
+					{"Limit", TaskQuery{Sort: []SortKey{{Field: "title"}}, Limit: 2}, []int{4, 2}},
+					{"After", TaskQuery{Sort: []SortKey{{Field: "due_date"}}, After: &Task{ID: 2, DueDate: "2024-12-05"}}, []int{3, 4}},
+				}
+				for _, tt := range tests {
+					tasks, err := store.List(tt.query)
+					if err != nil {
+						t.Fatalf("%s: List returned error: %v", tt.name, err)
+					}
+					var gotIDs []int
+					for _, task := range tasks {
+						gotIDs = append(gotIDs, task.ID)
+					}
+					if fmt.Sprint(gotIDs) != fmt.Sprint(tt.want) {
+						t.Errorf("%s: List returned IDs %v, want %v", tt.name, gotIDs, tt.want)
+					}
+				}
+			})
+
+			t.Run("UpdateAndDelete", func(t *testing.T) {
+				store := newStore(t)
+				task := Task{ID: 1, Title: "Draft", DueDate: "2024-12-01", Priority: 3, Status: "Pending"}
+				if _, err := store.Create(task, 0); err != nil {
+					t.Fatalf("Create returned error: %v", err)
+				}
+
+				task.Title = "Final"
+				task.Status = "Completed"
+				updated, err := store.Update(task, 0)
+				if err != nil {
+					t.Fatalf("Update returned error: %v", err)
+				}
+				task.Version = 2
+				if !reflect.DeepEqual(updated, task) {
+					t.Errorf("Update returned %+v, want %+v", updated, task)
+				}
+
+				if err := store.Delete(1, 0, 0); err != nil {
+					t.Fatalf("Delete returned error: %v", err)
+				}
+				if deleted, err := store.Get(1); err != nil || deleted.DeletedAt == nil {
+					t.Errorf("Get after Delete = %+v, %v; want the task in the trash", deleted, err)
+				}
+				if err := store.Delete(1, 0, 0); !errors.Is(err, ErrTaskNotFound) {
+					t.Errorf("Deleting a task twice returned %v, want ErrTaskNotFound", err)
+				}
+				if n, err := store.PurgeDeletedTasks(time.Now().Add(-time.Hour)); err != nil || n != 0 {
+					t.Errorf("PurgeDeletedTasks of older tasks = %d, %v; want 0", n, err)
+				}
+				if n, err := store.PurgeDeletedTasks(time.Now().Add(time.Second)); err != nil || n != 1 {
+					t.Errorf("PurgeDeletedTasks = %d, %v; want 1", n, err)
+				}
+				if _, err := store.Get(1); !errors.Is(err, ErrTaskNotFound) {
+					t.Errorf("Get after purging returned %v, want ErrTaskNotFound", err)
+				}
+			})
+
+			t.Run("Atomically", func(t *testing.T) {
+				store := newStore(t)
+				rollback := errors.New("rollback")
+				err := store.Atomically(func(tx Store) error {
+					if _, err := tx.Create(Task{Title: "Dropped", DueDate: "2024-12-01", Priority: 1, Status: "Pending"}, 0); err != nil {
+						return err
+					}
+					return rollback
+				})
+				if !errors.Is(err, rollback) {
+					t.Fatalf("Atomically returned %v, want the error of fn", err)
+				}
+				err = store.Atomically(func(tx Store) error {
+					_, err := tx.Create(Task{Title: "Kept", DueDate: "2024-12-01", Priority: 1, Status: "Pending"}, 0)
+					return err
+				})
+				if err != nil {
+					t.Fatalf("Atomically returned error: %v", err)
+				}
+				tasks, err := store.List(TaskQuery{})
+				if err != nil || len(tasks) != 1 || tasks[0].Title != "Kept" {
+					t.Errorf("List after Atomically = %+v, %v; want only Kept", tasks, err)
+				}
+				if history, _ := store.TaskHistory(tasks[0].ID); len(history) != 1 {
+					t.Errorf("History of the kept task = %+v, want its creation", history)
+				}
+			})
+
+			t.Run("Versions", func(t *testing.T) {
+				store := newStore(t)
+				task, err := store.Create(Task{Title: "Draft", DueDate: "2024-12-01", Priority: 1, Status: "Pending", Tags: []string{"wip"}}, 0)
+				if err != nil {
+					t.Fatalf("Create returned error: %v", err)
+				}
+				stale := task
+				task.Title = "Final"
+				if task, err = store.Update(task, 0); err != nil || task.Version != 2 {
+					t.Fatalf("Update = %+v, %v; want version 2", task, err)
+				}
+				stale.Title = "Lost"
+				if _, err := store.Update(stale, 0); !errors.Is(err, ErrVersionConflict) {
+					t.Errorf("Update of version 1 returned %v, want ErrVersionConflict", err)
+				}
+				if _, err := store.MergeTags(0, []string{"wip"}, "done", 0); err != nil {
+					t.Fatalf("MergeTags returned error: %v", err)
+				}
+				if err := store.Delete(task.ID, 0, 0); err != nil {
+					t.Fatalf("Delete returned error: %v", err)
+				}
+				if task, err = store.Restore(task.ID, 0); err != nil || task.Version != 5 || task.Title != "Final" {
+					t.Errorf("Restore = %+v, %v; want Final at version 5", task, err)
+				}
+			})
+
+			t.Run("TrashAndRestore", func(t *testing.T) {
+				store := newStore(t)
+				create := func(title string, parentID int) Task {
+					t.Helper()
+					task, err := store.Create(Task{Title: title, DueDate: "2024-12-01", Priority: 1, Status: "Pending", ParentID: parentID, Tags: []string{"ops"}}, 0)
+					if err != nil {
+						t.Fatalf("Create returned error: %v", err)
+					}
+					return task
+				}
+				release := create("Release", 0)
+				review := create("Review", release.ID)
+				notes := create("Notes", release.ID)
+				deploy := create("Deploy", 0)
+				if err := store.AddBlocker(deploy.ID, review.ID); err != nil {
+					t.Fatalf("AddBlocker returned error: %v", err)
+				}
+				titles := func(q TaskQuery) string {
+					t.Helper()
+					tasks, err := store.List(q)
+					if err != nil {
+						t.Fatalf("List returned error: %v", err)
+					}
+					var out []string
+					for _, task := range tasks {
+						out = append(out, task.Title)
+					}
+					return strings.Join(out, ",")
+				}
+
+				if err := store.Delete(notes.ID, 0, 0); err != nil {
+					t.Fatalf("Delete returned error: %v", err)
+				}
+				// Tasks deleted apart are restored apart.
+				time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+				if err := store.Delete(release.ID, 0, 0); err != nil {
+					t.Fatalf("Delete returned error: %v", err)
+				}
+				if got := titles(TaskQuery{Sort: []SortKey{{Field: "title"}}}); got != "Deploy" {
+					t.Errorf("List after Delete = %s, want Deploy", got)
+				}
+				if got := titles(TaskQuery{Deleted: true, Sort: []SortKey{{Field: "title"}}}); got != "Notes,Release,Review" {
+					t.Errorf("List of the trash = %s, want Notes,Release,Review", got)
+				}
+				if blockers, err := store.ListBlockers(deploy.ID); err != nil || len(blockers) != 0 {
+					t.Errorf("ListBlockers of a deleted blocker = %+v, %v; want none", blockers, err)
+				}
+				if tags, err := store.ListTags(0); err != nil || len(tags) != 1 || tags[0].Count != 1 {
+					t.Errorf("ListTags = %+v, %v; want ops on Deploy only", tags, err)
+				}
+				if _, err := store.Create(Task{Title: "Late", DueDate: "2024-12-01", Priority: 1, Status: "Pending", ParentID: release.ID}, 0); !errors.Is(err, ErrParentNotFound) {
+					t.Errorf("Create under a deleted parent returned %v, want ErrParentNotFound", err)
+				}
+
+				if _, err := store.Restore(review.ID, 0); !errors.Is(err, ErrParentDeleted) {
+					t.Errorf("Restore of a subtask of a deleted task returned %v, want ErrParentDeleted", err)
+				}
+				restored, err := store.Restore(release.ID, 0)
+				if err != nil || restored.DeletedAt != nil || restored.Title != "Release" {
+					t.Fatalf("Restore = %+v, %v; want Release out of the trash", restored, err)
+				}
+				if _, err := store.Restore(release.ID, 0); !errors.Is(err, ErrTaskNotDeleted) {
+					t.Errorf("Restoring a task twice returned %v, want ErrTaskNotDeleted", err)
+				}
+				if got := titles(TaskQuery{Deleted: true}); got != "Notes" {
+					t.Errorf("List of the trash after Restore = %s, want Notes", got)
+				}
+				if blockers, err := store.ListBlockers(deploy.ID); err != nil || len(blockers) != 1 {
+					t.Errorf("ListBlockers after Restore = %+v, %v; want Review back", blockers, err)
+				}
+				if entries, _ := store.TaskHistory(review.ID); len(entries) != 3 || entries[2].Action != HistoryUpdate {
+					t.Errorf("History of a restored subtask = %+v, want create, delete and update", entries)
+				}
+			})
+
+			t.Run("UsersTokensAndSessions", func(t *testing.T) {
+				store := newStore(t)
+				now := time.Unix(1700000000, 0)
+				user, err := store.CreateUser(User{Username: "alice", PasswordHash: "hash", CreatedAt: now})
+				if err != nil {
+					t.Fatalf("CreateUser returned error: %v", err)
+				}
+				if _, err := store.CreateUser(User{Username: "alice", PasswordHash: "other", CreatedAt: now}); !errors.Is(err, ErrUserExists) {
+					t.Errorf("CreateUser with a taken name returned %v, want ErrUserExists", err)
+				}
+				if got, err := store.GetUserByName("alice"); err != nil || got.ID != user.ID || got.PasswordHash != "hash" || got.Role != RoleEditor {
+					t.Errorf("GetUserByName = %+v, %v; want editor %d", got, err, user.ID)
+				}
+				if err := store.SetUserRole(user.ID, RoleAdmin); err != nil {
+					t.Fatalf("SetUserRole returned error: %v", err)
+				}
+				if got, err := store.GetUser(user.ID); err != nil || got.Role != RoleAdmin {
+					t.Errorf("GetUser after SetUserRole = %+v, %v; want an admin", got, err)
+				}
+				if err := store.SetUserRole(user.ID+100, RoleAdmin); !errors.Is(err, ErrUserNotFound) {
+					t.Errorf("SetUserRole of a missing user returned %v, want ErrUserNotFound", err)
+				}
+				if _, err := store.GetUserByName("bob"); !errors.Is(err, ErrUserNotFound) {
+					t.Errorf("GetUserByName of a missing user returned %v, want ErrUserNotFound", err)
+				}
+
+				token, err := store.CreateToken(APIToken{UserID: user.ID, Name: "ci", Hash: "token-hash", CreatedAt: now})
+				if err != nil {
+					t.Fatalf("CreateToken returned error: %v", err)
+				}
+				if got, err := store.UserForToken("token-hash", TokenScopeAPI, now.Add(time.Minute)); err != nil || got.ID != user.ID {
+					t.Errorf("UserForToken = %+v, %v; want user %d", got, err, user.ID)
+				}
+				if token.Scope != TokenScopeAPI {
+					t.Errorf("CreateToken saved scope %q, want %q", token.Scope, TokenScopeAPI)
+				}
+				if _, err := store.UserForToken("token-hash", TokenScopeCalendar, now); !errors.Is(err, ErrUserNotFound) {
+					t.Errorf("UserForToken in the wrong scope returned %v, want ErrUserNotFound", err)
+				}
+				tokens, err := store.ListTokens(user.ID)
+				if err != nil || len(tokens) != 1 || tokens[0].LastUsedAt == nil || !tokens[0].LastUsedAt.Equal(now.Add(time.Minute)) {
+					t.Errorf("ListTokens = %+v, %v; want the token marked as used", tokens, err)
+				}
+				if err := store.DeleteToken(user.ID+1, token.ID); !errors.Is(err, ErrTokenNotFound) {
+					t.Errorf("DeleteToken of another user's token returned %v, want ErrTokenNotFound", err)
+				}
+				if err := store.DeleteToken(user.ID, token.ID); err != nil {
+					t.Fatalf("DeleteToken returned error: %v", err)
+				}
+				if _, err := store.UserForToken("token-hash", TokenScopeAPI, now); !errors.Is(err, ErrUserNotFound) {
+					t.Errorf("UserForToken of a revoked token returned %v, want ErrUserNotFound", err)
+				}
+
+				for _, hash := range []string{"live", "expired"} {
+					expires := now.Add(time.Hour)
+					if hash == "expired" {
+						expires = now.Add(-time.Hour)
+					}
+					if err := store.CreateSession(Session{Hash: hash, UserID: user.ID, ExpiresAt: expires}); err != nil {
+						t.Fatalf("CreateSession returned error: %v", err)
+					}
+				}
+				if got, err := store.UserForSession("live", now); err != nil || got.ID != user.ID {
+					t.Errorf("UserForSession = %+v, %v; want user %d", got, err, user.ID)
+				}
+				if _, err := store.UserForSession("expired", now); !errors.Is(err, ErrUserNotFound) {
+					t.Errorf("UserForSession of an expired session returned %v, want ErrUserNotFound", err)
+				}
+				if purged, err := store.PurgeSessions(now); err != nil || purged != 1 {
+					t.Errorf("PurgeSessions = %d, %v; want 1", purged, err)
+				}
+				if err := store.DeleteSession("live"); err != nil {
+					t.Fatalf("DeleteSession returned error: %v", err)
+				}
+				if _, err := store.UserForSession("live", now); !errors.Is(err, ErrUserNotFound) {
+					t.Errorf("UserForSession after DeleteSession returned %v, want ErrUserNotFound", err)
+				}
+			})
+
+			t.Run("Projects", func(t *testing.T) {
+				store := newStore(t)
+				now := time.Unix(1700000000, 0)
+				owner, err := store.CreateUser(User{Username: "owner", PasswordHash: "hash", CreatedAt: now})
+				if err != nil {
+					t.Fatalf("CreateUser returned error: %v", err)
+				}
+				project, err := store.CreateProject(Project{Name: "Board", OwnerID: owner.ID, CreatedAt: now})
+				if err != nil {
+					t.Fatalf("CreateProject returned error: %v", err)
+				}
+				if _, err := store.CreateProject(Project{Name: "Board", OwnerID: owner.ID, CreatedAt: now}); !errors.Is(err, ErrProjectExists) {
+					t.Errorf("CreateProject with a taken name returned %v, want ErrProjectExists", err)
+				}
+				if _, err := store.CreateProject(Project{Name: "Board", OwnerID: owner.ID + 100, CreatedAt: now}); !errors.Is(err, ErrUserNotFound) {
+					t.Errorf("CreateProject for a missing user returned %v, want ErrUserNotFound", err)
+				}
+				if _, err := store.Create(Task{Title: "Lost", DueDate: "2024-12-01", Priority: 1, Status: "Pending", ProjectID: project.ID + 100}, 0); !errors.Is(err, ErrProjectNotFound) {
+					t.Errorf("Create in a missing project returned %v, want ErrProjectNotFound", err)
+				}
+
+				first, _ := store.Create(Task{Title: "First", DueDate: "2024-12-01", Priority: 1, Status: "Pending", ProjectID: project.ID}, 0)
+				second, _ := store.Create(Task{Title: "Second", DueDate: "2024-12-01", Priority: 1, Status: "Pending", ProjectID: project.ID}, 0)
+				if first.Position != 1 || second.Position != 2 {
+					t.Errorf("Tasks got positions %d and %d, want 1 and 2", first.Position, second.Position)
+				}
+				loose, _ := store.Create(Task{Title: "Loose", DueDate: "2024-12-01", Priority: 1, Status: "Pending"}, 0)
+				if loose.Position != 0 {
+					t.Errorf("Task without a project got position %d, want 0", loose.Position)
+				}
+				tasks, err := store.List(TaskQuery{ProjectID: project.ID, Sort: []SortKey{{Field: "position", Desc: true}}})
+				if err != nil || len(tasks) != 2 || tasks[0].ID != second.ID {
+					t.Errorf("List of the project = %+v, %v; want Second then First", tasks, err)
+				}
+
+				renamed, err := store.UpdateProject(Project{ID: project.ID, Name: "Renamed", Description: "new"})
+				if err != nil || renamed.Name != "Renamed" || renamed.CreatedAt.Unix() != now.Unix() {
+					t.Errorf("UpdateProject = %+v, %v; want the project renamed", renamed, err)
+				}
+
+				if err := store.DeleteProject(project.ID, false, 0); !errors.Is(err, ErrProjectNotEmpty) {
+					t.Errorf("DeleteProject of a project with tasks returned %v, want ErrProjectNotEmpty", err)
+				}
+				if err := store.DeleteProject(project.ID, true, 0); err != nil {
+					t.Fatalf("DeleteProject with cascade returned error: %v", err)
+				}
+				if got, err := store.Get(first.ID); err != nil || got.DeletedAt == nil || got.ProjectID != 0 {
+					t.Errorf("Task of the deleted project = %+v, %v; want it in the trash without a project", got, err)
+				}
+				if n, err := store.PurgeDeletedTasks(time.Now().Add(time.Second)); err != nil || n != 2 {
+					t.Errorf("PurgeDeletedTasks after the cascade = %d, %v; want 2", n, err)
+				}
+				if _, err := store.Get(loose.ID); err != nil {
+					t.Errorf("Cascade deleted a task outside the project: %v", err)
+				}
+				if err := store.DeleteProject(project.ID, true, 0); !errors.Is(err, ErrProjectNotFound) {
+					t.Errorf("DeleteProject of a deleted project returned %v, want ErrProjectNotFound", err)
+				}
+			})
+
+			t.Run("Tags", func(t *testing.T) {
+				store := newStore(t)
+				now := time.Unix(1700000000, 0)
+				alice, _ := store.CreateUser(User{Username: "alice", PasswordHash: "hash", CreatedAt: now})
+				bob, _ := store.CreateUser(User{Username: "bob", PasswordHash: "hash", CreatedAt: now})
+				create := func(title string, owner int, tags ...string) Task {
+					t.Helper()
+					task, err := store.Create(Task{Title: title, DueDate: "2024-12-01", Priority: 1, Status: "Pending", OwnerID: owner, Tags: tags}, 0)
+					if err != nil {
+						t.Fatalf("Create returned error: %v", err)
+					}
+					return task
+				}
+				both := create("Both", alice.ID, "infra", "bug", "bug")
+				if !reflect.DeepEqual(both.Tags, []string{"bug", "infra"}) {
+					t.Errorf("Create returned tags %v, want [bug infra]", both.Tags)
+				}
+				create("Bug", alice.ID, "bug")
+				create("Defect", alice.ID, "defect", "infra")
+				create("Bob's", bob.ID, "defect")
+				create("Untagged", alice.ID)
+
+				titles := func(q TaskQuery) string {
+					t.Helper()
+					tasks, err := store.List(q)
+					if err != nil {
+						t.Fatalf("List returned error: %v", err)
+					}
+					var out []string
+					for _, task := range tasks {
+						out = append(out, task.Title)
+					}
+					return strings.Join(out, ",")
+				}
+				if got := titles(TaskQuery{Tags: []string{"bug", "defect"}}); got != "Both,Bug,Defect,Bob's" {
+					t.Errorf("List with any tag = %s, want Both,Bug,Defect,Bob's", got)
+				}
+				if got := titles(TaskQuery{Tags: []string{"bug", "infra"}, AllTags: true}); got != "Both" {
+					t.Errorf("List with all tags = %s, want Both", got)
+				}
+
+				tags, err := store.ListTags(alice.ID)
+				want := []Tag{{Name: "bug", Count: 2}, {Name: "defect", Count: 1}, {Name: "infra", Count: 2}}
+				if err != nil || !reflect.DeepEqual(tags, want) {
+					t.Errorf("ListTags = %+v, %v; want %+v", tags, err, want)
+				}
+
+				changed, err := store.MergeTags(alice.ID, []string{"defect", "bug"}, "bug", alice.ID)
+				if err != nil || changed != 1 {
+					t.Errorf("MergeTags = %d, %v; want 1 task changed", changed, err)
+				}
+				if got := titles(TaskQuery{Tags: []string{"bug"}}); got != "Both,Bug,Defect" {
+					t.Errorf("List of bug after merging = %s, want Both,Bug,Defect", got)
+				}
+				if got := titles(TaskQuery{Tags: []string{"defect"}}); got != "Bob's" {
+					t.Errorf("Merging touched the tasks of another user: defect is on %s", got)
+				}
+
+				// Replacing a task's tags drops the old ones.
+				both.Tags = []string{"ops"}
+				if _, err := store.Update(both, 0); err != nil {
+					t.Fatalf("Update returned error: %v", err)
+				}
+				if got, _ := store.Get(both.ID); !reflect.DeepEqual(got.Tags, []string{"ops"}) {
+					t.Errorf("Get after Update returned tags %v, want [ops]", got.Tags)
+				}
+				tags, _ = store.ListTags(0)
+				want = []Tag{{Name: "bug", Count: 2}, {Name: "defect", Count: 1}, {Name: "infra", Count: 1}, {Name: "ops", Count: 1}}
+				if !reflect.DeepEqual(tags, want) {
+					t.Errorf("ListTags of everyone = %+v, want %+v", tags, want)
+				}
+			})
+
+			t.Run("SubtasksAndBlockers", func(t *testing.T) {
+				store := newStore(t)
+				create := func(title string, parentID int) Task {
+					t.Helper()
+					task, err := store.Create(Task{Title: title, DueDate: "2024-12-01", Priority: 1, Status: "Pending", ParentID: parentID}, 0)
+					if err != nil {
+						t.Fatalf("Create returned error: %v", err)
+					}
+					return task
+				}
+				release := create("Release", 0)
+				review := create("Review", release.ID)
+				checklist := create("Checklist", review.ID)
+				deploy := create("Deploy", 0)
+
+				if _, err := store.Create(Task{Title: "Orphan", DueDate: "2024-12-01", Priority: 1, Status: "Pending", ParentID: 999}, 0); !errors.Is(err, ErrParentNotFound) {
+					t.Errorf("Create with a missing parent returned %v, want ErrParentNotFound", err)
+				}
+				release.ParentID = checklist.ID
+				if _, err := store.Update(release, 0); !errors.Is(err, ErrCycle) {
+					t.Errorf("Update making a task its own grandchild returned %v, want ErrCycle", err)
+				}
+				if subtasks, err := store.List(TaskQuery{ParentID: release.ID}); err != nil || len(subtasks) != 1 || subtasks[0].ID != review.ID {
+					t.Errorf("List of subtasks = %+v, %v; want Review", subtasks, err)
+				}
+
+				if err := store.AddBlocker(deploy.ID, review.ID); err != nil {
+					t.Fatalf("AddBlocker returned error: %v", err)
+				}
+				if err := store.AddBlocker(deploy.ID, review.ID); err != nil {
+					t.Errorf("Adding a blocker twice returned %v", err)
+				}
+				if err := store.AddBlocker(review.ID, checklist.ID); err != nil {
+					t.Fatalf("AddBlocker returned error: %v", err)
+				}
+				for _, edge := range [][2]int{{checklist.ID, deploy.ID}, {deploy.ID, deploy.ID}} {
+					if err := store.AddBlocker(edge[0], edge[1]); !errors.Is(err, ErrCycle) {
+						t.Errorf("AddBlocker(%d, %d) returned %v, want ErrCycle", edge[0], edge[1], err)
+					}
+				}
+				if err := store.AddBlocker(deploy.ID, 999); !errors.Is(err, ErrTaskNotFound) {
+					t.Errorf("AddBlocker of a missing task returned %v, want ErrTaskNotFound", err)
+				}
+				if blockers, err := store.ListBlockers(deploy.ID); err != nil || len(blockers) != 1 || blockers[0].Title != "Review" {
+					t.Errorf("ListBlockers = %+v, %v; want Review", blockers, err)
+				}
+
+				if err := store.RemoveBlocker(review.ID, checklist.ID); err != nil {
+					t.Errorf("RemoveBlocker returned error: %v", err)
+				}
+				if err := store.RemoveBlocker(review.ID, checklist.ID); !errors.Is(err, ErrDependencyNotFound) {
+					t.Errorf("Removing a missing blocker returned %v, want ErrDependencyNotFound", err)
+				}
+
+				// Purging a task takes its subtasks and their dependencies.
+				if err := store.Delete(release.ID, 0, 0); err != nil {
+					t.Fatalf("Delete returned error: %v", err)
+				}
+				if n, err := store.PurgeDeletedTasks(time.Now().Add(time.Second)); err != nil || n != 3 {
+					t.Errorf("PurgeDeletedTasks = %d, %v; want the task and its two subtasks", n, err)
+				}
+				if _, err := store.Get(checklist.ID); !errors.Is(err, ErrTaskNotFound) {
+					t.Errorf("Get of a purged task's subtask returned %v, want ErrTaskNotFound", err)
+				}
+				if blockers, err := store.ListBlockers(deploy.ID); err != nil || len(blockers) != 0 {
+					t.Errorf("ListBlockers after deleting the blocker = %+v, %v; want none", blockers, err)
+				}
+			})
+
+			t.Run("History", func(t *testing.T) {
+				store := newStore(t)
+				task, err := store.Create(Task{Title: "Draft", DueDate: "2024-12-01", Priority: 2, Status: "Pending", Tags: []string{"docs"}}, 7)
+				if err != nil {
+					t.Fatalf("Create returned error: %v", err)
+				}
+				task.Title = "Final"
+				task.Status = "Completed"
+				if task, err = store.Update(task, 8); err != nil {
+					t.Fatalf("Update returned error: %v", err)
+				}
+				if _, err := store.Update(task, 8); err != nil {
+					t.Fatalf("Update returned error: %v", err)
+				}
+				if err := store.Delete(task.ID, 0, 0); err != nil {
+					t.Fatalf("Delete returned error: %v", err)
+				}
+				deleted, err := store.Get(task.ID)
+				if err != nil || deleted.DeletedAt == nil {
+					t.Fatalf("Get after Delete = %+v, %v, want the task in the trash", deleted, err)
+				}
+				deletedAt, _ := json.Marshal(deleted.DeletedAt)
+
+				entries, err := store.TaskHistory(task.ID)
+				if err != nil {
+					t.Fatalf("TaskHistory returned error: %v", err)
+				}
+				if len(entries) != 3 {
+					t.Fatalf("TaskHistory returned %d entries, want create, update and delete: %+v", len(entries), entries)
+				}
+				describe := func(changes []FieldChange) string {
+					var out []string
+					for _, c := range changes {
+						out = append(out, fmt.Sprintf("%s:%s->%s", c.Field, c.Old, c.New))
+					}
+					return strings.Join(out, " ")
+				}
+				want := []struct {
+					action  string
+					actorID int
+					changes string
+				}{
+					{HistoryCreate, 7, `description:null->"" due_date:null->"2024-12-01" priority:null->2 status:null->"Pending" tags:null->["docs"] title:null->"Draft"`},
+					{HistoryUpdate, 8, `status:"Pending"->"Completed" title:"Draft"->"Final"`},
+					{HistoryDelete, 0, "deleted_at:null->" + string(deletedAt)},
+				}
+				for i, entry := range entries {
+					if entry.TaskID != task.ID || entry.Action != want[i].action || entry.ActorID != want[i].actorID || entry.At.IsZero() {
+						t.Errorf("Entry %d = %+v, want %s by %d", i, entry, want[i].action, want[i].actorID)
+					}
+					if got := describe(entry.Changes); got != want[i].changes {
+						t.Errorf("Entry %d changed %s\nwant %s", i, got, want[i].changes)
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestMemoryStoreConcurrentAccess(t *testing.T) {
+	store := NewMemoryStore()
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 50; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			task := Task{ID: id, Title: "Concurrent", DueDate: "2024-12-01", Priority: 1 + id%3, Status: "Pending"}
+			if _, err := store.Create(task, 0); err != nil {
+				t.Errorf("Create returned error: %v", err)
+			}
+			if _, err := store.List(TaskQuery{}); err != nil {
+				t.Errorf("List returned error: %v", err)
+			}
+			task.Status = "Completed"
+			if _, err := store.Update(task, 0); err != nil {
+				t.Errorf("Update returned error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	tasks, err := store.List(TaskQuery{})
+	if err != nil {
+		t.Fatalf("List returned error: %v", err)
+	}
+	if len(tasks) != 50 {
+		t.Errorf("Expected 50 tasks, got %d", len(tasks))
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// maxTaskTags is how many tags a single task can have.
+const maxTaskTags = 20
+
+// tagPattern is what a tag looks like once normalized: lowercase letters,
+// digits and a little punctuation, such as "bug", "infra" or "team:web".
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.:-]{0,49}$`)
+
+// normalizeTags lowercases and trims tags and returns them sorted and
+// without duplicates, or nil when there are none. Tags are compared in this
+// form everywhere, so "Bug" and "bug " are the same tag.
+func normalizeTags(tags []string) []string {
+	var out []string
+	for _, tag := range tags {
+		out = append(out, strings.ToLower(strings.TrimSpace(tag)))
+	}
+	slices.Sort(out)
+	return slices.Compact(out)
+}
+
+// validateTags checks normalized tags.
+func validateTags(tags []string) []FieldError {
+	var errs []FieldError
+	if len(tags) > maxTaskTags {
+		errs = append(errs, FieldError{Field: "tags", Message: fmt.Sprintf("a task can have at most %d tags", maxTaskTags)})
+	}
+	for _, tag := range tags {
+		errs = append(errs, validateTagName("tags", tag)...)
+	}
+	return errs
+}
+
+// validateTagName checks a single normalized tag given in field.
+func validateTagName(field, tag string) []FieldError {
+	if !tagPattern.MatchString(tag) {
+		return []FieldError{{Field: field, Message: fmt.Sprintf("%q is not a valid tag", tag)}}
+	}
+	return nil
+}
+
+// tagScope returns the owner whose tasks the calling user's tag listing
+// and changes apply to, zero meaning every user.
+func (app *App) tagScope(r *http.Request) int {
+	var q TaskQuery
+	app.authorizer().Scope(currentUser(r.Context()), &q)
+	return q.OwnerID
+}
+
+// authorizeTagChange checks that the calling user may change the tags of
+// their tasks, which renaming and merging tags does.
+func (app *App) authorizeTagChange(w http.ResponseWriter, r *http.Request) bool {
+	return app.authorize(w, r, ActionUpdate, Task{OwnerID: currentUser(r.Context()).ID})
+}
+
+// getTags handles GET /tags, listing the tags on the tasks the calling user
+// can see with how many of those tasks have each.
+func (app *App) getTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := app.Store.ListTags(app.tagScope(r))
+	if err != nil {
+		writeServerError(w, r, "Failed to fetch tags", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tags)
+}
+
+// renameTag handles PATCH /tags/{name}, whose body names the tag anew. A
+// name that is already in use is refused; merge the tags instead.
+func (app *App) renameTag(w http.ResponseWriter, r *http.Request) {
+	if !app.authorizeTagChange(w, r) {
+		return
+	}
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "request body must be a JSON object")
+		return
+	}
+	from := normalizeTags([]string{r.PathValue("name")})[0]
+	to := normalizeTags([]string{body.Name})[0]
+	if errs := validateTagName("name", to); len(errs) > 0 {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	tags, err := app.Store.ListTags(app.tagScope(r))
+	if err != nil {
+		writeServerError(w, r, "Failed to rename tag", err)
+		return
+	}
+	inUse := func(name string) bool {
+		return slices.ContainsFunc(tags, func(tag Tag) bool { return tag.Name == name })
+	}
+	if !inUse(from) {
+		writeError(w, r, http.StatusNotFound, "tag_not_found", fmt.Sprintf("no task is tagged %q", from))
+		return
+	}
+	if to != from && inUse(to) {
+		writeError(w, r, http.StatusConflict, "tag_exists", fmt.Sprintf("tag %q is already in use; merge the tags instead", to))
+		return
+	}
+
+	app.mergeTagsInto(w, r, []string{from}, to)
+}
+
+// mergeTags handles POST /tags/{name}/merge, replacing the tags listed in
+// the body's "from" member with {name} on every task that has them.
+func (app *App) mergeTags(w http.ResponseWriter, r *http.Request) {
+	if !app.authorizeTagChange(w, r) {
+		return
+	}
+	var body struct {
+		From []string `json:"from"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "request body must be a JSON object")
+		return
+	}
+	into := normalizeTags([]string{r.PathValue("name")})[0]
+	from := normalizeTags(body.From)
+	errs := validateTagName("name", into)
+	if len(from) == 0 {
+		errs = append(errs, FieldError{Field: "from", Message: "from must list the tags to merge"})
+	}
+	for _, tag := range from {
+		errs = append(errs, validateTagName("from", tag)...)
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	app.mergeTagsInto(w, r, from, into)
+}
+
+// mergeTagsInto merges tags from into tag into on the tasks in the calling
+// user's scope and reports how many tasks changed.
+func (app *App) mergeTagsInto(w http.ResponseWriter, r *http.Request, from []string, into string) {
+	changed, err := app.Store.MergeTags(app.tagScope(r), from, into, currentUser(r.Context()).ID)
+	if err != nil {
+		writeServerError(w, r, "Failed to merge tags", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"name": into, "tasks_changed": changed})
+}
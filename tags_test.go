@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTaskTags(t *testing.T) {
+	store := newTestStore(t)
+	handler := NewRouter(&App{Store: store})
+
+	body := `{"title": "Crash on login", "due_date": "2024-12-01", "priority": 1, "tags": ["Bug", " customer ", "bug"]}`
+	rr := executeRequest(httptest.NewRequest(http.MethodPost, "/tasks", strings.NewReader(body)), handler)
+	var task Task
+	json.Unmarshal(rr.Body.Bytes(), &task)
+	if rr.Code != http.StatusCreated || !reflect.DeepEqual(task.Tags, []string{"bug", "customer"}) {
+		t.Fatalf("POST /tasks returned %v %s, want tags [bug customer]", rr.Code, rr.Body.String())
+	}
+
+	for _, body := range []string{
+		`{"title": "Bad", "due_date": "2024-12-01", "priority": 1, "tags": ["has space"]}`,
+		`{"title": "Bad", "due_date": "2024-12-01", "priority": 1, "tags": [""]}`,
+	} {
+		assertProblem(t, executeRequest(httptest.NewRequest(http.MethodPost, "/tasks", strings.NewReader(body)), handler),
+			http.StatusUnprocessableEntity, "validation_failed")
+	}
+
+	path := fmt.Sprintf("/tasks/%d", task.ID)
+	rr = executeRequest(httptest.NewRequest(http.MethodPatch, path, strings.NewReader(`{"tags": ["infra"]}`)), handler)
+	json.Unmarshal(rr.Body.Bytes(), &task)
+	if rr.Code != http.StatusOK || !reflect.DeepEqual(task.Tags, []string{"infra"}) {
+		t.Errorf("PATCH tags returned %v %s, want tags [infra]", rr.Code, rr.Body.String())
+	}
+	rr = executeRequest(httptest.NewRequest(http.MethodPatch, path, strings.NewReader(`{"tags": null}`)), handler)
+	var cleared Task
+	json.Unmarshal(rr.Body.Bytes(), &cleared)
+	if rr.Code != http.StatusOK || cleared.Tags != nil {
+		t.Errorf("PATCH null tags returned %v %s, want no tags", rr.Code, rr.Body.String())
+	}
+}
+
+func TestFilterTasksByTag(t *testing.T) {
+	store := newTestStore(t)
+	handler := NewRouter(&App{Store: store})
+
+	createTaskInStore(t, store, Task{Title: "Outage", DueDate: "2024-12-01", Priority: 1, Tags: []string{"bug", "infra"}})
+	createTaskInStore(t, store, Task{Title: "Typo", DueDate: "2024-12-01", Priority: 2, Tags: []string{"bug"}})
+	createTaskInStore(t, store, Task{Title: "Upgrade", DueDate: "2024-12-01", Priority: 3, Tags: []string{"infra"}})
+	createTaskInStore(t, store, Task{Title: "Plain", DueDate: "2024-12-01", Priority: 3})
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"tag=bug", "Outage,Typo"},
+		{"tag=bug&tag=infra", "Outage,Typo,Upgrade"},
+		{"tag=bug,infra&tag_match=all", "Outage"},
+		{"tag=BUG&tag_match=any", "Outage,Typo"},
+		{"tag=nothing", ""},
+	}
+	for _, tt := range tests {
+		rr := executeRequest(httptest.NewRequest(http.MethodGet, "/tasks?"+tt.query, nil), handler)
+		var tasks []Task
+		json.Unmarshal(rr.Body.Bytes(), &tasks)
+		var titles []string
+		for _, task := range tasks {
+			titles = append(titles, task.Title)
+		}
+		if got := strings.Join(titles, ","); rr.Code != http.StatusOK || got != tt.want {
+			t.Errorf("GET /tasks?%s returned %v %q, want %q", tt.query, rr.Code, got, tt.want)
+		}
+	}
+
+	assertProblem(t, executeRequest(httptest.NewRequest(http.MethodGet, "/tasks?tag=bug&tag_match=some", nil), handler),
+		http.StatusBadRequest, "invalid_query")
+}
+
+func TestRenameAndMergeTags(t *testing.T) {
+	store := newTestStore(t)
+	handler := NewRouter(&App{Store: store})
+
+	other, otherToken := addTestUser(t, store, "other", RoleEditor)
+	_, viewer := addTestUser(t, store, "vera", RoleViewer)
+	createTaskInStore(t, store, Task{Title: "One", DueDate: "2024-12-01", Priority: 1, Tags: []string{"defect"}})
+	createTaskInStore(t, store, Task{Title: "Two", DueDate: "2024-12-01", Priority: 1, Tags: []string{"bug", "regression"}})
+	createTaskInStore(t, store, Task{Title: "Three", DueDate: "2024-12-01", Priority: 1, Tags: []string{"customer"}})
+	theirs := createTaskInStore(t, store, Task{Title: "Theirs", DueDate: "2024-12-01", Priority: 1, OwnerID: other.ID, Tags: []string{"defect"}})
+
+	listTags := func(token string) []Tag {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/tags", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := executeRequest(req, handler)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("GET /tags returned %v: %s", rr.Code, rr.Body.String())
+		}
+		var tags []Tag
+		json.Unmarshal(rr.Body.Bytes(), &tags)
+		return tags
+	}
+	want := []Tag{{Name: "bug", Count: 1}, {Name: "customer", Count: 1}, {Name: "defect", Count: 1}, {Name: "regression", Count: 1}}
+	if got := listTags(testToken); !reflect.DeepEqual(got, want) {
+		t.Errorf("GET /tags = %+v, want %+v", got, want)
+	}
+
+	rename := func(name, body string) *httptest.ResponseRecorder {
+		return executeRequest(httptest.NewRequest(http.MethodPatch, "/tags/"+name, strings.NewReader(body)), handler)
+	}
+	assertProblem(t, rename("missing", `{"name": "found"}`), http.StatusNotFound, "tag_not_found")
+	assertProblem(t, rename("defect", `{"name": "bug"}`), http.StatusConflict, "tag_exists")
+	assertProblem(t, rename("defect", `{"name": "not valid"}`), http.StatusUnprocessableEntity, "validation_failed")
+	if rr := rename("customer", `{"name": "Client"}`); rr.Code != http.StatusOK {
+		t.Errorf("PATCH /tags/customer returned %v: %s", rr.Code, rr.Body.String())
+	}
+
+	rr := executeRequest(httptest.NewRequest(http.MethodPost, "/tags/bug/merge", strings.NewReader(`{"from": ["defect", "regression"]}`)), handler)
+	var result struct {
+		Name         string `json:"name"`
+		TasksChanged int    `json:"tasks_changed"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &result)
+	if rr.Code != http.StatusOK || result.Name != "bug" || result.TasksChanged != 2 {
+		t.Errorf("POST /tags/bug/merge returned %v %s, want 2 tasks changed", rr.Code, rr.Body.String())
+	}
+	want = []Tag{{Name: "bug", Count: 2}, {Name: "client", Count: 1}}
+	if got := listTags(testToken); !reflect.DeepEqual(got, want) {
+		t.Errorf("GET /tags after merging = %+v, want %+v", got, want)
+	}
+	assertProblem(t, executeRequest(httptest.NewRequest(http.MethodPost, "/tags/bug/merge", strings.NewReader(`{"from": []}`)), handler),
+		http.StatusUnprocessableEntity, "validation_failed")
+
+	// Other users' tags are theirs to change.
+	if task, _ := store.Get(theirs); !reflect.DeepEqual(task.Tags, []string{"defect"}) {
+		t.Errorf("Merging changed the tags of another user's task to %v", task.Tags)
+	}
+	if got := listTags(otherToken); !reflect.DeepEqual(got, []Tag{{Name: "defect", Count: 1}}) {
+		t.Errorf("GET /tags as another user = %+v, want only their defect tag", got)
+	}
+
+	req := httptest.NewRequest(http.MethodPatch, "/tags/bug", strings.NewReader(`{"name": "issue"}`))
+	req.Header.Set("Authorization", "Bearer "+viewer)
+	assertProblem(t, executeRequest(req, handler), http.StatusForbidden, "forbidden")
+}
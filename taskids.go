@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// The task ID strategies, which say how new tasks are named to clients.
+// Every task has an integer ID from a sequence; with uuid and ulid it also
+// gets a UID of that kind, which the Location header of a created task uses
+// and task routes accept in place of the ID.
+const (
+	TaskIDsSequence = "sequence"
+	TaskIDsUUID     = "uuid"
+	TaskIDsULID     = "ulid"
+)
+
+// crockford is the alphabet of ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// newULID returns a ULID for now: 26 characters that sort by time, the
+// first 10 holding the milliseconds since the epoch and the rest
+// randomness.
+func newULID(now time.Time) string {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(now.UnixMilli())<<16)
+	rand.Read(b[6:])
+
+	// 128 bits in 26 characters of 5 bits, the first holding only 3.
+	out := make([]byte, 26)
+	hi, lo := binary.BigEndian.Uint64(b[:8]), binary.BigEndian.Uint64(b[8:])
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out)
+}
+
+// newTaskUID returns the UID of a new task under the configured strategy,
+// or "" under the sequence one.
+func (app *App) newTaskUID() string {
+	switch app.TaskIDs {
+	case TaskIDsUUID:
+		return newUUID()
+	case TaskIDsULID:
+		return newULID(time.Now())
+	}
+	return ""
+}
+
+// taskPath returns the URL path of a task, by UID when it has one.
+func taskPath(task Task) string {
+	if task.UID != "" {
+		return "/tasks/" + task.UID
+	}
+	return fmt.Sprintf("/tasks/%d", task.ID)
+}
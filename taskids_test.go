@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewUID(t *testing.T) {
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	if got := newUUID(); !uuid.MatchString(got) || got == newUUID() {
+		t.Errorf("newUUID() = %q, want a random version 4 UUID", got)
+	}
+
+	ulid := regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)
+	now := time.UnixMilli(1700000000000)
+	first, second := newULID(now), newULID(now.Add(time.Millisecond))
+	if !ulid.MatchString(first) || first == newULID(now) {
+		t.Errorf("newULID() = %q, want a random ULID", first)
+	}
+	// 1700000000000 ms in Crockford base32.
+	if first[:10] != "01HF7YAT00" || second[:10] != "01HF7YAT01" {
+		t.Errorf("newULID() = %q then %q, want the time in the first 10 characters", first, second)
+	}
+}
+
+func TestTaskIDStrategies(t *testing.T) {
+	for strategy, format := range map[string]*regexp.Regexp{
+		TaskIDsSequence: regexp.MustCompile(`^/tasks/\d+$`),
+		TaskIDsUUID:     regexp.MustCompile(`^/tasks/[0-9a-f-]{36}$`),
+		TaskIDsULID:     regexp.MustCompile(`^/tasks/[0-9A-Z]{26}$`),
+	} {
+		t.Run(strategy, func(t *testing.T) {
+			store := newTestStore(t)
+			handler := NewRouter(&App{Store: store, TaskIDs: strategy})
+
+			rr := executeRequest(httptest.NewRequest(http.MethodPost, "/tasks",
+				strings.NewReader(`{"title": "Ship", "due_date": "2024-12-01", "priority": 1}`)), handler)
+			var task Task
+			json.Unmarshal(rr.Body.Bytes(), &task)
+			location := rr.Header().Get("Location")
+			if rr.Code != http.StatusCreated || !format.MatchString(location) || (strategy == TaskIDsSequence) != (task.UID == "") {
+				t.Fatalf("POST /tasks returned %v with Location %q: %s", rr.Code, location, rr.Body.String())
+			}
+
+			// The task is found at its Location, and keeps its UID through
+			// a full replace.
+			rr = executeRequest(httptest.NewRequest(http.MethodPut, location,
+				strings.NewReader(`{"title": "Shipped", "due_date": "2024-12-01", "priority": 1}`)), handler)
+			var replaced Task
+			json.Unmarshal(rr.Body.Bytes(), &replaced)
+			if rr.Code != http.StatusOK || replaced.ID != task.ID || replaced.UID != task.UID || replaced.Title != "Shipped" {
+				t.Errorf("PUT %s returned %v: %s", location, rr.Code, rr.Body.String())
+			}
+			if rr := executeRequest(httptest.NewRequest(http.MethodGet, fmt.Sprintf("/tasks/%d", task.ID), nil), handler); rr.Code != http.StatusOK {
+				t.Errorf("GET of the task by its ID returned %v", rr.Code)
+			}
+		})
+	}
+
+	store := newTestStore(t)
+	handler := NewRouter(&App{Store: store, TaskIDs: TaskIDsULID})
+	assertProblem(t, executeRequest(httptest.NewRequest(http.MethodGet, "/tasks/01HF3P0H000000000000000000", nil), handler),
+		http.StatusNotFound, "task_not_found")
+	assertProblem(t, executeRequest(httptest.NewRequest(http.MethodPost, "/tasks",
+		strings.NewReader(`{"uid": "mine", "title": "Ship", "due_date": "2024-12-01", "priority": 1}`)), handler),
+		http.StatusUnprocessableEntity, "validation_failed")
+	handler = NewRouter(&App{Store: store})
+	assertProblem(t, executeRequest(httptest.NewRequest(http.MethodGet, "/tasks/abc", nil), handler),
+		http.StatusBadRequest, "invalid_task_id")
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// webhookEvents are the events a webhook can subscribe to, and those it
+// gets when it does not say.
+var webhookEvents = []string{EventTaskCreated, EventTaskUpdated, EventTaskCompleted, EventTaskDeleted}
+
+// webhookDeliveryLogSize is how many deliveries GET
+// /webhooks/{id}/deliveries lists.
+const webhookDeliveryLogSize = 100
+
+func writeWebhookNotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusNotFound, "webhook_not_found", "webhook not found")
+}
+
+// errWebhookTarget refuses a webhook address that is not public.
+var errWebhookTarget = errors.New("webhooks cannot be sent to loopback, private or link-local addresses")
+
+// webhookAddrAllowed reports whether webhooks may be sent to addr. Only
+// public addresses are allowed, so that webhooks cannot reach the server
+// itself or the network it runs in.
+func webhookAddrAllowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate()
+}
+
+// checkWebhookHost resolves host and returns errWebhookTarget unless every
+// address it has may be sent webhooks.
+func checkWebhookHost(ctx context.Context, host string) error {
+	addrs := []netip.Addr{}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		addrs = append(addrs, addr)
+	} else if addrs, err = net.DefaultResolver.LookupNetIP(ctx, "ip", host); err != nil {
+		return fmt.Errorf("cannot resolve %s", host)
+	}
+	for _, addr := range addrs {
+		if !webhookAddrAllowed(addr) {
+			return errWebhookTarget
+		}
+	}
+	return nil
+}
+
+// validateWebhook checks a webhook about to be saved. Unless
+// AllowPrivateWebhooks is set, its URL must resolve to public addresses
+// only; the dispatcher checks again when it sends each delivery.
+func (app *App) validateWebhook(ctx context.Context, hook Webhook) []FieldError {
+	var errs []FieldError
+	if u, err := url.Parse(hook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, FieldError{Field: "url", Message: "url must be an http or https URL"})
+	} else if !app.AllowPrivateWebhooks {
+		if err := checkWebhookHost(ctx, u.Hostname()); err != nil {
+			errs = append(errs, FieldError{Field: "url", Message: err.Error()})
+		}
+	}
+	if len(hook.Events) == 0 {
+		errs = append(errs, FieldError{Field: "events", Message: "events must name at least one event"})
+	}
+	for _, event := range hook.Events {
+		if !slices.Contains(webhookEvents, event) {
+			errs = append(errs, FieldError{Field: "events", Message: fmt.Sprintf("unknown event %q", event)})
+		}
+	}
+	return errs
+}
+
+// loadWebhook fetches the webhook named by the {id} path parameter,
+// answering with a problem when that fails.
+func (app *App) loadWebhook(w http.ResponseWriter, r *http.Request) (Webhook, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_webhook_id", "webhook ID must be a number")
+		return Webhook{}, false
+	}
+	hook, err := app.Store.GetWebhook(id)
+	if errors.Is(err, ErrWebhookNotFound) {
+		writeWebhookNotFound(w, r)
+		return Webhook{}, false
+	} else if err != nil {
+		writeServerError(w, r, "Failed to fetch webhook", err)
+		return Webhook{}, false
+	}
+	return hook, true
+}
+
+// getWebhooks handles GET /webhooks, listing every webhook.
+func (app *App) getWebhooks(w http.ResponseWriter, r *http.Request) {
+	hooks, err := app.Store.ListWebhooks(0)
+	if err != nil {
+		writeServerError(w, r, "Failed to fetch webhooks", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hooks)
+}
+
+// createWebhook handles POST /webhooks. Webhooks are managed by admins,
+// and get the events of every task. A webhook gets every event and is
+// active unless the body says otherwise. The response is the only time the
+// secret the deliveries are signed with is shown.
+func (app *App) createWebhook(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+		Active *bool    `json:"active"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "request body must be a JSON object")
+		return
+	}
+	hook := Webhook{
+		OwnerID:   currentUser(r.Context()).ID,
+		URL:       body.URL,
+		Events:    body.Events,
+		Secret:    newSecret("whsec_"),
+		Active:    body.Active == nil || *body.Active,
+		CreatedAt: time.Now(),
+	}
+	if hook.Events == nil {
+		hook.Events = webhookEvents
+	}
+	if errs := app.validateWebhook(r.Context(), hook); len(errs) > 0 {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	created, err := app.Store.CreateWebhook(hook)
+	if err != nil {
+		writeServerError(w, r, "Failed to create webhook", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", fmt.Sprintf("/webhooks/%d", created.ID))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		Webhook
+		Secret string `json:"secret"`
+	}{created, created.Secret})
+}
+
+func (app *App) getWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, ok := app.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hook)
+}
+
+// updateWebhook handles PUT and PATCH /webhooks/{id}. The URL, events and
+// active flag can change; PATCH leaves out members untouched, and PUT
+// resets them to their defaults as on creation.
+func (app *App) updateWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, ok := app.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		URL    *string  `json:"url"`
+		Events []string `json:"events"`
+		Active *bool    `json:"active"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "request body must be a JSON object")
+		return
+	}
+	put := r.Method == http.MethodPut
+	if body.URL != nil || put {
+		hook.URL = ""
+		if body.URL != nil {
+			hook.URL = *body.URL
+		}
+	}
+	if body.Events != nil || put {
+		hook.Events = webhookEvents
+		if body.Events != nil {
+			hook.Events = body.Events
+		}
+	}
+	if body.Active != nil || put {
+		hook.Active = body.Active == nil || *body.Active
+	}
+	if errs := app.validateWebhook(r.Context(), hook); len(errs) > 0 {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	updated, err := app.Store.UpdateWebhook(hook)
+	if errors.Is(err, ErrWebhookNotFound) {
+		writeWebhookNotFound(w, r)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Failed to update webhook", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// deleteWebhook handles DELETE /webhooks/{id}. Deliveries not sent yet are
+// dropped along with the log.
+func (app *App) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, ok := app.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+	err := app.Store.DeleteWebhook(hook.ID)
+	if errors.Is(err, ErrWebhookNotFound) {
+		writeWebhookNotFound(w, r)
+		return
+	} else if err != nil {
+		writeServerError(w, r, "Failed to delete webhook", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getWebhookDeliveries handles GET /webhooks/{id}/deliveries, the log of
+// the latest deliveries of a webhook, newest first, with their payloads
+// and how sending them went.
+func (app *App) getWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	hook, ok := app.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+	deliveries, err := app.Store.ListWebhookDeliveries(hook.ID, webhookDeliveryLogSize)
+	if err != nil {
+		writeServerError(w, r, "Failed to fetch webhook deliveries", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookReceiver is an endpoint that records the events posted to it after
+// checking their signature.
+type webhookReceiver struct {
+	t      *testing.T
+	secret string
+
+	mu     sync.Mutex
+	status int
+	events []webhookEvent
+}
+
+func (rcv *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	want := "sha256=" + signWebhook(rcv.secret, r.Header.Get("Calidad-Timestamp"), body)
+	if got := r.Header.Get("Calidad-Signature"); got != want {
+		rcv.t.Errorf("Calidad-Signature = %q, want %q", got, want)
+	}
+	var event webhookEvent
+	if err := json.Unmarshal(body, &event); err != nil || event.Event != r.Header.Get("Calidad-Event") {
+		rcv.t.Errorf("Webhook received %s with Calidad-Event %q", body, r.Header.Get("Calidad-Event"))
+	}
+	if rcv.status != 0 {
+		w.WriteHeader(rcv.status)
+		return
+	}
+	rcv.events = append(rcv.events, event)
+}
+
+// received returns the events received so far, as "event task-title", and
+// forgets them.
+func (rcv *webhookReceiver) received() []string {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+
+	var got []string
+	for _, event := range rcv.events {
+		got = append(got, event.Event+" "+event.Task.Title)
+	}
+	rcv.events = nil
+	return got
+}
+
+func TestWebhooks(t *testing.T) {
+	store := newTestStore(t)
+	// The receiver listens on a loopback address.
+	handler := NewRouter(&App{Store: store, AllowPrivateWebhooks: true})
+	dispatcher := &WebhookDispatcher{Store: store, AllowPrivate: true}
+	receiver := &webhookReceiver{t: t}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	_, adminToken := addTestUser(t, store, "ada", RoleAdmin)
+	asAdmin := func(req *http.Request) *httptest.ResponseRecorder {
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		return executeRequest(req, handler)
+	}
+
+	rr := asAdmin(httptest.NewRequest(http.MethodPost, "/webhooks",
+		strings.NewReader(fmt.Sprintf(`{"url": %q, "events": ["task.created", "task.completed", "task.deleted"]}`, server.URL))))
+	var hook struct {
+		Webhook
+		Secret string `json:"secret"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &hook)
+	if rr.Code != http.StatusCreated || !strings.HasPrefix(hook.Secret, "whsec_") || !hook.Active || len(hook.Events) != 3 {
+		t.Fatalf("POST /webhooks returned %v: %s", rr.Code, rr.Body.String())
+	}
+	receiver.secret = hook.Secret
+	hookPath := fmt.Sprintf("/webhooks/%d", hook.ID)
+
+	for _, body := range []string{`{"url": "ftp://example.com"}`, `{"url": "https://example.com", "events": []}`, `{"url": "https://example.com", "events": ["task.moved"]}`} {
+		assertProblem(t, asAdmin(httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(body))),
+			http.StatusUnprocessableEntity, "validation_failed")
+	}
+	bob, _ := addTestUser(t, store, "bob", RoleEditor)
+
+	// Every change goes through the outbox, whichever way it is made, and
+	// only the events subscribed to are sent.
+	rr = executeRequest(httptest.NewRequest(http.MethodPost, "/tasks", strings.NewReader(`{"title": "Ship", "due_date": "2024-12-01", "priority": 1}`)), handler)
+	var task Task
+	json.Unmarshal(rr.Body.Bytes(), &task)
+	taskPath := fmt.Sprintf("/tasks/%d", task.ID)
+	executeRequest(httptest.NewRequest(http.MethodPatch, taskPath, strings.NewReader(`{"title": "Ship it"}`)), handler)
+	executeRequest(httptest.NewRequest(http.MethodPatch, taskPath, strings.NewReader(`{"status": "Completed"}`)), handler)
+	executeRequest(httptest.NewRequest(http.MethodDelete, taskPath, nil), handler)
+	createTaskInStore(t, store, Task{Title: "Bob's", DueDate: "2024-12-01", Priority: 1, OwnerID: bob.ID})
+	err := store.Atomically(func(tx Store) error {
+		createTaskInStore(t, tx, Task{Title: "Rolled back", DueDate: "2024-12-01", Priority: 1})
+		return errors.New("roll back")
+	})
+	if err == nil {
+		t.Fatal("Atomically did not return the error of fn")
+	}
+
+	if err := dispatcher.Deliver(context.Background(), time.Now()); err != nil {
+		t.Fatalf("Deliver returned error: %v", err)
+	}
+	if got, want := strings.Join(receiver.received(), ", "), "task.created Ship, task.completed Ship it, task.deleted Ship it, task.created Bob's"; got != want {
+		t.Errorf("Webhook received %q, want %q", got, want)
+	}
+	if err := dispatcher.Deliver(context.Background(), time.Now()); err != nil || len(receiver.received()) > 0 {
+		t.Errorf("Second Deliver sent deliveries again: %v", err)
+	}
+
+	// Failed deliveries are retried after a backoff.
+	receiver.status = http.StatusServiceUnavailable
+	createTaskInStore(t, store, Task{Title: "Retry", DueDate: "2024-12-01", Priority: 1})
+	now := time.Now()
+	dispatcher.Deliver(context.Background(), now)
+	deliveries := func() []WebhookDelivery {
+		t.Helper()
+		var deliveries []WebhookDelivery
+		rr := asAdmin(httptest.NewRequest(http.MethodGet, hookPath+"/deliveries", nil))
+		if err := json.Unmarshal(rr.Body.Bytes(), &deliveries); err != nil || rr.Code != http.StatusOK {
+			t.Fatalf("GET %s/deliveries returned %v: %s", hookPath, rr.Code, rr.Body.String())
+		}
+		return deliveries
+	}
+	log := deliveries()
+	if len(log) != 5 || log[0].Status != DeliveryPending || log[0].Attempts != 1 || log[0].ResponseCode != http.StatusServiceUnavailable ||
+		log[0].NextAttemptAt == nil || log[0].NextAttemptAt.Before(now.Add(webhookRetryDelay-time.Second)) ||
+		log[2].Status != DeliveryDelivered || log[2].Event != EventTaskDeleted || log[2].DeliveredAt == nil {
+		t.Fatalf("Delivery log = %+v", log)
+	}
+
+	receiver.status = 0
+	dispatcher.Deliver(context.Background(), now.Add(time.Second))
+	if got := receiver.received(); len(got) > 0 {
+		t.Errorf("Delivery was retried before its backoff: %q", got)
+	}
+	dispatcher.Deliver(context.Background(), now.Add(webhookRetryDelay+time.Second))
+	if got := receiver.received(); len(got) != 1 || got[0] != "task.created Retry" {
+		t.Errorf("Retry sent %q", got)
+	}
+	if log := deliveries(); log[0].Status != DeliveryDelivered || log[0].Attempts != 2 || log[0].Error != "" {
+		t.Errorf("Retried delivery = %+v", log[0])
+	}
+
+	// Inactive webhooks get nothing, and deleting one drops its log.
+	rr = asAdmin(httptest.NewRequest(http.MethodPatch, hookPath, strings.NewReader(`{"active": false}`)))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"active":false`) || strings.Contains(rr.Body.String(), "whsec_") {
+		t.Fatalf("PATCH %s returned %v: %s", hookPath, rr.Code, rr.Body.String())
+	}
+	createTaskInStore(t, store, Task{Title: "Quiet", DueDate: "2024-12-01", Priority: 1})
+	if log := deliveries(); len(log) != 5 {
+		t.Errorf("Inactive webhook has %d deliveries, want 5", len(log))
+	}
+	if rr := asAdmin(httptest.NewRequest(http.MethodDelete, hookPath, nil)); rr.Code != http.StatusNoContent {
+		t.Errorf("DELETE %s returned %v", hookPath, rr.Code)
+	}
+	assertProblem(t, asAdmin(httptest.NewRequest(http.MethodGet, hookPath+"/deliveries", nil)), http.StatusNotFound, "webhook_not_found")
+}
+
+func TestWebhooksAreAdminOnly(t *testing.T) {
+	store := newTestStore(t)
+	handler := NewRouter(&App{Store: store})
+	hook, err := store.CreateWebhook(Webhook{OwnerID: testUser(t, store).ID, URL: "https://example.com/hook", Events: webhookEvents,
+		Secret: "whsec_test", Active: true, CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("CreateWebhook returned error: %v", err)
+	}
+
+	// Not even the owner of a webhook can manage it without being an admin.
+	hookPath := fmt.Sprintf("/webhooks/%d", hook.ID)
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/webhooks", nil),
+		httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(`{"url": "https://example.com/mine"}`)),
+		httptest.NewRequest(http.MethodGet, hookPath, nil),
+		httptest.NewRequest(http.MethodPatch, hookPath, strings.NewReader(`{"url": "http://169.254.169.254/"}`)),
+		httptest.NewRequest(http.MethodDelete, hookPath, nil),
+		httptest.NewRequest(http.MethodGet, hookPath+"/deliveries", nil),
+	} {
+		assertProblem(t, executeRequest(req, handler), http.StatusForbidden, "forbidden")
+	}
+}
+
+func TestWebhookTargetsMustBePublic(t *testing.T) {
+	store := newTestStore(t)
+	handler := NewRouter(&App{Store: store})
+	_, adminToken := addTestUser(t, store, "ada", RoleAdmin)
+
+	for _, target := range []string{"http://127.0.0.1:8080/", "http://localhost/", "http://[::1]/", "http://10.0.0.7/",
+		"http://192.168.1.1/", "http://169.254.169.254/latest/meta-data", "http://[fe80::1]/", "http://[::ffff:127.0.0.1]/", "http://0.0.0.0/"} {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(fmt.Sprintf(`{"url": %q}`, target)))
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		assertProblem(t, executeRequest(req, handler), http.StatusUnprocessableEntity, "validation_failed")
+	}
+
+	// A webhook whose host came to resolve to a private address since it
+	// was saved is refused when the delivery is sent.
+	receiver := &webhookReceiver{t: t}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	hook, err := store.CreateWebhook(Webhook{OwnerID: testUser(t, store).ID, URL: server.URL, Events: webhookEvents,
+		Secret: "whsec_test", Active: true, CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("CreateWebhook returned error: %v", err)
+	}
+	createTaskInStore(t, store, Task{Title: "Ship", DueDate: "2024-12-01", Priority: 1})
+	if err := (&WebhookDispatcher{Store: store}).Deliver(context.Background(), time.Now()); err != nil {
+		t.Fatalf("Deliver returned error: %v", err)
+	}
+	if got := receiver.received(); len(got) > 0 {
+		t.Errorf("Webhook on a loopback address received %q", got)
+	}
+	deliveries, err := store.ListWebhookDeliveries(hook.ID, 10)
+	if err != nil || len(deliveries) != 1 || deliveries[0].Status != DeliveryPending || !strings.Contains(deliveries[0].Error, errWebhookTarget.Error()) {
+		t.Errorf("Delivery to a loopback address = %+v, %v; want it refused", deliveries, err)
+	}
+}
+
+// newTestWebhook subscribes an admin to every event at url, straight in
+// the store.
+func newTestWebhook(t *testing.T, store Store, url string) Webhook {
+	t.Helper()
+	admin, _ := addTestUser(t, store, "ada", RoleAdmin)
+	hook, err := store.CreateWebhook(Webhook{OwnerID: admin.ID, URL: url, Events: webhookEvents, Secret: "whsec_test", Active: true, CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("CreateWebhook returned error: %v", err)
+	}
+	return hook
+}
+
+func TestWebhookOutboxFollowsTransactions(t *testing.T) {
+	store := newTestStore(t)
+	hook := newTestWebhook(t, store, "https://example.com/hook")
+	id := createTaskInStore(t, store, Task{Title: "Ship", DueDate: "2024-12-01", Priority: 1})
+
+	err := store.Atomically(func(tx Store) error {
+		task, err := tx.Get(id)
+		if err != nil {
+			return err
+		}
+		task.Title = "Ship it"
+		if _, err := tx.Update(task, 0); err != nil {
+			return err
+		}
+		if deliveries, _ := tx.ListWebhookDeliveries(hook.ID, 10); len(deliveries) != 2 {
+			t.Errorf("Inside the transaction the outbox has %d deliveries, want 2", len(deliveries))
+		}
+		return errors.New("roll back")
+	})
+	if err == nil {
+		t.Fatal("Atomically did not return the error of fn")
+	}
+
+	deliveries, err := store.ListWebhookDeliveries(hook.ID, 10)
+	if err != nil || len(deliveries) != 1 || deliveries[0].Event != EventTaskCreated {
+		t.Errorf("Outbox after the rollback = %+v, %v; want only the creation", deliveries, err)
+	}
+	if task, _ := store.Get(id); task.Title != "Ship" {
+		t.Errorf("Rolled back update left title %q", task.Title)
+	}
+}
+
+func TestWebhookLeaseExpires(t *testing.T) {
+	store := newTestStore(t)
+	newTestWebhook(t, store, "https://example.com/hook")
+	createTaskInStore(t, store, Task{Title: "Ship", DueDate: "2024-12-01", Priority: 1})
+	now := time.Now()
+
+	claimed, err := store.ClaimWebhookDeliveries(now, webhookLease, webhookBatchSize)
+	if err != nil || len(claimed) != 1 {
+		t.Fatalf("ClaimWebhookDeliveries = %+v, %v; want the delivery", claimed, err)
+	}
+	if again, err := store.ClaimWebhookDeliveries(now.Add(webhookLease-time.Second), webhookLease, webhookBatchSize); err != nil || len(again) != 0 {
+		t.Errorf("Claim during the lease = %+v, %v; want nothing", again, err)
+	}
+	// A dispatcher that died while holding the delivery never records it;
+	// once the lease is over, another one gets it.
+	again, err := store.ClaimWebhookDeliveries(now.Add(webhookLease+time.Second), webhookLease, webhookBatchSize)
+	if err != nil || len(again) != 1 || again[0].ID != claimed[0].ID || again[0].Attempts != 0 {
+		t.Errorf("Claim after the lease = %+v, %v; want the delivery again", again, err)
+	}
+}
+
+func TestWebhookDeliveryGivesUp(t *testing.T) {
+	store := newTestStore(t)
+	receiver := &webhookReceiver{t: t, secret: "whsec_test", status: http.StatusInternalServerError}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	hook := newTestWebhook(t, store, server.URL)
+	dispatcher := &WebhookDispatcher{Store: store, AllowPrivate: true}
+	createTaskInStore(t, store, Task{Title: "Ship", DueDate: "2024-12-01", Priority: 1})
+
+	// Each round is past the longest backoff, so every one retries.
+	now := time.Now()
+	for i := 0; i < webhookMaxAttempts+2; i++ {
+		if err := dispatcher.Deliver(context.Background(), now.Add(time.Duration(i)*(webhookMaxRetryDelay+time.Second))); err != nil {
+			t.Fatalf("Deliver returned error: %v", err)
+		}
+	}
+	deliveries, err := store.ListWebhookDeliveries(hook.ID, 10)
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("ListWebhookDeliveries = %+v, %v", deliveries, err)
+	}
+	if got := deliveries[0]; got.Status != DeliveryFailed || got.Attempts != webhookMaxAttempts || got.NextAttemptAt != nil ||
+		got.ResponseCode != http.StatusInternalServerError {
+		t.Errorf("Delivery after %d rounds = %+v, want it failed after %d attempts", webhookMaxAttempts+2, got, webhookMaxAttempts)
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{1: 30 * time.Second, 2: time.Minute, 5: 8 * time.Minute, 11: 6 * time.Hour, 50: 6 * time.Hour} {
+		if got := webhookBackoff(attempts); got != want {
+			t.Errorf("webhookBackoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+func TestDeleteProjectQueuesWebhooks(t *testing.T) {
+	store := newTestStore(t)
+	handler := NewRouter(&App{Store: store})
+	tester := testUser(t, store)
+	hook, err := store.CreateWebhook(Webhook{OwnerID: tester.ID, URL: "https://example.com/hook", Events: []string{EventTaskDeleted},
+		Secret: "whsec_test", Active: true, CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("CreateWebhook returned error: %v", err)
+	}
+
+	project := createProjectInStore(t, store, Project{Name: "Doomed"})
+	parent := createTaskInStore(t, store, Task{Title: "Parent", DueDate: "2024-12-01", Priority: 1, ProjectID: project})
+	child := createTaskInStore(t, store, Task{Title: "Child", DueDate: "2024-12-01", Priority: 1, ProjectID: project, ParentID: parent})
+	rr := executeRequest(httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/projects/%d?cascade=true", project), nil), handler)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Cascading delete returned %v: %s", rr.Code, rr.Body.String())
+	}
+
+	deliveries, err := store.ListWebhookDeliveries(hook.ID, 10)
+	if err != nil {
+		t.Fatalf("ListWebhookDeliveries returned error: %v", err)
+	}
+	var got []string
+	for _, delivery := range deliveries {
+		got = append(got, fmt.Sprintf("%s %d", delivery.Event, delivery.TaskID))
+	}
+	// Newest first.
+	if want := fmt.Sprintf("task.deleted %d, task.deleted %d", child, parent); strings.Join(got, ", ") != want {
+		t.Errorf("Cascading delete queued %q, want %q", got, want)
+	}
+}